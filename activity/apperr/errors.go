@@ -0,0 +1,110 @@
+// Package apperr builds the temporal.ApplicationErrors activities return, so the
+// retry policy can tell a mistake that will repeat from trouble that may pass.
+// The error types are stable and safe to match on in workflows.
+package apperr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/SomtoJF/iris-worker/aipi"
+	"github.com/SomtoJF/iris-worker/aipi/schema"
+	"github.com/SomtoJF/iris-worker/aipi/types"
+	"go.temporal.io/sdk/temporal"
+)
+
+// Non-retryable error types: retrying sends the same request and gets the same answer.
+const (
+	TypeInvalidArgument     = "InvalidArgument"
+	TypeSessionNotFound     = "SessionNotFound"
+	TypeNotFound            = "NotFound"
+	TypeAuthentication      = "AuthenticationFailed"
+	TypeSchemaViolation     = "SchemaViolation"
+	TypeConstraintViolation = "ConstraintViolation"
+	// TypeStaleElement means the page changed since the screenshot an action was
+	// planned on; the workflow needs a new screenshot, not a retry.
+	TypeStaleElement = "StaleElement"
+)
+
+// Retryable error types.
+const (
+	TypeRateLimited = "RateLimited"
+	TypeNetwork     = "NetworkError"
+	TypeProvider    = "ProviderUnavailable"
+	TypeBrowser     = "BrowserError"
+	TypeDatabase    = "DatabaseError"
+	TypeStorage     = "StorageError"
+)
+
+// InvalidArgument reports input the activity can never act on, such as an element
+// index out of range.
+func InvalidArgument(format string, args ...interface{}) error {
+	return temporal.NewNonRetryableApplicationError(fmt.Sprintf(format, args...), TypeInvalidArgument, nil)
+}
+
+// SessionNotFound reports a workflow with no open page on this worker. Retrying
+// cannot help: the page lived in a browser the session has lost.
+func SessionNotFound(workflowID string) error {
+	return temporal.NewNonRetryableApplicationError(
+		fmt.Sprintf("no active page for workflow %s", workflowID), TypeSessionNotFound, nil)
+}
+
+// NotFound reports a missing database record.
+func NotFound(format string, args ...interface{}) error {
+	return temporal.NewNonRetryableApplicationError(fmt.Sprintf(format, args...), TypeNotFound, nil)
+}
+
+// NonRetryable wraps err under a non-retryable errType.
+func NonRetryable(errType string, message string, err error) error {
+	return temporal.NewNonRetryableApplicationError(message, errType, err)
+}
+
+// Retryable wraps err under a retryable errType. Network errors are reported as
+// TypeNetwork whatever errType says.
+func Retryable(errType string, message string, err error) error {
+	if isNetworkError(err) {
+		errType = TypeNetwork
+	}
+	return temporal.NewApplicationError(message, errType, err)
+}
+
+// FromProvider classifies an error from an LLM provider by its HTTP status. Rate
+// limits carry the provider's Retry-After hint as the next retry delay.
+func FromProvider(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+	if errors.Is(err, aipi.ErrSchemaViolation) {
+		return NonRetryable(TypeSchemaViolation, "llm response does not match the schema", err)
+	}
+	if errors.Is(err, schema.ErrUnsupportedSchema) {
+		return NonRetryable(TypeInvalidArgument, "response schema can't be validated", err)
+	}
+
+	status := types.StatusCode(err)
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden || status == http.StatusPaymentRequired:
+		return NonRetryable(TypeAuthentication, "llm provider rejected the credentials or account", err)
+	case status == http.StatusTooManyRequests:
+		return temporal.NewApplicationErrorWithOptions("llm provider rate limit", TypeRateLimited, temporal.ApplicationErrorOptions{
+			Cause:          err,
+			NextRetryDelay: types.RetryAfter(err),
+		})
+	case status == http.StatusRequestTimeout || status >= http.StatusInternalServerError:
+		return Retryable(TypeProvider, "llm provider unavailable", err)
+	case status >= http.StatusBadRequest:
+		return NonRetryable(TypeInvalidArgument, "llm provider rejected the request", err)
+	}
+	return Retryable(TypeProvider, "llm call failed", err)
+}
+
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -1,129 +1,205 @@
 package browser
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"image"
+	_ "image/png"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/SomtoJF/iris-worker/activity/apperr"
+	"github.com/SomtoJF/iris-worker/artifact"
 	"github.com/SomtoJF/iris-worker/browserfactory"
 	"github.com/go-rod/rod"
-	"github.com/go-rod/rod/lib/proto"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
 )
 
 type Activity struct {
 	browserFactory browserfactory.BrowserClient
-	activeSessions map[string]*rod.Page
+	artifacts      artifact.Store
+	activeSessions map[string]*session
 	mu             sync.Mutex
 }
 
-func NewActivities(browserFactory browserfactory.BrowserClient) *Activity {
+func NewActivities(browserFactory browserfactory.BrowserClient, artifacts artifact.Store) *Activity {
 	return &Activity{
 		browserFactory: browserFactory,
-		activeSessions: make(map[string]*rod.Page),
+		artifacts:      artifacts,
+		activeSessions: make(map[string]*session),
 	}
 }
 
 func (a *Activity) OpenWebpage(ctx context.Context, input OpenWebpageInput) error {
-	page := a.browserFactory.OpenPageNewTab(a.browserFactory.GetBrowser(), input.Url)
+	var page *rod.Page
+	err := rod.Try(func() {
+		page = a.browserFactory.OpenPageNewTab(a.browserFactory.GetBrowser(), input.Url)
+	})
+	if err != nil {
+		return apperr.Retryable(apperr.TypeBrowser, fmt.Sprintf("failed to open %s", input.Url), err)
+	}
 
 	a.mu.Lock()
-	a.activeSessions[input.WorkflowID] = page
+	a.activeSessions[input.WorkflowID] = &session{page: page}
 	a.mu.Unlock()
 
 	return nil
 }
 
-func (a *Activity) TakeScreenshot(ctx context.Context, input TakeScreenshotInput) (TakeScreenshotOutput, error) {
+// page returns the workflow's open page.
+func (a *Activity) page(workflowID string) (*rod.Page, bool) {
 	a.mu.Lock()
-	page, exists := a.activeSessions[input.WorkflowID]
-	a.mu.Unlock()
+	defer a.mu.Unlock()
 
+	session, exists := a.activeSessions[workflowID]
 	if !exists {
-		return TakeScreenshotOutput{}, fmt.Errorf("no active page for workflow %s", input.WorkflowID)
+		return nil, false
 	}
+	return session.page, true
+}
 
-	screenshotPath, taggedNodes, err := a.browserFactory.ScreenshotForLLM(page, input.FileName)
+func (a *Activity) TakeScreenshot(ctx context.Context, input TakeScreenshotInput) (TakeScreenshotOutput, error) {
+	page, exists := a.page(input.WorkflowID)
+	if !exists {
+		return TakeScreenshotOutput{}, apperr.SessionNotFound(input.WorkflowID)
+	}
+
+	capture, err := a.browserFactory.ScreenshotForLLM(page, browserfactory.CaptureOptions{
+		Clean: input.IncludeClean,
+		Text:  input.IncludeText,
+	})
 	if err != nil {
-		return TakeScreenshotOutput{}, err
+		return TakeScreenshotOutput{}, apperr.Retryable(apperr.TypeBrowser, "failed to take screenshot", err)
 	}
 
-	serializableNodes := make([]browserfactory.SerializableTaggedNode, len(taggedNodes))
-	for i, node := range taggedNodes {
+	serializableNodes := make([]browserfactory.SerializableTaggedNode, len(capture.TaggedNodes))
+	for i, node := range capture.TaggedNodes {
 		serializableNodes[i] = node.ToSerializable()
 	}
 
-	return TakeScreenshotOutput{
-		Path:        screenshotPath,
-		TaggedNodes: serializableNodes,
-	}, nil
-}
+	// The screenshot covers the viewport, so its size is also the visible area.
+	width, height, err := imageSize(capture.Annotated)
+	if err != nil {
+		return TakeScreenshotOutput{}, apperr.Retryable(apperr.TypeBrowser, "failed to read screenshot", err)
+	}
 
-func (a *Activity) Click(ctx context.Context, input ClickInput) error {
+	snap := newSnapshot(capture.TaggedNodes)
 	a.mu.Lock()
-	page, exists := a.activeSessions[input.WorkflowID]
+	if session, exists := a.activeSessions[input.WorkflowID]; exists {
+		session.snapshot = snap
+	}
 	a.mu.Unlock()
 
-	if !exists {
-		return fmt.Errorf("no active page for workflow %s", input.WorkflowID)
+	namespace := artifactNamespace(ctx)
+	uri, err := a.artifacts.Put(ctx, namespace, capture.Annotated, ".png")
+	if err != nil {
+		return TakeScreenshotOutput{}, apperr.Retryable(apperr.TypeStorage, "failed to store screenshot", err)
 	}
 
-	_, taggedNodes, err := a.browserFactory.ScreenshotForLLM(page, "temp.png")
-	if err != nil {
-		return fmt.Errorf("failed to get tagged nodes: %w", err)
+	output := TakeScreenshotOutput{
+		SnapshotID:       snap.id,
+		URI:              uri,
+		Width:            width,
+		Height:           height,
+		Text:             capture.Text,
+		TaggedNodes:      serializableNodes,
+		ValidationErrors: a.validationErrors(ctx, page, snap),
 	}
+	if capture.Clean != nil {
+		output.CleanURI, err = a.artifacts.Put(ctx, namespace, capture.Clean, ".png")
+		if err != nil {
+			return TakeScreenshotOutput{}, apperr.Retryable(apperr.TypeStorage, "failed to store clean screenshot", err)
+		}
+	}
+	return output, nil
+}
 
-	if input.ElementIndex < 0 || input.ElementIndex >= len(taggedNodes) {
-		return fmt.Errorf("element index %d out of range (0-%d)", input.ElementIndex, len(taggedNodes)-1)
+func imageSize(data []byte) (int, int, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read screenshot size: %w", err)
 	}
+	return config.Width, config.Height, nil
+}
+
+// artifactNamespace files artifacts under the run that scheduled the activity, so
+// concurrent workflows never share a path.
+func artifactNamespace(ctx context.Context) artifact.Namespace {
+	execution := activity.GetInfo(ctx).WorkflowExecution
+	return artifact.Namespace{WorkflowID: execution.ID, RunID: execution.RunID}
+}
 
-	element := taggedNodes[input.ElementIndex].Element
-	if element == nil {
-		return fmt.Errorf("element at index %d has no DOM element", input.ElementIndex)
+func (a *Activity) Click(ctx context.Context, input ClickInput) (ActionOutput, error) {
+	page, exists := a.page(input.WorkflowID)
+	if !exists {
+		return ActionOutput{}, apperr.SessionNotFound(input.WorkflowID)
 	}
 
-	err = element.Click(proto.InputMouseButtonLeft, 1)
+	snap, err := a.snapshotFor(input.WorkflowID, input.SnapshotID)
 	if err != nil {
-		return fmt.Errorf("failed to click element: %w", err)
+		return ActionOutput{}, err
+	}
+	node, err := a.resolve(page, snap, input.ElementIndex)
+	if err != nil {
+		return ActionOutput{}, err
 	}
 
-	page.MustWaitIdle()
-	return nil
+	if err := a.browserFactory.Click(page, node); err != nil {
+		return ActionOutput{}, apperr.Retryable(apperr.TypeBrowser, "failed to click element", err)
+	}
+	return ActionOutput{ValidationErrors: a.validationErrors(ctx, page, snap)}, nil
 }
 
-func (a *Activity) Type(ctx context.Context, input TypeInput) error {
-	a.mu.Lock()
-	page, exists := a.activeSessions[input.WorkflowID]
-	a.mu.Unlock()
-
+func (a *Activity) Type(ctx context.Context, input TypeInput) (ActionOutput, error) {
+	page, exists := a.page(input.WorkflowID)
 	if !exists {
-		return fmt.Errorf("no active page for workflow %s", input.WorkflowID)
+		return ActionOutput{}, apperr.SessionNotFound(input.WorkflowID)
 	}
 
-	return a.typeSingleField(page, FieldInput{
+	snap, err := a.snapshotFor(input.WorkflowID, input.SnapshotID)
+	if err != nil {
+		return ActionOutput{}, err
+	}
+
+	err = a.typeSingleField(page, snap, FieldInput{
 		ElementIndex: input.ElementIndex,
 		Text:         input.Text,
 	})
+	if err != nil {
+		return ActionOutput{}, err
+	}
+	return ActionOutput{ValidationErrors: a.validationErrors(ctx, page, snap)}, nil
 }
 
-func (a *Activity) TypeMultiple(ctx context.Context, input TypeMultipleInput) error {
-	a.mu.Lock()
-	page, exists := a.activeSessions[input.WorkflowID]
-	a.mu.Unlock()
-
+func (a *Activity) TypeMultiple(ctx context.Context, input TypeMultipleInput) (ActionOutput, error) {
+	page, exists := a.page(input.WorkflowID)
 	if !exists {
-		return fmt.Errorf("no active page for workflow %s", input.WorkflowID)
+		return ActionOutput{}, apperr.SessionNotFound(input.WorkflowID)
 	}
 
 	if len(input.Fields) == 0 {
-		return nil
+		return ActionOutput{}, nil
+	}
+
+	snap, err := a.snapshotFor(input.WorkflowID, input.SnapshotID)
+	if err != nil {
+		return ActionOutput{}, err
 	}
 
 	var errorMessages []string
+	retryable := true
 	for i, field := range input.Fields {
-		if err := a.typeSingleField(page, field); err != nil {
+		if err := a.typeSingleField(page, snap, field); err != nil {
 			errorMessages = append(errorMessages,
 				fmt.Sprintf("field %d (index %d): %s", i, field.ElementIndex, err.Error()))
+			var appErr *temporal.ApplicationError
+			if errors.As(err, &appErr) && appErr.NonRetryable() {
+				retryable = false
+			}
 			continue
 		}
 
@@ -132,108 +208,171 @@ func (a *Activity) TypeMultiple(ctx context.Context, input TypeMultipleInput) er
 		}
 	}
 
+	// Typing replaces a field's content, so a retry retypes the fields that worked
+	// without doubling their text. One bad index still fails the call for good,
+	// since no retry can fix it.
 	if len(errorMessages) > 0 {
-		return fmt.Errorf("failed to type %d/%d fields: %v",
+		message := fmt.Sprintf("failed to type %d/%d fields: %v",
 			len(errorMessages), len(input.Fields), errorMessages)
+		if !retryable {
+			return ActionOutput{}, apperr.InvalidArgument("%s", message)
+		}
+		return ActionOutput{}, apperr.Retryable(apperr.TypeBrowser, message, nil)
 	}
 
-	return nil
+	return ActionOutput{ValidationErrors: a.validationErrors(ctx, page, snap)}, nil
 }
 
-func (a *Activity) typeSingleField(page *rod.Page, field FieldInput) error {
-	_, taggedNodes, err := a.browserFactory.ScreenshotForLLM(page, "temp.png")
+func (a *Activity) typeSingleField(page *rod.Page, snap *snapshot, field FieldInput) error {
+	node, err := a.resolve(page, snap, field.ElementIndex)
 	if err != nil {
-		return fmt.Errorf("failed to get tagged nodes: %w", err)
+		return err
 	}
 
-	if field.ElementIndex < 0 || field.ElementIndex >= len(taggedNodes) {
-		return fmt.Errorf("element index %d out of range (0-%d)",
-			field.ElementIndex, len(taggedNodes)-1)
+	if err := a.browserFactory.Input(page, node, field.Text); err != nil {
+		return apperr.Retryable(apperr.TypeBrowser, "failed to type into element", err)
 	}
+	return nil
+}
 
-	element := taggedNodes[field.ElementIndex].Element
-	if element == nil {
-		return fmt.Errorf("element at index %d has no DOM element", field.ElementIndex)
+// PressKey presses a key or chord, focusing a tagged element first if one is
+// given. Keys without an element go to whatever has focus.
+func (a *Activity) PressKey(ctx context.Context, input PressKeyInput) (ActionOutput, error) {
+	page, exists := a.page(input.WorkflowID)
+	if !exists {
+		return ActionOutput{}, apperr.SessionNotFound(input.WorkflowID)
 	}
 
-	if err := element.Input(field.Text); err != nil {
-		return fmt.Errorf("failed to type text: %w", err)
+	if _, err := browserfactory.ParseKeyChord(input.Key); err != nil {
+		return ActionOutput{}, apperr.InvalidArgument("%s", err.Error())
 	}
 
-	page.MustWaitIdle()
-	return nil
+	var node *browserfactory.TaggedAccessibilityNode
+	snap, err := a.snapshotFor(input.WorkflowID, input.SnapshotID)
+	if input.ElementIndex != nil {
+		if err != nil {
+			return ActionOutput{}, err
+		}
+		node, err = a.resolve(page, snap, *input.ElementIndex)
+		if err != nil {
+			return ActionOutput{}, err
+		}
+	} else if err != nil {
+		// Without an element the key doesn't depend on the snapshot; it is only
+		// used to tie validation errors to tags.
+		snap = nil
+	}
+
+	if err := a.browserFactory.PressKey(page, node, input.Key); err != nil {
+		return ActionOutput{}, apperr.Retryable(apperr.TypeBrowser, fmt.Sprintf("failed to press %s", input.Key), err)
+	}
+	return ActionOutput{ValidationErrors: a.validationErrors(ctx, page, snap)}, nil
 }
 
-func (a *Activity) Scroll(ctx context.Context, input ScrollInput) error {
-	a.mu.Lock()
-	page, exists := a.activeSessions[input.WorkflowID]
-	a.mu.Unlock()
+// ExtractFormFields describes every form control tagged in the snapshot, in tag
+// order. Field indexes are the snapshot's tag indexes, so actions can use them.
+// A control that changed or left the page since the snapshot is reported in
+// Errors and the rest are still described. Controls that aren't rendered, such
+// as display:none inputs behind a styled widget, have no tag and are left out:
+// no action could reach them, and the widget standing in for them is listed.
+func (a *Activity) ExtractFormFields(ctx context.Context, input ExtractFormFieldsInput) (ExtractFormFieldsOutput, error) {
+	page, exists := a.page(input.WorkflowID)
+	if !exists {
+		return ExtractFormFieldsOutput{}, apperr.SessionNotFound(input.WorkflowID)
+	}
+
+	snap, err := a.snapshotFor(input.WorkflowID, input.SnapshotID)
+	if err != nil {
+		return ExtractFormFieldsOutput{}, err
+	}
 
+	indexes := make([]int, 0, len(snap.elements))
+	for index, ref := range snap.elements {
+		if browserfactory.FieldRoles[ref.Fingerprint.Role] {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Ints(indexes)
+
+	output := ExtractFormFieldsOutput{SnapshotID: snap.id, Fields: []browserfactory.FormField{}}
+	for _, index := range indexes {
+		node, err := a.resolve(page, snap, index)
+		if err != nil {
+			var appErr *temporal.ApplicationError
+			if errors.As(err, &appErr) && appErr.Type() == apperr.TypeStaleElement {
+				output.Errors = append(output.Errors, FormFieldError{ElementIndex: index, Message: err.Error()})
+				continue
+			}
+			return ExtractFormFieldsOutput{}, err
+		}
+		field, err := a.browserFactory.DescribeField(page, node)
+		if err != nil {
+			// The element resolved, so this is about the element rather than the
+			// browser: it went away in between, or the page's scripts threw.
+			output.Errors = append(output.Errors, FormFieldError{ElementIndex: index, Message: err.Error()})
+			continue
+		}
+		if field != nil {
+			output.Fields = append(output.Fields, *field)
+		}
+	}
+
+	return output, nil
+}
+
+func (a *Activity) Scroll(ctx context.Context, input ScrollInput) error {
+	page, exists := a.page(input.WorkflowID)
 	if !exists {
-		return fmt.Errorf("no active page for workflow %s", input.WorkflowID)
+		return apperr.SessionNotFound(input.WorkflowID)
 	}
 
 	if input.Ratio < 0.1 || input.Ratio > 1.0 {
-		return fmt.Errorf("scroll ratio must be between 0.1 and 1.0, got %f", input.Ratio)
+		return apperr.InvalidArgument("scroll ratio must be between 0.1 and 1.0, got %f", input.Ratio)
 	}
 
 	multiplier := 1.0
 	if input.Direction == "up" {
 		multiplier = -1.0
 	} else if input.Direction != "down" {
-		return fmt.Errorf("scroll direction must be 'up' or 'down', got %s", input.Direction)
+		return apperr.InvalidArgument("scroll direction must be 'up' or 'down', got %s", input.Direction)
 	}
 
-	_, err := page.Eval(`(ratio, mult) => {
-		const amount = window.innerHeight * ratio * mult;
-		window.scrollBy({
-			top: amount,
-			behavior: 'instant'
-		});
-	}`, input.Ratio, multiplier)
-
-	if err != nil {
-		return fmt.Errorf("failed to scroll: %w", err)
+	if err := a.browserFactory.Scroll(page, input.Ratio, multiplier); err != nil {
+		return apperr.Retryable(apperr.TypeBrowser, "failed to scroll", err)
 	}
-
-	page.MustWaitIdle()
 	return nil
 }
 
 func (a *Activity) Navigate(ctx context.Context, input NavigateInput) error {
-	a.mu.Lock()
-	page, exists := a.activeSessions[input.WorkflowID]
-	a.mu.Unlock()
-
+	page, exists := a.page(input.WorkflowID)
 	if !exists {
-		return fmt.Errorf("no active page for workflow %s", input.WorkflowID)
+		return apperr.SessionNotFound(input.WorkflowID)
 	}
 
-	err := page.Navigate(input.Url)
-	if err != nil {
-		return fmt.Errorf("failed to navigate to %s: %w", input.Url, err)
+	if input.Url == "" {
+		return apperr.InvalidArgument("navigate needs a url")
 	}
 
-	page.MustWaitStable()
+	if err := a.browserFactory.Navigate(page, input.Url); err != nil {
+		return apperr.Retryable(apperr.TypeBrowser, "failed to navigate", err)
+	}
 	return nil
 }
 
 func (a *Activity) ClosePage(ctx context.Context, input ClosePageInput) error {
 	a.mu.Lock()
-	page, exists := a.activeSessions[input.WorkflowID]
+	session, exists := a.activeSessions[input.WorkflowID]
 	if exists {
 		delete(a.activeSessions, input.WorkflowID)
 	}
 	a.mu.Unlock()
 
 	if !exists {
-		return fmt.Errorf("no active page for workflow %s", input.WorkflowID)
+		return apperr.SessionNotFound(input.WorkflowID)
 	}
 
-	err := page.Close()
-	if err != nil {
-		return fmt.Errorf("failed to close page: %w", err)
+	if err := a.browserFactory.ClosePage(session.page); err != nil {
+		return apperr.Retryable(apperr.TypeBrowser, "failed to close page", err)
 	}
-
 	return nil
 }
@@ -0,0 +1,114 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/SomtoJF/iris-worker/browserfactory"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"github.com/ysmood/gson"
+)
+
+// formClient is a browser with a form of tagged fields, some of which went
+// stale after the snapshot.
+type formClient struct {
+	browserfactory.BrowserClient
+	stale    map[int]bool
+	failures map[int]error
+}
+
+func (c *formClient) Resolve(page *rod.Page, ref browserfactory.NodeRef) (*browserfactory.TaggedAccessibilityNode, error) {
+	if c.stale[ref.Index] {
+		return nil, fmt.Errorf("%w: element %d is no longer on the page", browserfactory.ErrStaleElement, ref.Index)
+	}
+	return &browserfactory.TaggedAccessibilityNode{Index: ref.Index}, nil
+}
+
+func (c *formClient) DescribeField(page *rod.Page, node *browserfactory.TaggedAccessibilityNode) (*browserfactory.FormField, error) {
+	if err := c.failures[node.Index]; err != nil {
+		return nil, err
+	}
+	return &browserfactory.FormField{Index: node.Index, Type: "text", Label: fmt.Sprintf("Field %d", node.Index)}, nil
+}
+
+func taggedNode(index int, role string) *browserfactory.TaggedAccessibilityNode {
+	return &browserfactory.TaggedAccessibilityNode{
+		Node:   &proto.AccessibilityAXNode{Role: &proto.AccessibilityAXValue{Value: gson.New(role)}},
+		Bounds: &proto.DOMRect{},
+		Index:  index,
+	}
+}
+
+func TestExtractFormFieldsSkipsBrokenFields(t *testing.T) {
+	client := &formClient{
+		stale:    map[int]bool{1: true},
+		failures: map[int]error{3: errors.New("element detached")},
+	}
+	a := NewActivities(client, nil)
+	snap := newSnapshot([]*browserfactory.TaggedAccessibilityNode{
+		taggedNode(0, "textbox"), taggedNode(1, "textbox"), taggedNode(2, "link"), taggedNode(3, "checkbox"), taggedNode(4, "combobox"),
+	})
+	a.activeSessions["workflow"] = &session{snapshot: snap}
+
+	output, err := a.ExtractFormFields(context.Background(), ExtractFormFieldsInput{WorkflowID: "workflow", SnapshotID: snap.id})
+	if err != nil {
+		t.Fatalf("ExtractFormFields: %v", err)
+	}
+
+	var described []int
+	for _, field := range output.Fields {
+		described = append(described, field.Index)
+	}
+	if fmt.Sprint(described) != "[0 4]" {
+		t.Errorf("described fields %v, want [0 4]", described)
+	}
+	if len(output.Errors) != 2 || output.Errors[0].ElementIndex != 1 || output.Errors[1].ElementIndex != 3 {
+		t.Errorf("errors = %+v, want fields 1 and 3", output.Errors)
+	}
+}
+
+// validationClient reports the same backend node id invalid in the top page and
+// in an out-of-process iframe.
+type validationClient struct {
+	browserfactory.BrowserClient
+	frame *browserfactory.FrameRef
+}
+
+func (c *validationClient) ValidationErrors(page *rod.Page) ([]browserfactory.ValidationError, error) {
+	return []browserfactory.ValidationError{
+		{BackendNodeID: 7, Field: "Search", Message: "Too short", Source: "validity"},
+		{BackendNodeID: 7, Field: "Email", Message: "Enter a valid email", Source: "aria-invalid", Frame: c.frame},
+		{BackendNodeID: 9, Field: "Phone", Message: "Required", Source: "css", Frame: &browserfactory.FrameRef{TargetID: "other"}},
+		{Message: "Please fix the errors below", Source: "alert", Frame: c.frame},
+	}, nil
+}
+
+func TestValidationErrorsMatchTagsByFrame(t *testing.T) {
+	frame := &browserfactory.FrameRef{TargetID: "greenhouse", OwnerNodeID: 3}
+	a := NewActivities(&validationClient{frame: frame}, nil)
+
+	search := taggedNode(0, "searchbox")
+	search.Node.BackendDOMNodeID = 7
+	email := taggedNode(1, "textbox")
+	email.Node.BackendDOMNodeID = 7
+	email.Frame = frame
+	snap := newSnapshot([]*browserfactory.TaggedAccessibilityNode{search, email})
+
+	got := a.validationErrors(context.Background(), nil, snap)
+	if len(got) != 4 {
+		t.Fatalf("errors = %+v, want all four", got)
+	}
+	want := []string{"0", "1", "untagged", "untagged"}
+	for i, fieldError := range got {
+		index := "untagged"
+		if fieldError.ElementIndex != nil {
+			index = fmt.Sprint(*fieldError.ElementIndex)
+		}
+		if index != want[i] {
+			t.Errorf("%q is tied to %s, want %s", fieldError.Message, index, want[i])
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/SomtoJF/iris-worker/activity/apperr"
+	"github.com/SomtoJF/iris-worker/browserfactory"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"github.com/google/uuid"
+	"go.temporal.io/sdk/activity"
+)
+
+// snapshot remembers which element each tag of a screenshot stood for, so actions
+// hit the element the planner saw rather than whatever a re-tag numbers the same.
+type snapshot struct {
+	id       string
+	elements map[int]browserfactory.NodeRef
+}
+
+func newSnapshot(taggedNodes []*browserfactory.TaggedAccessibilityNode) *snapshot {
+	elements := make(map[int]browserfactory.NodeRef, len(taggedNodes))
+	for _, node := range taggedNodes {
+		elements[node.Index] = node.Ref()
+	}
+	return &snapshot{id: uuid.NewString(), elements: elements}
+}
+
+// session is the page a workflow drives and its latest snapshot.
+type session struct {
+	page     *rod.Page
+	snapshot *snapshot
+}
+
+// snapshotFor returns the workflow's latest snapshot. An empty id means whichever
+// is latest; any other id must match it, since older snapshots are discarded.
+func (a *Activity) snapshotFor(workflowID string, snapshotID string) (*snapshot, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	session, exists := a.activeSessions[workflowID]
+	if !exists {
+		return nil, apperr.SessionNotFound(workflowID)
+	}
+	current := session.snapshot
+	if current == nil {
+		return nil, apperr.InvalidArgument("no screenshot taken for workflow %s yet", workflowID)
+	}
+	if snapshotID != "" && snapshotID != current.id {
+		return nil, apperr.NonRetryable(apperr.TypeStaleElement,
+			fmt.Sprintf("snapshot %s is stale; take a new screenshot", snapshotID), nil)
+	}
+	return current, nil
+}
+
+// resolve finds the live element behind a tag of snap.
+func (a *Activity) resolve(page *rod.Page, snap *snapshot, index int) (*browserfactory.TaggedAccessibilityNode, error) {
+	ref, exists := snap.elements[index]
+	if !exists {
+		return nil, apperr.InvalidArgument("element index %d is not tagged in snapshot %s", index, snap.id)
+	}
+
+	node, err := a.browserFactory.Resolve(page, ref)
+	if errors.Is(err, browserfactory.ErrStaleElement) {
+		return nil, apperr.NonRetryable(apperr.TypeStaleElement,
+			"element changed since the screenshot; take a new screenshot", err)
+	}
+	if err != nil {
+		return nil, apperr.Retryable(apperr.TypeBrowser, "failed to find element", err)
+	}
+	return node, nil
+}
+
+// validationErrors reads the errors the page shows and ties them to snap's tags,
+// if snap isn't nil. Finding none is not worth failing an action over, so lookup
+// errors are only logged.
+func (a *Activity) validationErrors(ctx context.Context, page *rod.Page, snap *snapshot) []FieldError {
+	found, err := a.browserFactory.ValidationErrors(page)
+	if err != nil {
+		activity.GetLogger(ctx).Warn("Failed to look for validation errors", "error", err)
+		return nil
+	}
+
+	// Backend node ids are only unique within a frame's session, so tags are
+	// matched on both.
+	indexes := map[frameNode]int{}
+	if snap != nil {
+		for index, ref := range snap.elements {
+			indexes[newFrameNode(ref.Frame, ref.BackendNodeID)] = index
+		}
+	}
+
+	fieldErrors := make([]FieldError, len(found))
+	for i, validationError := range found {
+		fieldErrors[i] = FieldError{
+			Field:   validationError.Field,
+			Message: validationError.Message,
+			Source:  validationError.Source,
+		}
+		if index, tagged := indexes[newFrameNode(validationError.Frame, validationError.BackendNodeID)]; tagged && validationError.BackendNodeID != 0 {
+			fieldErrors[i].ElementIndex = &index
+		}
+	}
+	return fieldErrors
+}
+
+// frameNode identifies a node across frames: the out-of-process iframe it is in,
+// empty for the top page, and its backend node id there.
+type frameNode struct {
+	target proto.TargetTargetID
+	node   proto.DOMBackendNodeID
+}
+
+func newFrameNode(frame *browserfactory.FrameRef, node proto.DOMBackendNodeID) frameNode {
+	if frame == nil {
+		return frameNode{node: node}
+	}
+	return frameNode{target: frame.TargetID, node: node}
+}
@@ -9,21 +9,56 @@ type OpenWebpageInput struct {
 
 type TakeScreenshotInput struct {
 	WorkflowID string `json:"workflow_id"`
-	FileName   string `json:"file_name"`
+	// IncludeClean also stores a screenshot without the grid and tags.
+	IncludeClean bool `json:"include_clean,omitempty"`
+	// IncludeText also describes the page in text, for models that can't read
+	// screenshots or as extra context for ones that can.
+	IncludeText bool `json:"include_text,omitempty"`
 }
 
 type TakeScreenshotOutput struct {
-	Path        string                                   `json:"path"`
+	// SnapshotID names the tagging; pass it to actions on TaggedNodes.
+	SnapshotID string `json:"snapshot_id"`
+	// URI points into the worker's artifact store; CallLLM resolves it.
+	URI         string                                  `json:"uri"`
+	CleanURI    string                                  `json:"clean_uri,omitempty"`
+	Text        string                                  `json:"text,omitempty"`
+	Width       int                                     `json:"width"`
+	Height      int                                     `json:"height"`
 	TaggedNodes []browserfactory.SerializableTaggedNode `json:"tagged_nodes"`
+	// ValidationErrors are the errors the page shows, such as ones left by the
+	// last submit.
+	ValidationErrors []FieldError `json:"validation_errors,omitempty"`
 }
 
+// FieldError is a validation error the page shows. ElementIndex is the tag of the
+// control it is about; it is unset for errors about the whole form and for
+// controls that weren't tagged.
+type FieldError struct {
+	ElementIndex *int   `json:"element_index,omitempty"`
+	Field        string `json:"field,omitempty"`
+	Message      string `json:"message"`
+	Source       string `json:"source"`
+}
+
+// ActionOutput is what actions on elements report back: the errors the page
+// shows afterwards, so a submit that failed validation says which fields to fix.
+type ActionOutput struct {
+	ValidationErrors []FieldError `json:"validation_errors,omitempty"`
+}
+
+// Actions on tagged elements name the snapshot their index comes from. An empty
+// SnapshotID means the latest one.
+
 type ClickInput struct {
 	WorkflowID   string `json:"workflow_id"`
+	SnapshotID   string `json:"snapshot_id,omitempty"`
 	ElementIndex int    `json:"element_index"`
 }
 
 type TypeInput struct {
 	WorkflowID   string `json:"workflow_id"`
+	SnapshotID   string `json:"snapshot_id,omitempty"`
 	ElementIndex int    `json:"element_index"`
 	Text         string `json:"text"`
 }
@@ -35,9 +70,38 @@ type FieldInput struct {
 
 type TypeMultipleInput struct {
 	WorkflowID string       `json:"workflow_id"`
+	SnapshotID string       `json:"snapshot_id,omitempty"`
 	Fields     []FieldInput `json:"fields"`
 }
 
+type PressKeyInput struct {
+	WorkflowID string `json:"workflow_id"`
+	SnapshotID string `json:"snapshot_id,omitempty"`
+	// ElementIndex, if set, is focused before the key is pressed.
+	ElementIndex *int `json:"element_index,omitempty"`
+	// Key is a key or a chord such as "Enter" or "Ctrl+A".
+	Key string `json:"key"`
+}
+
+type ExtractFormFieldsInput struct {
+	WorkflowID string `json:"workflow_id"`
+	SnapshotID string `json:"snapshot_id,omitempty"`
+}
+
+type ExtractFormFieldsOutput struct {
+	// SnapshotID is the snapshot the field indexes belong to.
+	SnapshotID string                     `json:"snapshot_id"`
+	Fields     []browserfactory.FormField `json:"fields"`
+	// Errors lists the fields that couldn't be described.
+	Errors []FormFieldError `json:"errors,omitempty"`
+}
+
+// FormFieldError is why one tagged field is missing from ExtractFormFieldsOutput.
+type FormFieldError struct {
+	ElementIndex int    `json:"element_index"`
+	Message      string `json:"message"`
+}
+
 type ScrollInput struct {
 	WorkflowID string  `json:"workflow_id"`
 	Direction  string  `json:"direction"` // "up" or "down"
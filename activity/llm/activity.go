@@ -2,18 +2,201 @@ package llm
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/SomtoJF/iris-worker/activity/apperr"
+	"github.com/SomtoJF/iris-worker/aipi"
+	"github.com/SomtoJF/iris-worker/aipi/pricing"
 	"github.com/SomtoJF/iris-worker/aipi/types"
+	"github.com/SomtoJF/iris-worker/artifact"
+	"go.temporal.io/sdk/activity"
+)
+
+const (
+	// maxPartialTextLength keeps heartbeat payloads small on long completions.
+	maxPartialTextLength = 2048
+	// rateLimitQueueTimeMetric is how long calls waited for the client's rate limiter.
+	rateLimitQueueTimeMetric = "llm_rate_limit_queue_time"
+	// defaultHeartbeatInterval applies when the activity has no heartbeat timeout.
+	defaultHeartbeatInterval = 10 * time.Second
 )
 
 type Activity struct {
-	aipi types.AIPI
+	aipi      types.AIPI
+	pricing   *pricing.Registry
+	artifacts artifact.Store
+}
+
+// NewActivity takes the pricing registry for model limit lookups. It may be nil,
+// e.g. when replaying, in which case every limit is reported as unknown. Image
+// parts that aren't web or data URLs are read from artifacts.
+func NewActivity(aipi types.AIPI, registry *pricing.Registry, artifacts artifact.Store) *Activity {
+	return &Activity{aipi: aipi, pricing: registry, artifacts: artifacts}
 }
 
-func NewActivity(aipi types.AIPI) *Activity {
-	return &Activity{aipi: aipi}
+// ModelLimits are a model's token limits. Zero means unknown.
+type ModelLimits struct {
+	ContextLength       int `json:"context_length"`
+	MaxCompletionTokens int `json:"max_completion_tokens"`
+}
+
+// GetModelLimits lets workflows size prompts without reading the registry themselves.
+func (a *Activity) GetModelLimits(ctx context.Context, model string) (ModelLimits, error) {
+	if a.pricing == nil {
+		return ModelLimits{}, nil
+	}
+	info, _ := a.pricing.Lookup(model)
+	return ModelLimits{
+		ContextLength:       info.ContextLength,
+		MaxCompletionTokens: info.MaxCompletionTokens,
+	}, nil
 }
 
 func (a *Activity) CallLLM(ctx context.Context, req types.AIPIRequest) (types.AIPIResponse, error) {
-	return a.aipi.GetCompletion(ctx, req)
+	if req.ImageUrl != nil {
+		imageUrl, err := a.resolveImageUrl(ctx, *req.ImageUrl, 0)
+		if err != nil {
+			return types.AIPIResponse{}, err
+		}
+		req.ImageUrl = &imageUrl
+	}
+
+	messages := make([]types.Message, len(req.Messages))
+	for i, message := range req.Messages {
+		parts := make([]types.ContentPart, len(message.Parts))
+		for j, part := range message.Parts {
+			if part.Type == types.ContentPartTypeImage {
+				imageUrl, err := a.resolveImageUrl(ctx, part.ImageUrl, part.MaxImageDimension)
+				if err != nil {
+					return types.AIPIResponse{}, err
+				}
+				part.ImageUrl = imageUrl
+			}
+			parts[j] = part
+		}
+		message.Parts = parts
+		messages[i] = message
+	}
+	req.Messages = messages
+
+	// Heartbeat on a ticker for the whole call: while queued for the rate limiter,
+	// while waiting on providers that don't stream, and between fragments of ones
+	// that do. Fragments only update the progress the next beat reports.
+	progress := &CallLLMProgress{}
+	stopHeartbeat := heartbeat(ctx, progress)
+	var resp types.AIPIResponse
+	var err error
+	if req.ResponseSchema != nil {
+		// Answers that miss the schema get one more try with the problems pointed
+		// out, so workflows only ever see content that validates.
+		_, resp, err = aipi.CompleteStructured[json.RawMessage](ctx, a.aipi, req, progress.add)
+	} else {
+		resp, err = types.Complete(ctx, a.aipi, req, progress.add)
+	}
+	stopHeartbeat()
+	if err != nil {
+		return types.AIPIResponse{}, apperr.FromProvider(err)
+	}
+
+	activity.GetMetricsHandler(ctx).
+		WithTags(map[string]string{"model": resp.Model}).
+		Timer(rateLimitQueueTimeMetric).
+		Record(resp.QueueTime)
+	return resp, nil
+}
+
+// heartbeat records progress right away and then every third of the heartbeat
+// timeout until the returned function is called.
+func heartbeat(ctx context.Context, progress *CallLLMProgress) func() {
+	interval := activity.GetInfo(ctx).HeartbeatTimeout / 3
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+
+	activity.RecordHeartbeat(ctx, progress.snapshot())
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				activity.RecordHeartbeat(ctx, progress.snapshot())
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// CallLLMProgress is the heartbeat detail CallLLM reports while a completion streams.
+type CallLLMProgress struct {
+	mu         sync.Mutex
+	Characters int `json:"characters"`
+	// PartialText holds the most recent output, capped at maxPartialTextLength.
+	PartialText string `json:"partial_text"`
+}
+
+func (p *CallLLMProgress) snapshot() CallLLMProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return CallLLMProgress{Characters: p.Characters, PartialText: p.PartialText}
+}
+
+func (p *CallLLMProgress) add(delta string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Characters += len(delta)
+	p.PartialText += delta
+	if len(p.PartialText) > maxPartialTextLength {
+		p.PartialText = p.PartialText[len(p.PartialText)-maxPartialTextLength:]
+	}
+}
+
+// resolveImageUrl inlines artifact URIs as base64 data URLs. Workflows only ever
+// see artifact URIs, so the image bytes are read here from the artifact store.
+// A positive maxDimension downscales the image first.
+func (a *Activity) resolveImageUrl(ctx context.Context, imageUrl string, maxDimension int) (string, error) {
+	if isWebOrDataUrl(imageUrl) {
+		return imageUrl, nil
+	}
+
+	// A missing artifact or a URI from another store stays that way, so neither is
+	// worth retrying. Store outages are.
+	data, err := a.artifacts.Get(ctx, imageUrl)
+	if errors.Is(err, artifact.ErrNotFound) || errors.Is(err, artifact.ErrInvalidURI) {
+		return "", apperr.NonRetryable(apperr.TypeInvalidArgument, fmt.Sprintf("failed to read image %s", imageUrl), err)
+	}
+	if err != nil {
+		return "", apperr.Retryable(apperr.TypeStorage, fmt.Sprintf("failed to read image %s", imageUrl), err)
+	}
+
+	if maxDimension > 0 {
+		data, err = downscaleImage(data, maxDimension)
+		if err != nil {
+			return "", apperr.NonRetryable(apperr.TypeInvalidArgument, fmt.Sprintf("failed to downscale image %s", imageUrl), err)
+		}
+	}
+
+	return fmt.Sprintf("data:%s;base64,%s", http.DetectContentType(data), base64.StdEncoding.EncodeToString(data)), nil
+}
+
+func isWebOrDataUrl(imageUrl string) bool {
+	return strings.HasPrefix(imageUrl, "http://") || strings.HasPrefix(imageUrl, "https://") ||
+		strings.HasPrefix(imageUrl, "data:")
 }
@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SomtoJF/iris-worker/activity/apperr"
+	"github.com/SomtoJF/iris-worker/aipi/aipitest"
+	"github.com/SomtoJF/iris-worker/aipi/types"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestCallLLMValidatesResponseSchema(t *testing.T) {
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"name": map[string]interface{}{"type": "string"}},
+		"required":   []interface{}{"name"},
+	}
+	tests := []struct {
+		name        string
+		schema      map[string]interface{}
+		contents    []string
+		wantContent string
+		wantCalls   int
+		wantErrType string
+	}{
+		{name: "no schema", contents: []string{"hello"}, wantContent: "hello", wantCalls: 1},
+		{name: "valid answer", schema: schema, contents: []string{`{"name":"Jane"}`}, wantContent: `{"name":"Jane"}`, wantCalls: 1},
+		{name: "fixed on retry", schema: schema, contents: []string{`{"name":4}`, `{"name":"Jane"}`}, wantContent: `{"name":"Jane"}`, wantCalls: 2},
+		{name: "wrong twice", schema: schema, contents: []string{`{}`, `{"name":null}`}, wantCalls: 2, wantErrType: apperr.TypeSchemaViolation},
+		{name: "unsupported schema", schema: map[string]interface{}{"type": "string", "format": "email"}, wantCalls: 0, wantErrType: apperr.TypeInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var suite testsuite.WorkflowTestSuite
+			env := suite.NewTestActivityEnvironment()
+			client := aipitest.Contents(tt.contents...)
+			env.RegisterActivity(NewActivity(client, nil, nil))
+
+			value, err := env.ExecuteActivity("CallLLM", types.AIPIRequest{Model: "m", UserMessage: "who applied?", ResponseSchema: tt.schema})
+			if calls := len(client.Requests()); calls != tt.wantCalls {
+				t.Errorf("made %d calls, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantErrType != "" {
+				var appErr *temporal.ApplicationError
+				if !errors.As(err, &appErr) || appErr.Type() != tt.wantErrType || !appErr.NonRetryable() {
+					t.Fatalf("err = %v, want a non-retryable %s error", err, tt.wantErrType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CallLLM: %v", err)
+			}
+			var resp types.AIPIResponse
+			if err := value.Get(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Content != tt.wantContent {
+				t.Errorf("content = %q, want %q", resp.Content, tt.wantContent)
+			}
+		})
+	}
+}
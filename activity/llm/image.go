@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"bytes"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+
+	"github.com/SomtoJF/iris-worker/aipi"
+)
+
+// downscaleImage shrinks an encoded image so neither side exceeds maxDimension and
+// returns it as PNG. Images that already fit are returned untouched.
+func downscaleImage(data []byte, maxDimension int) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	width, height := aipi.ScaleToFit(config.Width, config.Height, maxDimension)
+	if width == config.Width && height == config.Height {
+		return data, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, resize(src, width, height)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// resize averages each destination pixel over the source pixels it covers, which
+// keeps small text in screenshots legible better than nearest-neighbor sampling.
+func resize(src image.Image, width, height int) *image.RGBA {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / n >> 8)
+			dst.Pix[offset+1] = uint8(g / n >> 8)
+			dst.Pix[offset+2] = uint8(b / n >> 8)
+			dst.Pix[offset+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
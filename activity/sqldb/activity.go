@@ -2,8 +2,12 @@ package sqldb
 
 import (
 	"context"
+	"errors"
 	"time"
 
+	"github.com/SomtoJF/iris-worker/activity/apperr"
+	"github.com/SomtoJF/iris-worker/aipi/types"
+	"github.com/SomtoJF/iris-worker/browserfactory"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -21,6 +25,24 @@ type UpdateJobApplicationInput struct {
 	Data             map[string]interface{} `json:"data"`
 }
 
+type RecordAgentStepInput struct {
+	IdJobApplication uint                                    `json:"id_job_application"`
+	WorkflowID       string                                  `json:"workflow_id"`
+	RunID            string                                  `json:"run_id"`
+	Iteration        int                                     `json:"iteration"`
+	ScreenshotURI    string                                  `json:"screenshot_uri"`
+	TaggedNodes      []browserfactory.SerializableTaggedNode `json:"tagged_nodes"`
+	Prompt           types.AIPIRequest                       `json:"prompt"`
+	RawResponse      string                                  `json:"raw_response"`
+	ToolName         string                                  `json:"tool_name,omitempty"`
+	ToolArguments    map[string]interface{}                  `json:"tool_arguments,omitempty"`
+	ToolResult       map[string]interface{}                  `json:"tool_result,omitempty"`
+	ToolError        string                                  `json:"tool_error,omitempty"`
+	PlannerError     string                                  `json:"planner_error,omitempty"`
+	LatencyMs        int64                                   `json:"latency_ms"`
+	Cost             float64                                 `json:"cost"`
+}
+
 // ====== MODELS ======
 
 type JobApplicationStatus string
@@ -36,6 +58,7 @@ type JobApplication struct {
 	IdExternal       uuid.UUID            `gorm:"type:text;not null;unique" json:"id"`
 	Status           JobApplicationStatus `gorm:"type:varchar(50);not null"`
 	Url              string               `gorm:"not null;unique"`
+	LlmCost          float64              `gorm:"not null;default:0"`
 	CreatedAt        time.Time            `gorm:"default:CURRENT_TIMESTAMP"`
 	UpdatedAt        time.Time            `gorm:"default:CURRENT_TIMESTAMP;autoUpdateTime"`
 	DeletedAt        *time.Time           `gorm:"index;default:NULL"`
@@ -45,9 +68,80 @@ func (JobApplication) TableName() string {
 	return "job_application"
 }
 
+// AgentStep is one iteration of the agent loop, kept for debugging runs after the fact.
+type AgentStep struct {
+	IdAgentStep      uint                                    `gorm:"primaryKey;autoIncrement;column:id_agent_step" json:"_"`
+	IdJobApplication uint                                    `gorm:"not null;index"`
+	WorkflowID       string                                  `gorm:"not null;index"`
+	RunID            string                                  `gorm:"not null"`
+	Iteration        int                                     `gorm:"not null"`
+	ScreenshotURI    string                                  `gorm:"type:text;column:screenshot_path"`
+	TaggedNodes      []browserfactory.SerializableTaggedNode `gorm:"type:text;serializer:json"`
+	Prompt           types.AIPIRequest                       `gorm:"type:text;serializer:json"`
+	RawResponse      string                                  `gorm:"type:text"`
+	ToolName         string                                  `gorm:"type:varchar(50)"`
+	ToolArguments    map[string]interface{}                  `gorm:"type:text;serializer:json"`
+	ToolResult       map[string]interface{}                  `gorm:"type:text;serializer:json"`
+	ToolError        string                                  `gorm:"type:text"`
+	PlannerError     string                                  `gorm:"type:text"`
+	LatencyMs        int64
+	Cost             float64
+	CreatedAt        time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+func (AgentStep) TableName() string {
+	return "agent_step"
+}
+
 func (a *Activity) UpdateJobApplication(ctx context.Context, input UpdateJobApplicationInput) error {
-	if err := a.db.Model(&JobApplication{}).Where("id_job_application = ?", input.IdJobApplication).Updates(input.Data).Error; err != nil {
-		return err
+	if len(input.Data) == 0 {
+		return apperr.InvalidArgument("no fields to update on job application %d", input.IdJobApplication)
+	}
+
+	result := a.db.Model(&JobApplication{}).Where("id_job_application = ?", input.IdJobApplication).Updates(input.Data)
+	if result.Error != nil {
+		return classifyError("failed to update job application", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return apperr.NotFound("job application %d not found", input.IdJobApplication)
 	}
 	return nil
 }
+
+func (a *Activity) RecordAgentStep(ctx context.Context, input RecordAgentStepInput) error {
+	step := AgentStep{
+		IdJobApplication: input.IdJobApplication,
+		WorkflowID:       input.WorkflowID,
+		RunID:            input.RunID,
+		Iteration:        input.Iteration,
+		ScreenshotURI:    input.ScreenshotURI,
+		TaggedNodes:      input.TaggedNodes,
+		Prompt:           input.Prompt,
+		RawResponse:      input.RawResponse,
+		ToolName:         input.ToolName,
+		ToolArguments:    input.ToolArguments,
+		ToolResult:       input.ToolResult,
+		ToolError:        input.ToolError,
+		PlannerError:     input.PlannerError,
+		LatencyMs:        input.LatencyMs,
+		Cost:             input.Cost,
+	}
+	if err := a.db.Create(&step).Error; err != nil {
+		return classifyError("failed to record agent step", err)
+	}
+	return nil
+}
+
+// classifyError relies on the connection translating driver errors (TranslateError)
+// so constraint violations surface as gorm sentinels.
+func classifyError(message string, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return apperr.NonRetryable(apperr.TypeNotFound, message, err)
+	case errors.Is(err, gorm.ErrDuplicatedKey), errors.Is(err, gorm.ErrForeignKeyViolated), errors.Is(err, gorm.ErrCheckConstraintViolated):
+		return apperr.NonRetryable(apperr.TypeConstraintViolation, message, err)
+	case errors.Is(err, gorm.ErrInvalidData), errors.Is(err, gorm.ErrInvalidField), errors.Is(err, gorm.ErrMissingWhereClause):
+		return apperr.NonRetryable(apperr.TypeInvalidArgument, message, err)
+	}
+	return apperr.Retryable(apperr.TypeDatabase, message, err)
+}
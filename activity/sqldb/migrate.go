@@ -0,0 +1,25 @@
+package sqldb
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Migrate creates or updates the tables the worker owns, plus any extra models
+// passed in. job_application belongs to the API that creates applications, so
+// it is never auto-migrated here; the worker only adds the llm_cost column it
+// writes, and only once the API has created the table.
+func Migrate(db *gorm.DB, models ...interface{}) error {
+	if err := db.AutoMigrate(append([]interface{}{&AgentStep{}}, models...)...); err != nil {
+		return fmt.Errorf("failed to migrate worker tables: %w", err)
+	}
+
+	migrator := db.Migrator()
+	if migrator.HasTable(&JobApplication{}) && !migrator.HasColumn(&JobApplication{}, "LlmCost") {
+		if err := migrator.AddColumn(&JobApplication{}, "LlmCost"); err != nil {
+			return fmt.Errorf("failed to add llm_cost to job_application: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+// Package aipitest provides AIPI fakes for tests.
+package aipitest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/SomtoJF/iris-worker/aipi/types"
+)
+
+// ScriptedAIPI answers the nth request with Responses[n] and records every
+// request it is sent. A request past the end of the script fails.
+type ScriptedAIPI struct {
+	Responses []types.AIPIResponse
+
+	mu       sync.Mutex
+	requests []types.AIPIRequest
+}
+
+// Contents scripts one response per content.
+func Contents(contents ...string) *ScriptedAIPI {
+	responses := make([]types.AIPIResponse, len(contents))
+	for i, content := range contents {
+		responses[i] = types.AIPIResponse{Content: content}
+	}
+	return &ScriptedAIPI{Responses: responses}
+}
+
+func (s *ScriptedAIPI) GetCompletion(ctx context.Context, req types.AIPIRequest) (types.AIPIResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+	if len(s.requests) > len(s.Responses) {
+		return types.AIPIResponse{}, fmt.Errorf("request %d is past the end of the script", len(s.requests))
+	}
+	return s.Responses[len(s.requests)-1], nil
+}
+
+// Requests returns the requests sent so far, in order.
+func (s *ScriptedAIPI) Requests() []types.AIPIRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]types.AIPIRequest{}, s.requests...)
+}
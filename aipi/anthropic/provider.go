@@ -0,0 +1,329 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/SomtoJF/iris-worker/aipi/types"
+)
+
+const (
+	defaultBaseURL   = "https://api.anthropic.com/v1"
+	apiVersion       = "2023-06-01"
+	defaultMaxTokens = 4096
+	// structuredOutputTool is the tool the model is forced to call when the request
+	// carries a response schema; its input is the structured response.
+	structuredOutputTool = "respond"
+)
+
+type AnthropicProvider struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func NewAnthropicProvider(baseURL, apiKey string) *AnthropicProvider {
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	return &AnthropicProvider{
+		baseURL:    baseURL,
+		apiKey:     apiKey,
+		httpClient: &http.Client{},
+	}
+}
+
+type messagesRequest struct {
+	Model       string         `json:"model"`
+	System      []contentBlock `json:"system,omitempty"`
+	Messages    []message      `json:"messages"`
+	MaxTokens   int            `json:"max_tokens"`
+	Temperature *float64       `json:"temperature,omitempty"`
+	Tools       []tool         `json:"tools,omitempty"`
+	ToolChoice  *toolChoice    `json:"tool_choice,omitempty"`
+}
+
+type message struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+type contentBlock struct {
+	Type         string          `json:"type"`
+	Text         string          `json:"text,omitempty"`
+	Source       *imageSource    `json:"source,omitempty"`
+	ID           string          `json:"id,omitempty"`
+	Name         string          `json:"name,omitempty"`
+	Input        json.RawMessage `json:"input,omitempty"`
+	ToolUseID    string          `json:"tool_use_id,omitempty"`
+	Content      []contentBlock  `json:"content,omitempty"`
+	CacheControl *cacheControl   `json:"cache_control,omitempty"`
+}
+
+type cacheControl struct {
+	Type string `json:"type"`
+}
+
+type imageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+type toolChoice struct {
+	Type                   string `json:"type"`
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+type messagesResponse struct {
+	Model   string         `json:"model"`
+	Content []contentBlock `json:"content"`
+	Usage   struct {
+		InputTokens              int `json:"input_tokens"`
+		OutputTokens             int `json:"output_tokens"`
+		CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+		CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	} `json:"usage"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *AnthropicProvider) GetCompletion(ctx context.Context, req types.AIPIRequest) (types.AIPIResponse, error) {
+	system, messages := buildMessages(req)
+	body := messagesRequest{
+		Model:       req.Model,
+		System:      system,
+		Messages:    messages,
+		MaxTokens:   defaultMaxTokens,
+		Temperature: req.Temperature,
+	}
+
+	if req.MaxTokens != nil {
+		body.MaxTokens = *req.MaxTokens
+	}
+
+	if len(req.Tools) > 0 {
+		body.Tools = buildTools(req.Tools)
+		body.ToolChoice = buildToolChoice(req.ToolChoice, req.ParallelToolCalls)
+	}
+
+	// A response schema is a tool the model must call, unless the request brings
+	// tools of its own; then the model may answer through either.
+	if req.ResponseSchema != nil {
+		body.Tools = append(body.Tools, tool{
+			Name:        structuredOutputTool,
+			Description: "Return the response in the required structure.",
+			InputSchema: req.ResponseSchema,
+		})
+		if len(req.Tools) == 0 {
+			body.ToolChoice = &toolChoice{Type: "tool", Name: structuredOutputTool}
+		}
+	}
+
+	var resp messagesResponse
+	if err := p.post(ctx, "/messages", body, &resp); err != nil {
+		return types.AIPIResponse{}, fmt.Errorf("anthropic api call failed: %w", err)
+	}
+
+	return mapResponse(resp), nil
+}
+
+func (p *AnthropicProvider) post(ctx context.Context, path string, body interface{}, v interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", p.apiKey)
+	httpReq.Header.Set("anthropic-version", apiVersion)
+
+	res, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		raw, _ := io.ReadAll(res.Body)
+		var errRes errorResponse
+		if json.Unmarshal(raw, &errRes) == nil && errRes.Error.Message != "" {
+			return &types.ProviderError{
+				StatusCode: res.StatusCode,
+				RetryAfter: types.ParseRetryAfter(res.Header.Get("Retry-After")),
+				Err:        fmt.Errorf("%s: %s", errRes.Error.Type, errRes.Error.Message),
+			}
+		}
+		return &types.ProviderError{
+			StatusCode: res.StatusCode,
+			RetryAfter: types.ParseRetryAfter(res.Header.Get("Retry-After")),
+			Err:        fmt.Errorf("%s", raw),
+		}
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// buildMessages pulls system turns out into Anthropic's top-level system prompt
+// and maps the rest to content blocks. Tool calls become tool_use blocks of the
+// assistant turn, and tool turns become tool_result blocks of a user turn, with
+// consecutive results sharing one turn as Anthropic expects.
+func buildMessages(req types.AIPIRequest) ([]contentBlock, []message) {
+	system := []contentBlock{}
+	messages := []message{}
+
+	for _, msg := range req.AllMessages() {
+		switch msg.Role {
+		case types.MessageRoleSystem:
+			system = append(system, buildContent(msg.Parts)...)
+		case types.MessageRoleTool:
+			result := contentBlock{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: buildContent(msg.Parts)}
+			if last := len(messages) - 1; last >= 0 && messages[last].Role == string(types.MessageRoleUser) && isToolResults(messages[last].Content) {
+				messages[last].Content = append(messages[last].Content, result)
+				continue
+			}
+			messages = append(messages, message{Role: string(types.MessageRoleUser), Content: []contentBlock{result}})
+		default:
+			content := buildContent(msg.Parts)
+			for _, call := range msg.ToolCalls {
+				content = append(content, contentBlock{Type: "tool_use", ID: call.ID, Name: call.Name, Input: toolInput(call.Arguments)})
+			}
+			messages = append(messages, message{Role: string(msg.Role), Content: content})
+		}
+	}
+
+	return system, messages
+}
+
+func isToolResults(content []contentBlock) bool {
+	for _, block := range content {
+		if block.Type != "tool_result" {
+			return false
+		}
+	}
+	return len(content) > 0
+}
+
+// toolInput is a call's arguments as the JSON object tool_use requires; a call
+// without arguments, or with arguments that aren't JSON, sends an empty object.
+func toolInput(arguments string) json.RawMessage {
+	if arguments == "" || !json.Valid([]byte(arguments)) {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
+
+func buildTools(tools []types.ToolDefinition) []tool {
+	mapped := make([]tool, len(tools))
+	for i, definition := range tools {
+		schema := definition.Parameters
+		if schema == nil {
+			schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		mapped[i] = tool{Name: definition.Name, Description: definition.Description, InputSchema: schema}
+	}
+	return mapped
+}
+
+// buildToolChoice maps the keyword choices to Anthropic's: "required" is "any",
+// and a tool name forces that tool.
+func buildToolChoice(choice types.ToolChoice, parallel *bool) *toolChoice {
+	var mapped toolChoice
+	switch choice {
+	case "", types.ToolChoiceAuto:
+		mapped.Type = "auto"
+	case types.ToolChoiceNone:
+		return &toolChoice{Type: "none"}
+	case types.ToolChoiceRequired:
+		mapped.Type = "any"
+	default:
+		mapped = toolChoice{Type: "tool", Name: string(choice)}
+	}
+	if parallel != nil && !*parallel {
+		mapped.DisableParallelToolUse = true
+	}
+	return &mapped
+}
+
+func buildContent(parts []types.ContentPart) []contentBlock {
+	content := []contentBlock{}
+	for _, part := range parts {
+		var block contentBlock
+		switch part.Type {
+		case types.ContentPartTypeText:
+			if part.Text == "" {
+				continue
+			}
+			block = contentBlock{Type: "text", Text: part.Text}
+		case types.ContentPartTypeImage:
+			block = contentBlock{Type: "image", Source: buildImageSource(part.ImageUrl)}
+		default:
+			continue
+		}
+		if part.Cacheable {
+			block.CacheControl = &cacheControl{Type: "ephemeral"}
+		}
+		content = append(content, block)
+	}
+	return content
+}
+
+func buildImageSource(imageUrl string) *imageSource {
+	if mediaType, data, ok := types.SplitDataURL(imageUrl); ok {
+		return &imageSource{Type: "base64", MediaType: mediaType, Data: data}
+	}
+	return &imageSource{Type: "url", URL: imageUrl}
+}
+
+func mapResponse(resp messagesResponse) types.AIPIResponse {
+	content := ""
+	structured := ""
+	toolCalls := []types.ToolCall{}
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "tool_use":
+			if block.Name == structuredOutputTool {
+				structured = string(block.Input)
+				continue
+			}
+			toolCalls = append(toolCalls, types.ToolCall{ID: block.ID, Name: block.Name, Arguments: string(block.Input)})
+		case "text":
+			content += block.Text
+		}
+	}
+	if structured != "" {
+		content = structured
+	}
+
+	// Anthropic counts cached input separately; InputTokens includes it everywhere else.
+	return types.AIPIResponse{
+		Content:          content,
+		ToolCalls:        toolCalls,
+		InputTokens:      resp.Usage.InputTokens + resp.Usage.CacheCreationInputTokens + resp.Usage.CacheReadInputTokens,
+		OutputTokens:     resp.Usage.OutputTokens,
+		CacheReadTokens:  resp.Usage.CacheReadInputTokens,
+		CacheWriteTokens: resp.Usage.CacheCreationInputTokens,
+		Model:            resp.Model,
+	}
+}
@@ -0,0 +1,189 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SomtoJF/iris-worker/aipi/types"
+)
+
+func TestGetCompletion(t *testing.T) {
+	noParallel := false
+	tests := []struct {
+		name           string
+		req            types.AIPIRequest
+		status         int
+		retryAfter     string
+		body           string
+		check          func(t *testing.T, sent messagesRequest)
+		want           types.AIPIResponse
+		wantErr        int
+		wantRetryAfter time.Duration
+	}{
+		{
+			name:   "text response",
+			req:    types.AIPIRequest{Model: "claude-sonnet-4-5", SystemMessage: "be brief", UserMessage: "hi"},
+			status: http.StatusOK,
+			body: `{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"hello"}],` +
+				`"usage":{"input_tokens":10,"output_tokens":3,"cache_creation_input_tokens":4,"cache_read_input_tokens":6}}`,
+			check: func(t *testing.T, sent messagesRequest) {
+				if len(sent.System) != 1 || sent.System[0].Text != "be brief" {
+					t.Errorf("system = %+v, want the system message", sent.System)
+				}
+				if len(sent.Messages) != 1 || sent.Messages[0].Role != "user" || sent.Messages[0].Content[0].Text != "hi" {
+					t.Errorf("messages = %+v", sent.Messages)
+				}
+				if sent.MaxTokens != defaultMaxTokens || sent.Tools != nil {
+					t.Errorf("max tokens = %d, tools = %+v", sent.MaxTokens, sent.Tools)
+				}
+			},
+			want: types.AIPIResponse{
+				Content:          "hello",
+				ToolCalls:        []types.ToolCall{},
+				InputTokens:      20,
+				OutputTokens:     3,
+				CacheReadTokens:  6,
+				CacheWriteTokens: 4,
+				Model:            "claude-sonnet-4-5",
+			},
+		},
+		{
+			name: "response schema",
+			req: types.AIPIRequest{
+				Model:          "claude-sonnet-4-5",
+				UserMessage:    "extract",
+				ResponseSchema: map[string]interface{}{"type": "object"},
+			},
+			status: http.StatusOK,
+			body:   `{"model":"claude-sonnet-4-5","content":[{"type":"tool_use","id":"t1","name":"respond","input":{"name":"Jane"}}]}`,
+			check: func(t *testing.T, sent messagesRequest) {
+				if len(sent.Tools) != 1 || sent.Tools[0].Name != structuredOutputTool {
+					t.Errorf("tools = %+v, want only the respond tool", sent.Tools)
+				}
+				if sent.ToolChoice == nil || sent.ToolChoice.Type != "tool" || sent.ToolChoice.Name != structuredOutputTool {
+					t.Errorf("tool choice = %+v, want the respond tool forced", sent.ToolChoice)
+				}
+			},
+			want: types.AIPIResponse{Content: `{"name":"Jane"}`, ToolCalls: []types.ToolCall{}, Model: "claude-sonnet-4-5"},
+		},
+		{
+			name: "tool calls",
+			req: types.AIPIRequest{
+				Model: "claude-sonnet-4-5",
+				Messages: []types.Message{
+					{Role: types.MessageRoleUser, Parts: []types.ContentPart{types.TextPart("apply")}},
+					{Role: types.MessageRoleAssistant, ToolCalls: []types.ToolCall{
+						{ID: "a", Name: "click", Arguments: `{"index":3}`},
+						{ID: "b", Name: "scroll"},
+					}},
+					{Role: types.MessageRoleTool, ToolCallID: "a", Parts: []types.ContentPart{types.TextPart("clicked")}},
+					{Role: types.MessageRoleTool, ToolCallID: "b", Parts: []types.ContentPart{types.TextPart("scrolled")}},
+				},
+				Tools:             []types.ToolDefinition{{Name: "click", Parameters: map[string]interface{}{"type": "object"}}, {Name: "scroll"}},
+				ToolChoice:        types.ToolChoiceRequired,
+				ParallelToolCalls: &noParallel,
+			},
+			status: http.StatusOK,
+			body: `{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"Typing the name."},` +
+				`{"type":"tool_use","id":"c","name":"type","input":{"index":4,"text":"Jane"}}]}`,
+			check: func(t *testing.T, sent messagesRequest) {
+				if len(sent.Tools) != 2 || sent.Tools[1].InputSchema["type"] != "object" {
+					t.Errorf("tools = %+v, want both, with a schema for the one without parameters", sent.Tools)
+				}
+				if choice := sent.ToolChoice; choice == nil || choice.Type != "any" || !choice.DisableParallelToolUse {
+					t.Errorf("tool choice = %+v, want any without parallel calls", choice)
+				}
+				if len(sent.Messages) != 3 {
+					t.Fatalf("messages = %+v, want the tool results merged into one user turn", sent.Messages)
+				}
+				calls := sent.Messages[1].Content
+				if len(calls) != 2 || calls[0].Type != "tool_use" || string(calls[0].Input) != `{"index":3}` || string(calls[1].Input) != "{}" {
+					t.Errorf("assistant content = %+v", calls)
+				}
+				results := sent.Messages[2]
+				if results.Role != "user" || len(results.Content) != 2 || results.Content[1].ToolUseID != "b" || results.Content[1].Content[0].Text != "scrolled" {
+					t.Errorf("tool results = %+v", results)
+				}
+			},
+			want: types.AIPIResponse{
+				Content:   "Typing the name.",
+				ToolCalls: []types.ToolCall{{ID: "c", Name: "type", Arguments: `{"index":4,"text":"Jane"}`}},
+				Model:     "claude-sonnet-4-5",
+			},
+		},
+		{
+			name:    "bad request",
+			req:     types.AIPIRequest{Model: "claude-sonnet-4-5", UserMessage: "hi"},
+			status:  http.StatusBadRequest,
+			body:    `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens is too large"}}`,
+			wantErr: http.StatusBadRequest,
+		},
+		{
+			name:           "rate limited",
+			req:            types.AIPIRequest{Model: "claude-sonnet-4-5", UserMessage: "hi"},
+			status:         http.StatusTooManyRequests,
+			retryAfter:     "20",
+			body:           `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`,
+			wantErr:        http.StatusTooManyRequests,
+			wantRetryAfter: 20 * time.Second,
+		},
+		{
+			name:    "overloaded",
+			req:     types.AIPIRequest{Model: "claude-sonnet-4-5", UserMessage: "hi"},
+			status:  529,
+			body:    `upstream overloaded`,
+			wantErr: 529,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent messagesRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/messages" {
+					t.Errorf("path = %s, want /messages", r.URL.Path)
+				}
+				if r.Header.Get("x-api-key") != "key" || r.Header.Get("anthropic-version") != apiVersion {
+					t.Errorf("headers = %v, want the api key and version", r.Header)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			resp, err := NewAnthropicProvider(server.URL, "key").GetCompletion(context.Background(), tt.req)
+			if tt.wantErr != 0 {
+				var providerErr *types.ProviderError
+				if !errors.As(err, &providerErr) || providerErr.StatusCode != tt.wantErr {
+					t.Fatalf("err = %v, want a provider error with status %d", err, tt.wantErr)
+				}
+				if providerErr.RetryAfter != tt.wantRetryAfter {
+					t.Errorf("retry after = %v, want %v", providerErr.RetryAfter, tt.wantRetryAfter)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetCompletion: %v", err)
+			}
+			if tt.check != nil {
+				tt.check(t, sent)
+			}
+			got, _ := json.Marshal(resp)
+			want, _ := json.Marshal(tt.want)
+			if string(got) != string(want) {
+				t.Errorf("response = %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package aipi
+
+import (
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breakerOutcome is what a request admitted by allow said about the model.
+type breakerOutcome int
+
+const (
+	// outcomeNone means the request ended without a verdict on the model, e.g.
+	// because the caller gave up or the request itself was bad.
+	outcomeNone breakerOutcome = iota
+	outcomeSuccess
+	outcomeFailure
+)
+
+// circuitBreaker stops sending requests to a model after too many consecutive
+// failures, then lets a single probe through once the cooldown has passed.
+type circuitBreaker struct {
+	mu                  sync.Mutex
+	state               breakerState
+	consecutiveFailures int
+	openedAt            time.Time
+	threshold           int
+	cooldown            time.Duration
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a request may be sent. An open breaker moves to half-open
+// after the cooldown and admits exactly one probe.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+// done ends a request allow admitted. Every admitted request must call it, so a
+// half-open probe that ends without a verdict hands its slot back instead of
+// leaving the breaker half-open for good.
+func (b *circuitBreaker) done(outcome breakerOutcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch outcome {
+	case outcomeSuccess:
+		b.state = breakerClosed
+		b.consecutiveFailures = 0
+	case outcomeFailure:
+		b.consecutiveFailures++
+		if b.state == breakerHalfOpen || b.consecutiveFailures >= b.threshold {
+			b.state = breakerOpen
+			b.openedAt = time.Now()
+		}
+	default:
+		// The cooldown has already passed, so the next request probes again.
+		if b.state == breakerHalfOpen {
+			b.state = breakerOpen
+		}
+	}
+}
+
+// breakerSet lazily creates one breaker per model.
+type breakerSet struct {
+	mu        sync.Mutex
+	breakers  map[string]*circuitBreaker
+	threshold int
+	cooldown  time.Duration
+}
+
+func newBreakerSet(threshold int, cooldown time.Duration) *breakerSet {
+	return &breakerSet{
+		breakers:  make(map[string]*circuitBreaker),
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+func (s *breakerSet) get(model string) *circuitBreaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	breaker, exists := s.breakers[model]
+	if !exists {
+		breaker = newCircuitBreaker(s.threshold, s.cooldown)
+		s.breakers[model] = breaker
+	}
+	return breaker
+}
@@ -0,0 +1,75 @@
+package aipi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SomtoJF/iris-worker/aipi/types"
+)
+
+func TestCircuitBreakerProbeWithoutVerdictFreesSlot(t *testing.T) {
+	breaker := newCircuitBreaker(1, 0)
+	if !breaker.allow() {
+		t.Fatal("closed breaker rejected a request")
+	}
+	breaker.done(outcomeFailure)
+
+	// The cooldown is zero, so the next request is the half-open probe.
+	if !breaker.allow() {
+		t.Fatal("breaker didn't admit a probe after the cooldown")
+	}
+	if breaker.allow() {
+		t.Fatal("half-open breaker admitted a second probe")
+	}
+	breaker.done(outcomeNone)
+
+	if !breaker.allow() {
+		t.Fatal("probe that ended without a verdict kept the breaker half-open")
+	}
+	breaker.done(outcomeSuccess)
+	if !breaker.allow() || !breaker.allow() {
+		t.Fatal("successful probe didn't close the breaker")
+	}
+}
+
+func TestCircuitBreakerFailedProbeReopens(t *testing.T) {
+	breaker := newCircuitBreaker(1, time.Hour)
+	breaker.allow()
+	breaker.done(outcomeFailure)
+	if breaker.allow() {
+		t.Fatal("open breaker admitted a request during the cooldown")
+	}
+}
+
+// failingAIPI answers every request with the same provider status.
+type failingAIPI int
+
+func (status failingAIPI) GetCompletion(ctx context.Context, req types.AIPIRequest) (types.AIPIResponse, error) {
+	return types.AIPIResponse{}, &types.ProviderError{StatusCode: int(status), Err: errors.New(http.StatusText(int(status)))}
+}
+
+func TestClientBreakerIgnoresRateLimits(t *testing.T) {
+	tests := []struct {
+		status   int
+		wantOpen bool
+	}{
+		{status: http.StatusTooManyRequests, wantOpen: false},
+		{status: http.StatusServiceUnavailable, wantOpen: true},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			client := NewAIPIClient(nil, nil, Config{BreakerThreshold: 1, BreakerCooldown: time.Hour})
+			client.RegisterProvider("fake", failingAIPI(tt.status))
+
+			if _, err := client.GetCompletion(context.Background(), types.AIPIRequest{Model: "fake:m"}); err == nil {
+				t.Fatal("GetCompletion succeeded")
+			}
+			if open := !client.breakers.get("fake:m").allow(); open != tt.wantOpen {
+				t.Errorf("breaker open = %v, want %v", open, tt.wantOpen)
+			}
+		})
+	}
+}
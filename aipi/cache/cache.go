@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/SomtoJF/iris-worker/aipi/types"
+)
+
+// CachedAIPI serves repeated deterministic requests from disk instead of paying
+// the provider again. Entries are keyed by a hash of the normalized request, which
+// includes inline image bytes, so the same prompt on a different screenshot misses.
+type CachedAIPI struct {
+	next  types.AIPI
+	dir   string
+	ttl   time.Duration
+	stats Stats
+}
+
+type Stats struct {
+	Hits     atomic.Int64
+	Misses   atomic.Int64
+	Bypassed atomic.Int64
+}
+
+type entry struct {
+	StoredAt time.Time          `json:"stored_at"`
+	Response types.AIPIResponse `json:"response"`
+}
+
+func NewCachedAIPI(next types.AIPI, dir string, ttl time.Duration) (*CachedAIPI, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create llm cache dir: %w", err)
+	}
+	return &CachedAIPI{next: next, dir: dir, ttl: ttl}, nil
+}
+
+func (c *CachedAIPI) GetCompletion(ctx context.Context, req types.AIPIRequest) (types.AIPIResponse, error) {
+	return c.complete(ctx, req, nil)
+}
+
+// StreamCompletion streams misses from the wrapped client. A hit is delivered to
+// onDelta as a single fragment.
+func (c *CachedAIPI) StreamCompletion(ctx context.Context, req types.AIPIRequest, onDelta types.StreamHandler) (types.AIPIResponse, error) {
+	return c.complete(ctx, req, onDelta)
+}
+
+func (c *CachedAIPI) complete(ctx context.Context, req types.AIPIRequest, onDelta types.StreamHandler) (types.AIPIResponse, error) {
+	if !isCacheable(req) {
+		c.stats.Bypassed.Add(1)
+		return types.Complete(ctx, c.next, req, onDelta)
+	}
+
+	key, err := cacheKey(req)
+	if err != nil {
+		return types.AIPIResponse{}, err
+	}
+
+	if resp, ok := c.load(key); ok {
+		c.stats.Hits.Add(1)
+		if onDelta != nil && resp.Content != "" {
+			onDelta(resp.Content)
+		}
+		return resp, nil
+	}
+	c.stats.Misses.Add(1)
+
+	resp, err := types.Complete(ctx, c.next, req, onDelta)
+	if err != nil {
+		return types.AIPIResponse{}, err
+	}
+
+	if err := c.store(key, resp); err != nil {
+		log.Println("failed to store llm cache entry:", err)
+	}
+
+	return resp, nil
+}
+
+func (c *CachedAIPI) Stats() *Stats {
+	return &c.stats
+}
+
+// isCacheable only admits requests whose answer should not change between calls.
+func isCacheable(req types.AIPIRequest) bool {
+	return !req.BypassCache && req.Temperature != nil && *req.Temperature == 0
+}
+
+func cacheKey(req types.AIPIRequest) (string, error) {
+	normalized := req
+	normalized.SystemMessage = strings.TrimSpace(req.SystemMessage)
+	normalized.UserMessage = strings.TrimSpace(req.UserMessage)
+	// These only steer routing and caching, not what the model is asked.
+	normalized.UseCase = ""
+	normalized.BypassCache = false
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash llm request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (c *CachedAIPI) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+func (c *CachedAIPI) load(key string) (types.AIPIResponse, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Println("failed to read llm cache entry:", err)
+		}
+		return types.AIPIResponse{}, false
+	}
+
+	// A corrupt entry would miss forever, so it makes way for a fresh one.
+	var cached entry
+	if err := json.Unmarshal(data, &cached); err != nil {
+		log.Println("removing corrupt llm cache entry:", err)
+		os.Remove(c.path(key))
+		return types.AIPIResponse{}, false
+	}
+
+	if c.ttl > 0 && time.Since(cached.StoredAt) > c.ttl {
+		os.Remove(c.path(key))
+		return types.AIPIResponse{}, false
+	}
+
+	resp := cached.Response
+	resp.Cached = true
+	resp.QueueTime = 0
+	resp.InputCost = 0
+	resp.OutputCost = 0
+	resp.TotalCost = 0
+	return resp, true
+}
+
+func (c *CachedAIPI) store(key string, resp types.AIPIResponse) error {
+	data, err := json.Marshal(entry{StoredAt: time.Now(), Response: resp})
+	if err != nil {
+		return err
+	}
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Write then rename so concurrent readers never see a partial entry.
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Sweep removes entries older than the TTL, and temp files left behind by
+// interrupted writes, which reads alone would never clean up. It goes by file
+// modification time, which is when an entry was stored. A cache without a TTL
+// keeps everything.
+func (c *CachedAIPI) Sweep(ctx context.Context) (int, error) {
+	if c.ttl <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-c.ttl)
+	removed := 0
+	err := filepath.WalkDir(c.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(cutoff) {
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("failed to sweep llm cache: %w", err)
+	}
+	return removed, nil
+}
+
+// StartSweeping sweeps right away and then every interval until ctx is done.
+func (c *CachedAIPI) StartSweeping(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			removed, err := c.Sweep(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Println(err)
+			} else if removed > 0 {
+				log.Printf("llm cache: removed %d entries older than %s", removed, c.ttl)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
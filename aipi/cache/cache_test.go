@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SomtoJF/iris-worker/aipi/aipitest"
+	"github.com/SomtoJF/iris-worker/aipi/types"
+)
+
+func deterministic(prompt string) types.AIPIRequest {
+	zero := 0.0
+	return types.AIPIRequest{Model: "m", UserMessage: prompt, Temperature: &zero}
+}
+
+func newTestCache(t *testing.T, ttl time.Duration, contents ...string) (*CachedAIPI, *aipitest.ScriptedAIPI) {
+	next := aipitest.Contents(contents...)
+	for i := range next.Responses {
+		next.Responses[i].TotalCost = 0.01
+	}
+	c, err := NewCachedAIPI(next, t.TempDir(), ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, next
+}
+
+func TestCacheHitAndMiss(t *testing.T) {
+	c, next := newTestCache(t, time.Hour, "first", "second", "uncached")
+	ctx := context.Background()
+
+	if resp, err := c.GetCompletion(ctx, deterministic("hi")); err != nil || resp.Content != "first" || resp.Cached {
+		t.Fatalf("first call = %+v, %v, want a fresh answer", resp, err)
+	}
+	// Surrounding whitespace doesn't change the question.
+	resp, err := c.GetCompletion(ctx, deterministic("  hi\n"))
+	if err != nil || resp.Content != "first" || !resp.Cached || resp.TotalCost != 0 {
+		t.Errorf("repeat = %+v, %v, want the cached answer at no cost", resp, err)
+	}
+	if resp, err := c.GetCompletion(ctx, deterministic("bye")); err != nil || resp.Content != "second" {
+		t.Errorf("other prompt = %+v, %v, want a miss", resp, err)
+	}
+	if resp, err := c.GetCompletion(ctx, types.AIPIRequest{Model: "m", UserMessage: "hi"}); err != nil || resp.Content != "uncached" {
+		t.Errorf("request without temperature 0 = %+v, %v, want it sent on", resp, err)
+	}
+
+	stats := c.Stats()
+	if hits, misses, bypassed := stats.Hits.Load(), stats.Misses.Load(), stats.Bypassed.Load(); hits != 1 || misses != 2 || bypassed != 1 {
+		t.Errorf("stats = %d hits, %d misses, %d bypassed, want 1, 2, 1", hits, misses, bypassed)
+	}
+	if calls := len(next.Requests()); calls != 3 {
+		t.Errorf("made %d calls, want 3", calls)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c, _ := newTestCache(t, time.Hour, "stale", "fresh")
+	ctx := context.Background()
+	req := deterministic("hi")
+	if _, err := c.GetCompletion(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := cacheKey(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(entry{StoredAt: time.Now().Add(-2 * time.Hour), Response: types.AIPIResponse{Content: "stale"}})
+	if err := os.WriteFile(c.path(key), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, err := c.GetCompletion(ctx, req); err != nil || resp.Content != "fresh" || resp.Cached {
+		t.Errorf("after the ttl = %+v, %v, want a fresh answer", resp, err)
+	}
+}
+
+func TestCacheCorruptEntry(t *testing.T) {
+	c, _ := newTestCache(t, time.Hour, "first", "second")
+	ctx := context.Background()
+	req := deterministic("hi")
+	if _, err := c.GetCompletion(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := cacheKey(req)
+	if err := os.WriteFile(c.path(key), []byte(`{"stored_at":`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := c.GetCompletion(ctx, req); err != nil || resp.Content != "second" {
+		t.Fatalf("corrupt entry = %+v, %v, want a miss", resp, err)
+	}
+	if resp, err := c.GetCompletion(ctx, req); err != nil || resp.Content != "second" || !resp.Cached {
+		t.Errorf("after a corrupt entry = %+v, %v, want it replaced by the new answer", resp, err)
+	}
+}
+
+func TestCacheSweep(t *testing.T) {
+	c, _ := newTestCache(t, time.Hour, "old", "new")
+	ctx := context.Background()
+	for _, prompt := range []string{"old", "new"} {
+		if _, err := c.GetCompletion(ctx, deterministic(prompt)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldKey, _ := cacheKey(deterministic("old"))
+	newKey, _ := cacheKey(deterministic("new"))
+	leftover := filepath.Join(c.dir, newKey[:2], newKey+".123.tmp")
+	if err := os.WriteFile(leftover, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-2 * time.Hour)
+	for _, path := range []string{c.path(oldKey), leftover} {
+		if err := os.Chtimes(path, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := c.Sweep(ctx)
+	if err != nil {
+		t.Fatalf("Sweep: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("removed %d files, want the old entry and the leftover temp file", removed)
+	}
+	for path, want := range map[string]bool{c.path(oldKey): false, leftover: false, c.path(newKey): true} {
+		if _, err := os.Stat(path); (err == nil) != want {
+			t.Errorf("%s exists = %v, want %v", filepath.Base(path), err == nil, want)
+		}
+	}
+
+	forever, _ := newTestCache(t, 0)
+	if removed, err := forever.Sweep(ctx); err != nil || removed != 0 {
+		t.Errorf("Sweep without a ttl = %d, %v, want nothing removed", removed, err)
+	}
+}
@@ -2,22 +2,270 @@ package aipi
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
 	localOpenRouter "github.com/SomtoJF/iris-worker/aipi/openrouter"
+	"github.com/SomtoJF/iris-worker/aipi/pricing"
 	"github.com/SomtoJF/iris-worker/aipi/types"
 	openrouter "github.com/revrost/go-openrouter"
 )
 
+// Provider names double as model prefixes: "ollama:llama3.2-vision" is sent to the
+// Ollama provider as "llama3.2-vision". Unprefixed models go to OpenRouter.
+const (
+	ProviderOpenRouter       = "openrouter"
+	ProviderOpenAICompatible = "openai-compatible"
+	ProviderAnthropic        = "anthropic"
+	ProviderOllama           = "ollama"
+)
+
+type Config struct {
+	// ModelProviders routes specific models to a provider by name, for models whose
+	// names can't carry a prefix.
+	ModelProviders map[string]string
+	// FallbackChains lists the models to try, in order, after the requested model
+	// fails with a transient error.
+	FallbackChains map[types.UseCase][]string
+	// BreakerThreshold is the number of consecutive failures that opens a model's breaker.
+	// Rate limits are left to the limiter and don't count.
+	BreakerThreshold int
+	// BreakerCooldown is how long an open breaker rejects requests before probing again.
+	BreakerCooldown time.Duration
+	// AttemptTimeout bounds a single model attempt so a hung provider falls through
+	// to the next model. Zero leaves attempts bounded only by the caller's context.
+	AttemptTimeout time.Duration
+	// RateLimits caps requests and tokens per minute. Keys are provider names, such
+	// as "openrouter", or full model names, such as "google/gemini-2.5-flash". A
+	// request waits for both its provider's and its model's limit.
+	RateLimits map[string]RateLimit
+}
+
+// DefaultAttemptTimeout is the AttemptTimeout of DefaultConfig.
+const DefaultAttemptTimeout = 2 * time.Minute
+
+// defaultRateLimitPause holds a model back after a 429 that came without a
+// Retry-After hint.
+const defaultRateLimitPause = 10 * time.Second
+
+func DefaultConfig() Config {
+	return Config{
+		FallbackChains: map[types.UseCase][]string{
+			types.UseCasePlanner:    {"google/gemini-2.5-flash", "openai/gpt-5-mini"},
+			types.UseCaseExtraction: {"google/gemini-2.5-flash-lite", "openai/gpt-4o-mini"},
+			types.UseCaseWriting:    {"google/gemini-2.5-flash", "deepseek/deepseek-chat"},
+		},
+		BreakerThreshold: 3,
+		BreakerCooldown:  time.Minute,
+		AttemptTimeout:   DefaultAttemptTimeout,
+	}
+}
+
 type AIPIClient struct {
-	openRouterClient *localOpenRouter.OpenRouterProvider
+	providers map[string]types.AIPI
+	config    Config
+	breakers  *breakerSet
+	limiter   *rateLimiter
+	pricing   *pricing.Registry
 }
 
-func NewAIPIClient(openRouterClient *openrouter.Client) *AIPIClient {
+func NewAIPIClient(openRouterClient *openrouter.Client, registry *pricing.Registry, config Config) *AIPIClient {
 	return &AIPIClient{
-		openRouterClient: localOpenRouter.NewOpenRouterProvider(openRouterClient),
+		providers: map[string]types.AIPI{
+			ProviderOpenRouter: localOpenRouter.NewOpenRouterProvider(openRouterClient, registry),
+		},
+		config:   config,
+		breakers: newBreakerSet(config.BreakerThreshold, config.BreakerCooldown),
+		limiter:  newRateLimiter(config.RateLimits),
+		pricing:  registry,
 	}
 }
 
+// Pricing returns the registry used to price responses and look up context windows.
+func (c *AIPIClient) Pricing() *pricing.Registry {
+	return c.pricing
+}
+
+// RegisterProvider makes a provider reachable through the "<name>:" model prefix.
+// It must be called before the client starts serving requests.
+func (c *AIPIClient) RegisterProvider(name string, provider types.AIPI) {
+	c.providers[name] = provider
+}
+
 func (c *AIPIClient) GetCompletion(ctx context.Context, req types.AIPIRequest) (types.AIPIResponse, error) {
-	return c.openRouterClient.GetCompletion(ctx, req)
+	return c.complete(ctx, req, nil)
+}
+
+// StreamCompletion is GetCompletion with output fragments passed to onDelta as they
+// arrive. Providers that cannot stream answer in one piece without calling onDelta,
+// and a fallback model may follow fragments already delivered by a failed attempt.
+func (c *AIPIClient) StreamCompletion(ctx context.Context, req types.AIPIRequest, onDelta types.StreamHandler) (types.AIPIResponse, error) {
+	return c.complete(ctx, req, onDelta)
+}
+
+func (c *AIPIClient) complete(ctx context.Context, req types.AIPIRequest, onDelta types.StreamHandler) (types.AIPIResponse, error) {
+	var errs []error
+	var queueTime time.Duration
+	for _, model := range c.modelChain(req) {
+		resp, fallback, err := c.tryModel(ctx, req, model, onDelta, &queueTime)
+		if !fallback {
+			return resp, err
+		}
+		errs = append(errs, err)
+	}
+
+	return types.AIPIResponse{}, fmt.Errorf("all models failed: %w", errors.Join(errs...))
+}
+
+// tryModel sends req to model, unless its breaker is open. fallback reports that
+// the next model in the chain should be tried; otherwise resp and err are final.
+// queueTime accumulates the time spent waiting for the rate limiter.
+func (c *AIPIClient) tryModel(ctx context.Context, req types.AIPIRequest, model string, onDelta types.StreamHandler, queueTime *time.Duration) (resp types.AIPIResponse, fallback bool, err error) {
+	breaker := c.breakers.get(model)
+	if !breaker.allow() {
+		return types.AIPIResponse{}, true, fmt.Errorf("%s: circuit open", model)
+	}
+	outcome := outcomeNone
+	defer func() { breaker.done(outcome) }()
+
+	attempt := req
+	attempt.Model = model
+
+	// Queueing happens before the attempt timeout starts, so a long wait for the
+	// limiter doesn't count against the provider.
+	provider, _ := c.route(model)
+	estimated := EstimateRequestTokens(attempt)
+	queued, err := c.limiter.wait(ctx, provider, model, estimated)
+	*queueTime += queued
+	if err != nil {
+		return types.AIPIResponse{}, false, fmt.Errorf("waiting for rate limit on %s: %w", model, err)
+	}
+
+	resp, err = c.attempt(ctx, attempt, onDelta)
+	if err == nil {
+		outcome = outcomeSuccess
+		c.limiter.record(provider, model, estimated, resp.InputTokens+resp.OutputTokens)
+		resp.RequestedModel = req.Model
+		resp.QueueTime = *queueTime
+		return resp, false, nil
+	}
+
+	rateLimited := types.StatusCode(err) == http.StatusTooManyRequests
+	if rateLimited {
+		pause := types.RetryAfter(err)
+		if pause <= 0 {
+			pause = defaultRateLimitPause
+		}
+		c.limiter.pause(model, pause)
+	}
+
+	if !shouldFallback(ctx, err) {
+		return types.AIPIResponse{}, false, err
+	}
+	// A rate limit says nothing about the model's health, and the limiter's pause
+	// already holds requests back, so it doesn't count towards opening the breaker.
+	if !rateLimited {
+		outcome = outcomeFailure
+	}
+	return types.AIPIResponse{}, true, fmt.Errorf("%s: %w", model, err)
+}
+
+func (c *AIPIClient) attempt(ctx context.Context, req types.AIPIRequest, onDelta types.StreamHandler) (types.AIPIResponse, error) {
+	if c.config.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.AttemptTimeout)
+		defer cancel()
+	}
+
+	name, model := c.route(req.Model)
+	provider, exists := c.providers[name]
+	if !exists {
+		return types.AIPIResponse{}, &types.ProviderError{
+			StatusCode: http.StatusBadRequest,
+			Err:        fmt.Errorf("no provider registered for %s", req.Model),
+		}
+	}
+
+	routed := req
+	routed.Model = model
+	resp, err := types.Complete(ctx, provider, routed, onDelta)
+	if err != nil {
+		return types.AIPIResponse{}, err
+	}
+
+	// Keep the prefix on the answering model so it can be routed again, e.g. for pricing.
+	switch {
+	case resp.Model == "":
+		resp.Model = req.Model
+	case name != ProviderOpenRouter:
+		resp.Model = name + ":" + resp.Model
+	}
+
+	// Other providers don't report cost; price them from overrides when present.
+	if resp.TotalCost == 0 && c.pricing != nil {
+		usage := pricing.Usage{
+			Input:      resp.InputTokens,
+			Output:     resp.OutputTokens,
+			CacheRead:  resp.CacheReadTokens,
+			CacheWrite: resp.CacheWriteTokens,
+		}
+		if inputCost, outputCost, ok := c.pricing.Costs(resp.Model, usage); ok {
+			resp.InputCost = inputCost
+			resp.OutputCost = outputCost
+			resp.TotalCost = inputCost + outputCost
+		}
+	}
+	return resp, nil
+}
+
+// route picks the provider for a model and strips any provider prefix from it.
+func (c *AIPIClient) route(model string) (string, string) {
+	if name, exists := c.config.ModelProviders[model]; exists {
+		return name, model
+	}
+	if prefix, rest, found := strings.Cut(model, ":"); found {
+		if _, exists := c.providers[prefix]; exists {
+			return prefix, rest
+		}
+	}
+	return ProviderOpenRouter, model
+}
+
+// modelChain returns the requested model followed by the use case's fallbacks,
+// without duplicates.
+func (c *AIPIClient) modelChain(req types.AIPIRequest) []string {
+	chain := []string{}
+	seen := map[string]bool{}
+	for _, model := range append([]string{req.Model}, c.config.FallbackChains[req.UseCase]...) {
+		if model == "" || seen[model] {
+			continue
+		}
+		seen[model] = true
+		chain = append(chain, model)
+	}
+	return chain
+}
+
+// shouldFallback separates provider trouble (rate limits, 5xx, timeouts, dropped
+// connections) from errors that every model would return for the same request,
+// such as bad auth or a rejected schema.
+func shouldFallback(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	status := types.StatusCode(err)
+	switch {
+	case status == http.StatusTooManyRequests || status == http.StatusRequestTimeout:
+		return true
+	case status >= http.StatusInternalServerError:
+		return true
+	case status >= http.StatusBadRequest:
+		return false
+	}
+
+	return true
 }
@@ -0,0 +1,250 @@
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/SomtoJF/iris-worker/aipi/types"
+)
+
+const defaultBaseURL = "http://localhost:11434"
+
+type OllamaProvider struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+func NewOllamaProvider(baseURL string) *OllamaProvider {
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	return &OllamaProvider{
+		baseURL:    baseURL,
+		httpClient: &http.Client{},
+	}
+}
+
+type chatRequest struct {
+	Model    string                 `json:"model"`
+	Messages []message              `json:"messages"`
+	Stream   bool                   `json:"stream"`
+	Format   map[string]interface{} `json:"format,omitempty"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+	Tools    []tool                 `json:"tools,omitempty"`
+}
+
+type message struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	Images    []string   `json:"images,omitempty"`
+	ToolCalls []toolCall `json:"tool_calls,omitempty"`
+	// ToolName names the tool a tool turn answers; Ollama has no call ids.
+	ToolName string `json:"tool_name,omitempty"`
+}
+
+type tool struct {
+	Type     string       `json:"type"`
+	Function toolFunction `json:"function"`
+}
+
+type toolFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+type toolCall struct {
+	ID       string `json:"id,omitempty"`
+	Function struct {
+		Name string `json:"name"`
+		// Arguments is a JSON object, not a string as in the OpenAI API.
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type chatResponse struct {
+	Model           string  `json:"model"`
+	Message         message `json:"message"`
+	PromptEvalCount int     `json:"prompt_eval_count"`
+	EvalCount       int     `json:"eval_count"`
+}
+
+func (p *OllamaProvider) GetCompletion(ctx context.Context, req types.AIPIRequest) (types.AIPIResponse, error) {
+	messages, err := p.buildMessages(ctx, req)
+	if err != nil {
+		return types.AIPIResponse{}, err
+	}
+
+	body := chatRequest{
+		Model:    req.Model,
+		Messages: messages,
+		Format:   req.ResponseSchema,
+		Options:  map[string]interface{}{},
+	}
+
+	if req.MaxTokens != nil {
+		body.Options["num_predict"] = *req.MaxTokens
+	}
+
+	if req.Temperature != nil {
+		body.Options["temperature"] = *req.Temperature
+	}
+
+	// Ollama has no tool_choice: the model decides whether to call a tool, and
+	// "none" is honoured by not offering any. "required" and a named tool are
+	// downgraded to "auto", so the answer may come back without a tool call and
+	// callers that need one must check ToolCalls, as the planner does.
+	if len(req.Tools) > 0 && req.ToolChoice != types.ToolChoiceNone {
+		body.Tools = buildTools(req.Tools)
+	}
+
+	var resp chatResponse
+	if err := p.post(ctx, "/api/chat", body, &resp); err != nil {
+		return types.AIPIResponse{}, fmt.Errorf("ollama api call failed: %w", err)
+	}
+
+	return types.AIPIResponse{
+		Content:      resp.Message.Content,
+		ToolCalls:    mapToolCalls(resp.Message.ToolCalls),
+		InputTokens:  resp.PromptEvalCount,
+		OutputTokens: resp.EvalCount,
+		Model:        resp.Model,
+	}, nil
+}
+
+func (p *OllamaProvider) post(ctx context.Context, path string, body interface{}, v interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	res, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		raw, _ := io.ReadAll(res.Body)
+		return &types.ProviderError{
+			StatusCode: res.StatusCode,
+			RetryAfter: types.ParseRetryAfter(res.Header.Get("Retry-After")),
+			Err:        fmt.Errorf("%s", raw),
+		}
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func (p *OllamaProvider) buildMessages(ctx context.Context, req types.AIPIRequest) ([]message, error) {
+	messages := []message{}
+	// Tool turns are tied to calls by id, which Ollama doesn't know; it wants the
+	// tool's name instead.
+	toolNames := map[string]string{}
+
+	for _, msg := range req.AllMessages() {
+		mapped := message{Role: string(msg.Role), Content: msg.Text()}
+		for _, call := range msg.ToolCalls {
+			toolNames[call.ID] = call.Name
+			mapped.ToolCalls = append(mapped.ToolCalls, buildToolCall(call))
+		}
+		if msg.Role == types.MessageRoleTool {
+			mapped.ToolName = toolNames[msg.ToolCallID]
+		}
+		for _, part := range msg.Parts {
+			if part.Type != types.ContentPartTypeImage {
+				continue
+			}
+			image, err := p.loadImage(ctx, part.ImageUrl)
+			if err != nil {
+				return nil, err
+			}
+			mapped.Images = append(mapped.Images, image)
+		}
+		messages = append(messages, mapped)
+	}
+
+	return messages, nil
+}
+
+func buildTools(tools []types.ToolDefinition) []tool {
+	mapped := make([]tool, len(tools))
+	for i, definition := range tools {
+		mapped[i] = tool{
+			Type: "function",
+			Function: toolFunction{
+				Name:        definition.Name,
+				Description: definition.Description,
+				Parameters:  definition.Parameters,
+			},
+		}
+	}
+	return mapped
+}
+
+func buildToolCall(call types.ToolCall) toolCall {
+	var mapped toolCall
+	mapped.ID = call.ID
+	mapped.Function.Name = call.Name
+	mapped.Function.Arguments = json.RawMessage("{}")
+	if call.Arguments != "" && json.Valid([]byte(call.Arguments)) {
+		mapped.Function.Arguments = json.RawMessage(call.Arguments)
+	}
+	return mapped
+}
+
+// mapToolCalls turns Ollama's calls into ours. Older Ollama versions don't id
+// their calls, so those are numbered in order.
+func mapToolCalls(calls []toolCall) []types.ToolCall {
+	mapped := []types.ToolCall{}
+	for i, call := range calls {
+		id := call.ID
+		if id == "" {
+			id = fmt.Sprintf("call_%d", i)
+		}
+		arguments := string(call.Function.Arguments)
+		if arguments == "" || arguments == "null" {
+			arguments = "{}"
+		}
+		mapped = append(mapped, types.ToolCall{ID: id, Name: call.Function.Name, Arguments: arguments})
+	}
+	return mapped
+}
+
+// loadImage returns the image as bare base64, which is the only form Ollama accepts.
+func (p *OllamaProvider) loadImage(ctx context.Context, imageUrl string) (string, error) {
+	if _, data, ok := types.SplitDataURL(imageUrl); ok {
+		return data, nil
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, imageUrl, nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch image %s: %w", imageUrl, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return "", fmt.Errorf("failed to fetch image %s: status %d", imageUrl, res.StatusCode)
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
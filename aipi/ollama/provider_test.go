@@ -0,0 +1,137 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SomtoJF/iris-worker/aipi/types"
+)
+
+func TestGetCompletion(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     types.AIPIRequest
+		status  int
+		body    string
+		check   func(t *testing.T, sent chatRequest)
+		want    types.AIPIResponse
+		wantErr int
+	}{
+		{
+			name:   "text response",
+			req:    types.AIPIRequest{Model: "llama3", SystemMessage: "be brief", UserMessage: "hi"},
+			status: http.StatusOK,
+			body:   `{"model":"llama3","message":{"role":"assistant","content":"hello"},"prompt_eval_count":12,"eval_count":3}`,
+			check: func(t *testing.T, sent chatRequest) {
+				if len(sent.Messages) != 2 || sent.Messages[0].Role != "system" || sent.Messages[1].Content != "hi" {
+					t.Errorf("messages = %+v", sent.Messages)
+				}
+				if sent.Stream {
+					t.Error("request asked for a stream")
+				}
+			},
+			want: types.AIPIResponse{Content: "hello", ToolCalls: []types.ToolCall{}, InputTokens: 12, OutputTokens: 3, Model: "llama3"},
+		},
+		{
+			name: "json response",
+			req: types.AIPIRequest{
+				Model:          "llama3",
+				UserMessage:    "extract",
+				ResponseSchema: map[string]interface{}{"type": "object"},
+			},
+			status: http.StatusOK,
+			body:   `{"model":"llama3","message":{"role":"assistant","content":"{\"name\":\"Jane\"}"}}`,
+			check: func(t *testing.T, sent chatRequest) {
+				if sent.Format["type"] != "object" {
+					t.Errorf("format = %v, want the response schema", sent.Format)
+				}
+			},
+			want: types.AIPIResponse{Content: `{"name":"Jane"}`, ToolCalls: []types.ToolCall{}, Model: "llama3"},
+		},
+		{
+			name: "tool calls",
+			req: types.AIPIRequest{
+				Model: "llama3",
+				Messages: []types.Message{
+					{Role: types.MessageRoleUser, Parts: []types.ContentPart{types.TextPart("apply")}},
+					{Role: types.MessageRoleAssistant, ToolCalls: []types.ToolCall{{ID: "a", Name: "click", Arguments: `{"index":3}`}}},
+					{Role: types.MessageRoleTool, ToolCallID: "a", Parts: []types.ContentPart{types.TextPart("clicked")}},
+				},
+				Tools: []types.ToolDefinition{{Name: "click", Parameters: map[string]interface{}{"type": "object"}}},
+			},
+			status: http.StatusOK,
+			body:   `{"model":"llama3","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"type","arguments":{"index":4,"text":"Jane"}}}]}}`,
+			check: func(t *testing.T, sent chatRequest) {
+				if len(sent.Tools) != 1 || sent.Tools[0].Type != "function" || sent.Tools[0].Function.Name != "click" {
+					t.Errorf("tools = %+v", sent.Tools)
+				}
+				calls := sent.Messages[1].ToolCalls
+				if len(calls) != 1 || calls[0].Function.Name != "click" || string(calls[0].Function.Arguments) != `{"index":3}` {
+					t.Errorf("assistant tool calls = %+v", calls)
+				}
+				if sent.Messages[2].Role != "tool" || sent.Messages[2].ToolName != "click" {
+					t.Errorf("tool turn = %+v, want it named after the call it answers", sent.Messages[2])
+				}
+			},
+			want: types.AIPIResponse{
+				ToolCalls: []types.ToolCall{{ID: "call_0", Name: "type", Arguments: `{"index":4,"text":"Jane"}`}},
+				Model:     "llama3",
+			},
+		},
+		{
+			name:    "bad request",
+			req:     types.AIPIRequest{Model: "missing", UserMessage: "hi"},
+			status:  http.StatusNotFound,
+			body:    `{"error":"model \"missing\" not found"}`,
+			wantErr: http.StatusNotFound,
+		},
+		{
+			name:    "server error",
+			req:     types.AIPIRequest{Model: "llama3", UserMessage: "hi"},
+			status:  http.StatusServiceUnavailable,
+			body:    `{"error":"server busy"}`,
+			wantErr: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent chatRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/chat" {
+					t.Errorf("path = %s, want /api/chat", r.URL.Path)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			resp, err := NewOllamaProvider(server.URL).GetCompletion(context.Background(), tt.req)
+			if tt.wantErr != 0 {
+				var providerErr *types.ProviderError
+				if !errors.As(err, &providerErr) || providerErr.StatusCode != tt.wantErr {
+					t.Fatalf("err = %v, want a provider error with status %d", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetCompletion: %v", err)
+			}
+			if tt.check != nil {
+				tt.check(t, sent)
+			}
+			got, _ := json.Marshal(resp)
+			want, _ := json.Marshal(tt.want)
+			if string(got) != string(want) {
+				t.Errorf("response = %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package openaicompat
+
+import (
+	localOpenRouter "github.com/SomtoJF/iris-worker/aipi/openrouter"
+	openrouter "github.com/revrost/go-openrouter"
+)
+
+// OpenAICompatibleProvider talks to any server that implements the OpenAI chat
+// completions API, such as vLLM, llama.cpp server or LM Studio. OpenRouter speaks
+// the same protocol, so it reuses the OpenRouter provider pointed at another base url.
+// Its models are priced by AIPIClient from pricing overrides, if at all.
+type OpenAICompatibleProvider struct {
+	*localOpenRouter.OpenRouterProvider
+}
+
+func NewOpenAICompatibleProvider(baseURL, apiKey string) *OpenAICompatibleProvider {
+	config := openrouter.DefaultConfig(apiKey)
+	config.BaseURL = baseURL
+	return &OpenAICompatibleProvider{
+		OpenRouterProvider: localOpenRouter.NewOpenRouterProvider(localOpenRouter.NewClient(config), nil),
+	}
+}
@@ -0,0 +1,151 @@
+package openaicompat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SomtoJF/iris-worker/aipi/types"
+)
+
+func TestGetCompletion(t *testing.T) {
+	tests := []struct {
+		name           string
+		req            types.AIPIRequest
+		status         int
+		retryAfter     string
+		body           string
+		check          func(t *testing.T, sent map[string]interface{})
+		want           types.AIPIResponse
+		wantErr        int
+		wantRetryAfter time.Duration
+	}{
+		{
+			name:   "text response",
+			req:    types.AIPIRequest{Model: "qwen2.5", SystemMessage: "be brief", UserMessage: "hi"},
+			status: http.StatusOK,
+			body: `{"model":"qwen2.5","choices":[{"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],` +
+				`"usage":{"prompt_tokens":12,"completion_tokens":3}}`,
+			check: func(t *testing.T, sent map[string]interface{}) {
+				messages, _ := sent["messages"].([]interface{})
+				if sent["model"] != "qwen2.5" || len(messages) != 2 {
+					t.Errorf("request = %v, want the model and both messages", sent)
+				}
+				if _, hasTools := sent["tools"]; hasTools {
+					t.Errorf("tools = %v, want none", sent["tools"])
+				}
+			},
+			want: types.AIPIResponse{Content: "hello", ToolCalls: []types.ToolCall{}, InputTokens: 12, OutputTokens: 3, Model: "qwen2.5"},
+		},
+		{
+			name: "tool calls",
+			req: types.AIPIRequest{
+				Model: "qwen2.5",
+				Messages: []types.Message{
+					{Role: types.MessageRoleUser, Parts: []types.ContentPart{types.TextPart("apply")}},
+					{Role: types.MessageRoleAssistant, ToolCalls: []types.ToolCall{{ID: "a", Name: "click", Arguments: `{"index":3}`}}},
+					{Role: types.MessageRoleTool, ToolCallID: "a", Parts: []types.ContentPart{types.TextPart("clicked")}},
+				},
+				Tools:      []types.ToolDefinition{{Name: "click", Parameters: map[string]interface{}{"type": "object"}}},
+				ToolChoice: types.ToolChoiceRequired,
+			},
+			status: http.StatusOK,
+			body: `{"model":"qwen2.5","choices":[{"message":{"role":"assistant","content":"","tool_calls":[` +
+				`{"id":"b","type":"function","function":{"name":"type","arguments":"{\"index\":4,\"text\":\"Jane\"}"}}]},"finish_reason":"tool_calls"}]}`,
+			check: func(t *testing.T, sent map[string]interface{}) {
+				tools, _ := sent["tools"].([]interface{})
+				if len(tools) != 1 || sent["tool_choice"] != "required" {
+					t.Errorf("tools = %v, tool choice = %v", sent["tools"], sent["tool_choice"])
+				}
+				messages, _ := sent["messages"].([]interface{})
+				if len(messages) != 3 {
+					t.Fatalf("messages = %v", messages)
+				}
+				assistant, _ := messages[1].(map[string]interface{})
+				if calls, _ := assistant["tool_calls"].([]interface{}); len(calls) != 1 {
+					t.Errorf("assistant turn = %v, want its tool call", assistant)
+				}
+				if result, _ := messages[2].(map[string]interface{}); result["role"] != "tool" || result["tool_call_id"] != "a" {
+					t.Errorf("tool turn = %v, want it tied to the call it answers", result)
+				}
+			},
+			want: types.AIPIResponse{
+				ToolCalls: []types.ToolCall{{ID: "b", Name: "type", Arguments: `{"index":4,"text":"Jane"}`}},
+				Model:     "qwen2.5",
+			},
+		},
+		{
+			name:    "bad request",
+			req:     types.AIPIRequest{Model: "missing", UserMessage: "hi"},
+			status:  http.StatusNotFound,
+			body:    `{"error":{"code":404,"message":"model not found"}}`,
+			wantErr: http.StatusNotFound,
+		},
+		{
+			name:           "rate limited",
+			req:            types.AIPIRequest{Model: "qwen2.5", UserMessage: "hi"},
+			status:         http.StatusTooManyRequests,
+			retryAfter:     "5",
+			body:           `{"error":{"code":429,"message":"slow down"}}`,
+			wantErr:        http.StatusTooManyRequests,
+			wantRetryAfter: 5 * time.Second,
+		},
+		{
+			name:    "server error",
+			req:     types.AIPIRequest{Model: "qwen2.5", UserMessage: "hi"},
+			status:  http.StatusBadGateway,
+			body:    `bad gateway`,
+			wantErr: http.StatusBadGateway,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/chat/completions" {
+					t.Errorf("path = %s, want /v1/chat/completions", r.URL.Path)
+				}
+				if auth := r.Header.Get("Authorization"); auth != "Bearer key" {
+					t.Errorf("Authorization = %q, want the api key", auth)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			resp, err := NewOpenAICompatibleProvider(server.URL+"/v1", "key").GetCompletion(context.Background(), tt.req)
+			if tt.wantErr != 0 {
+				var providerErr *types.ProviderError
+				if !errors.As(err, &providerErr) || providerErr.StatusCode != tt.wantErr {
+					t.Fatalf("err = %v, want a provider error with status %d", err, tt.wantErr)
+				}
+				if providerErr.RetryAfter != tt.wantRetryAfter {
+					t.Errorf("retry after = %v, want %v", providerErr.RetryAfter, tt.wantRetryAfter)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetCompletion: %v", err)
+			}
+			if tt.check != nil {
+				tt.check(t, sent)
+			}
+			got, _ := json.Marshal(resp)
+			want, _ := json.Marshal(tt.want)
+			if string(got) != string(want) {
+				t.Errorf("response = %s, want %s", got, want)
+			}
+		})
+	}
+}
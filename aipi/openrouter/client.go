@@ -0,0 +1,58 @@
+package openrouter
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/SomtoJF/iris-worker/aipi/types"
+	"github.com/revrost/go-openrouter"
+)
+
+// NewClient builds a client from config whose 429 responses keep their
+// Retry-After hint. The client's own errors drop response headers, so the hint
+// is read on the way through its HTTP client instead.
+func NewClient(config *openrouter.ClientConfig) *openrouter.Client {
+	next := config.HTTPClient
+	if next == nil {
+		next = http.DefaultClient
+	}
+	withHint := *config
+	withHint.HTTPClient = retryAfterDoer{next: next}
+	return openrouter.NewClientWithConfig(withHint)
+}
+
+// retryAfterDoer stores the Retry-After header of a 429 in the retryAfterHint
+// the request's context carries, if any.
+type retryAfterDoer struct {
+	next openrouter.HTTPDoer
+}
+
+func (d retryAfterDoer) Do(req *http.Request) (*http.Response, error) {
+	res, err := d.next.Do(req)
+	if err != nil || res.StatusCode != http.StatusTooManyRequests {
+		return res, err
+	}
+	if hint, ok := req.Context().Value(retryAfterKey{}).(*retryAfterHint); ok {
+		hint.Store(int64(types.ParseRetryAfter(res.Header.Get("Retry-After"))))
+	}
+	return res, err
+}
+
+type retryAfterKey struct{}
+
+// retryAfterHint is the Retry-After of the last 429 a call got, or zero.
+type retryAfterHint struct {
+	atomic.Int64
+}
+
+func (h *retryAfterHint) duration() time.Duration {
+	return time.Duration(h.Load())
+}
+
+// withRetryAfterHint gives a call somewhere to receive a Retry-After hint.
+func withRetryAfterHint(ctx context.Context) (context.Context, *retryAfterHint) {
+	hint := &retryAfterHint{}
+	return context.WithValue(ctx, retryAfterKey{}, hint), hint
+}
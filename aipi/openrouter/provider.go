@@ -2,22 +2,86 @@ package openrouter
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"time"
 
+	"github.com/SomtoJF/iris-worker/aipi/pricing"
+	"github.com/SomtoJF/iris-worker/aipi/schema"
 	"github.com/SomtoJF/iris-worker/aipi/types"
 	"github.com/revrost/go-openrouter"
-	"github.com/revrost/go-openrouter/jsonschema"
 )
 
 type OpenRouterProvider struct {
-	client *openrouter.Client
+	client  *openrouter.Client
+	pricing *pricing.Registry
 }
 
-func NewOpenRouterProvider(client *openrouter.Client) *OpenRouterProvider {
-	return &OpenRouterProvider{client: client}
+// NewOpenRouterProvider prices responses with registry. A nil registry leaves the
+// input and output cost split empty.
+func NewOpenRouterProvider(client *openrouter.Client, registry *pricing.Registry) *OpenRouterProvider {
+	return &OpenRouterProvider{client: client, pricing: registry}
 }
 
 func (p *OpenRouterProvider) GetCompletion(ctx context.Context, req types.AIPIRequest) (types.AIPIResponse, error) {
+	chatReq, err := buildRequest(req)
+	if err != nil {
+		return types.AIPIResponse{}, err
+	}
+
+	ctx, hint := withRetryAfterHint(ctx)
+	resp, err := p.client.CreateChatCompletion(ctx, chatReq)
+	if err != nil {
+		return types.AIPIResponse{}, fmt.Errorf("openrouter api call failed: %w", wrapError(err, hint.duration()))
+	}
+
+	return p.mapResponse(resp), nil
+}
+
+// StreamCompletion sends the request with streaming enabled and hands every content
+// or tool argument fragment to onDelta, then assembles the chunks into one response.
+func (p *OpenRouterProvider) StreamCompletion(ctx context.Context, req types.AIPIRequest, onDelta types.StreamHandler) (types.AIPIResponse, error) {
+	chatReq, err := buildRequest(req)
+	if err != nil {
+		return types.AIPIResponse{}, err
+	}
+	chatReq.StreamOptions = &openrouter.StreamOptions{IncludeUsage: true}
+	chatReq.Usage = &openrouter.IncludeUsage{Include: true}
+
+	ctx, hint := withRetryAfterHint(ctx)
+	stream, err := p.client.CreateChatCompletionStream(ctx, chatReq)
+	if err != nil {
+		return types.AIPIResponse{}, fmt.Errorf("openrouter api call failed: %w", wrapError(err, hint.duration()))
+	}
+	defer stream.Close()
+
+	acc := newStreamAccumulator()
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return types.AIPIResponse{}, fmt.Errorf("openrouter stream failed: %w", wrapError(err, 0))
+		}
+		acc.add(chunk, onDelta)
+	}
+
+	// The client ends the stream quietly on cancellation and read errors alike, so
+	// a missing finish reason is the only sign the answer was cut short.
+	if err := ctx.Err(); err != nil {
+		return types.AIPIResponse{}, err
+	}
+	if !acc.finished {
+		return types.AIPIResponse{}, errors.New("openrouter stream ended before the completion finished")
+	}
+
+	return p.mapResponse(acc.response()), nil
+}
+
+func buildRequest(req types.AIPIRequest) (openrouter.ChatCompletionRequest, error) {
 	messages := buildMessages(req)
 
 	chatReq := openrouter.ChatCompletionRequest{
@@ -33,122 +97,214 @@ func (p *OpenRouterProvider) GetCompletion(ctx context.Context, req types.AIPIRe
 		chatReq.Temperature = float32(*req.Temperature)
 	}
 
+	if len(req.Tools) > 0 {
+		chatReq.Tools = buildTools(req.Tools)
+		chatReq.ToolChoice = buildToolChoice(req.ToolChoice)
+		if req.ParallelToolCalls != nil {
+			chatReq.ParallelToolCalls = *req.ParallelToolCalls
+		}
+	}
+
 	if req.ResponseSchema != nil {
-		schema, err := jsonschema.GenerateSchemaForType(req.ResponseSchema)
+		document, err := json.Marshal(req.ResponseSchema)
 		if err != nil {
-			return types.AIPIResponse{}, fmt.Errorf("failed to generate response schema: %w", err)
+			return openrouter.ChatCompletionRequest{}, fmt.Errorf("failed to encode response schema: %w", err)
 		}
+		// Providers reject strict schemas that leave properties optional or
+		// objects open, so only schemas that qualify are sent as strict.
 		chatReq.ResponseFormat = &openrouter.ChatCompletionResponseFormat{
 			Type: openrouter.ChatCompletionResponseFormatTypeJSONSchema,
 			JSONSchema: &openrouter.ChatCompletionResponseFormatJSONSchema{
 				Name:   "response_schema",
-				Schema: schema,
-				Strict: true,
+				Schema: json.RawMessage(document),
+				Strict: schema.IsStrict(req.ResponseSchema),
 			},
 		}
 	}
 
-	resp, err := p.client.CreateChatCompletion(ctx, chatReq)
-	if err != nil {
-		return types.AIPIResponse{}, fmt.Errorf("openrouter api call failed: %w", err)
-	}
+	return chatReq, nil
+}
 
-	return mapResponse(resp), nil
+// wrapError lifts the HTTP status out of the client's error types so the rest of
+// aipi can classify it. retryAfter is the hint the response carried, if known.
+func wrapError(err error, retryAfter time.Duration) error {
+	var apiErr *openrouter.APIError
+	if errors.As(err, &apiErr) {
+		return &types.ProviderError{StatusCode: apiErr.HTTPStatusCode, RetryAfter: retryAfter, Err: err}
+	}
+	var reqErr *openrouter.RequestError
+	if errors.As(err, &reqErr) {
+		return &types.ProviderError{StatusCode: reqErr.HTTPStatusCode, RetryAfter: retryAfter, Err: err}
+	}
+	return err
 }
 
 func buildMessages(req types.AIPIRequest) []openrouter.ChatCompletionMessage {
 	messages := []openrouter.ChatCompletionMessage{}
 
-	if req.SystemMessage != "" {
-		messages = append(messages, openrouter.SystemMessage(req.SystemMessage))
+	for _, message := range req.AllMessages() {
+		messages = append(messages, buildMessage(message))
 	}
 
-	if req.ImageUrl != nil && *req.ImageUrl != "" {
-		messages = append(messages, openrouter.UserMessageWithImage(req.UserMessage, *req.ImageUrl))
-	} else {
-		messages = append(messages, openrouter.UserMessage(req.UserMessage))
+	return messages
+}
+
+// buildMessage sends plain text messages as strings, and anything with an image
+// or a cache breakpoint as multi-part content, since only parts carry cache_control.
+func buildMessage(message types.Message) openrouter.ChatCompletionMessage {
+	multiPart := false
+	for _, part := range message.Parts {
+		if part.Type == types.ContentPartTypeImage || part.Cacheable {
+			multiPart = true
+		}
 	}
 
-	return messages
+	if !multiPart {
+		return openrouter.ChatCompletionMessage{
+			Role:       string(message.Role),
+			Content:    openrouter.Content{Text: message.Text()},
+			ToolCalls:  buildToolCalls(message.ToolCalls),
+			ToolCallID: message.ToolCallID,
+		}
+	}
+
+	parts := []openrouter.ChatMessagePart{}
+	for _, part := range message.Parts {
+		var mapped openrouter.ChatMessagePart
+		switch part.Type {
+		case types.ContentPartTypeText:
+			mapped = openrouter.ChatMessagePart{
+				Type: openrouter.ChatMessagePartTypeText,
+				Text: part.Text,
+			}
+		case types.ContentPartTypeImage:
+			mapped = openrouter.ChatMessagePart{
+				Type:     openrouter.ChatMessagePartTypeImageURL,
+				ImageURL: &openrouter.ChatMessageImageURL{URL: part.ImageUrl},
+			}
+		default:
+			continue
+		}
+		// Providers that cache automatically, like OpenAI and Gemini, ignore this.
+		if part.Cacheable {
+			mapped.CacheControl = &openrouter.CacheControl{Type: "ephemeral"}
+		}
+		parts = append(parts, mapped)
+	}
+
+	return openrouter.ChatCompletionMessage{
+		Role:       string(message.Role),
+		Content:    openrouter.Content{Multi: parts},
+		ToolCalls:  buildToolCalls(message.ToolCalls),
+		ToolCallID: message.ToolCallID,
+	}
+}
+
+func buildTools(tools []types.ToolDefinition) []openrouter.Tool {
+	mapped := make([]openrouter.Tool, len(tools))
+	for i, tool := range tools {
+		mapped[i] = openrouter.Tool{
+			Type: openrouter.ToolTypeFunction,
+			Function: &openrouter.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		}
+	}
+	return mapped
 }
 
-func mapResponse(resp openrouter.ChatCompletionResponse) types.AIPIResponse {
+// buildToolChoice passes the keyword choices through as strings and turns a tool
+// name into the object form that forces that tool.
+func buildToolChoice(choice types.ToolChoice) any {
+	switch choice {
+	case "":
+		return nil
+	case types.ToolChoiceAuto, types.ToolChoiceNone, types.ToolChoiceRequired:
+		return string(choice)
+	default:
+		return map[string]interface{}{
+			"type":     openrouter.ToolTypeFunction,
+			"function": map[string]string{"name": string(choice)},
+		}
+	}
+}
+
+func buildToolCalls(calls []types.ToolCall) []openrouter.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	mapped := make([]openrouter.ToolCall, len(calls))
+	for i, call := range calls {
+		mapped[i] = openrouter.ToolCall{
+			ID:   call.ID,
+			Type: openrouter.ToolTypeFunction,
+			Function: openrouter.FunctionCall{
+				Name:      call.Name,
+				Arguments: call.Arguments,
+			},
+		}
+	}
+	return mapped
+}
+
+func (p *OpenRouterProvider) mapResponse(resp openrouter.ChatCompletionResponse) types.AIPIResponse {
 	content := ""
+	toolCalls := []types.ToolCall{}
 	if len(resp.Choices) > 0 {
 		content = resp.Choices[0].Message.Content.Text
+		for _, call := range resp.Choices[0].Message.ToolCalls {
+			toolCalls = append(toolCalls, types.ToolCall{
+				ID:        call.ID,
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+			})
+		}
 	}
 
-	inputTokens := 0
-	outputTokens := 0
+	usage := pricing.Usage{}
 	totalCost := 0.0
 	inputCost := 0.0
 	outputCost := 0.0
 
+	// OpenRouter reports cache reads but not cache writes, so writes are priced
+	// as ordinary input; its own total still reflects the real charge.
 	if resp.Usage != nil {
-		inputTokens = resp.Usage.PromptTokens
-		outputTokens = resp.Usage.CompletionTokens
+		usage.Input = resp.Usage.PromptTokens
+		usage.Output = resp.Usage.CompletionTokens
+		usage.CacheRead = resp.Usage.PromptTokenDetails.CachedTokens
 		totalCost = resp.Usage.Cost
-		inputCost, outputCost = calculateCosts(resp.Model, inputTokens, outputTokens, totalCost)
+		inputCost, outputCost, totalCost = calculateCosts(p.pricing, resp.Model, usage, totalCost)
 	}
 
 	return types.AIPIResponse{
-		Content:      content,
-		InputTokens:  inputTokens,
-		OutputTokens: outputTokens,
-		InputCost:    inputCost,
-		OutputCost:   outputCost,
-		TotalCost:    totalCost,
-		Model:        resp.Model,
+		Content:         content,
+		ToolCalls:       toolCalls,
+		InputTokens:     usage.Input,
+		OutputTokens:    usage.Output,
+		CacheReadTokens: usage.CacheRead,
+		InputCost:       inputCost,
+		OutputCost:      outputCost,
+		TotalCost:       totalCost,
+		Model:           resp.Model,
 	}
 }
 
-func calculateCosts(model string, inputTokens, outputTokens int, totalCost float64) (float64, float64) {
-	if totalCost == 0 || (inputTokens+outputTokens) == 0 {
-		return 0, 0
+// calculateCosts splits the billed total into input and output cost using the
+// registry's rates. When OpenRouter reports no total, the rates provide it.
+func calculateCosts(registry *pricing.Registry, model string, usage pricing.Usage, totalCost float64) (float64, float64, float64) {
+	if registry == nil || (usage.Input+usage.Output) == 0 {
+		return 0, 0, totalCost
 	}
 
-	rates := getModelRates(model)
-	if rates.inputRate == 0 && rates.outputRate == 0 {
-		return 0, 0
+	inputCost, outputCost, ok := registry.Costs(model, usage)
+	if !ok {
+		return 0, 0, totalCost
 	}
 
-	inputCost := float64(inputTokens) * rates.inputRate / 1_000_000
-	outputCost := float64(outputTokens) * rates.outputRate / 1_000_000
-
-	return inputCost, outputCost
-}
-
-type modelRates struct {
-	inputRate  float64
-	outputRate float64
-}
-
-func getModelRates(model string) modelRates {
-	rates := map[string]modelRates{
-		"openai/chatgpt-4o-latest":                     {inputRate: 5.0, outputRate: 15.0},
-		"openai/gpt-4o-mini":                           {inputRate: 0.15, outputRate: 0.60},
-		"openai/gpt-5-nano":                            {inputRate: 0.05, outputRate: 0.40},
-		"openai/gpt-5-mini":                            {inputRate: 0.25, outputRate: 2.00},
-		"deepseek/deepseek-chat":                       {inputRate: 0.14, outputRate: 0.28},
-		"deepseek/deepseek-r1":                         {inputRate: 0.55, outputRate: 2.19},
-		"deepseek/deepseek-r1-distill-llama-70b":       {inputRate: 0.55, outputRate: 2.19},
-		"google/gemini-2.0-flash-lite":                 {inputRate: 0.075, outputRate: 0.30},
-		"google/gemini-2.5-flash-lite-preview-09-2025": {inputRate: 0.10, outputRate: 0.40},
-		"google/gemini-2.5-flash-lite":                 {inputRate: 0.10, outputRate: 0.40},
-		"google/gemini-2.0-flash":                      {inputRate: 0.10, outputRate: 0.40},
-		"google/gemini-2.5-flash":                      {inputRate: 0.30, outputRate: 2.50},
-		"google/gemini-3-flash-preview":                {inputRate: 0.50, outputRate: 3.0},
-		"google/gemini-3-pro-preview":                  {inputRate: 2.0, outputRate: 12.0},
-		"google/gemini-2.5-pro":                        {inputRate: 1.25, outputRate: 10.0},
-		"google/gemini-pro-1.5-exp":                    {inputRate: 0, outputRate: 0},
-		"google/gemini-flash-1.5-8b":                   {inputRate: 0.0375, outputRate: 0.15},
-		"microsoft/phi-3-mini-128k-instruct:free":      {inputRate: 0, outputRate: 0},
-		"liquid/lfm-7b":                                {inputRate: 0.10, outputRate: 0.10},
-	}
-
-	if rate, ok := rates[model]; ok {
-		return rate
-	}
-
-	return modelRates{inputRate: 0, outputRate: 0}
+	if totalCost == 0 {
+		totalCost = inputCost + outputCost
+	}
+	return inputCost, outputCost, totalCost
 }
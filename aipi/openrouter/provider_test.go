@@ -0,0 +1,179 @@
+package openrouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SomtoJF/iris-worker/aipi/types"
+	"github.com/revrost/go-openrouter"
+)
+
+func TestStreamCompletion(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		wantContent string
+		wantDeltas  []string
+		retryAfter  string
+		wantStatus  int
+		wantHint    time.Duration
+		wantErr     bool
+	}{
+		{
+			name:   "finished stream",
+			status: http.StatusOK,
+			body: `data: {"model":"m","choices":[{"delta":{"content":"Hel"}}]}` + "\n\n" +
+				`data: {"model":"m","choices":[{"delta":{"content":"lo"},"finish_reason":"stop"}]}` + "\n\n" +
+				`data: {"model":"m","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2}}` + "\n\n" +
+				"data: [DONE]\n",
+			wantContent: "Hello",
+			wantDeltas:  []string{"Hel", "lo"},
+		},
+		{
+			name:       "rejected",
+			status:     http.StatusTooManyRequests,
+			body:       `{"error":{"code":429,"message":"rate limited"}}`,
+			retryAfter: "7",
+			wantStatus: http.StatusTooManyRequests,
+			wantHint:   7 * time.Second,
+			wantErr:    true,
+		},
+		{
+			name:    "cut short",
+			status:  http.StatusOK,
+			body:    `data: {"model":"m","choices":[{"delta":{"content":"Hel"}}]}` + "\n\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/chat/completions" {
+					t.Errorf("path = %s, want /chat/completions", r.URL.Path)
+				}
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			config := openrouter.DefaultConfig("key")
+			config.BaseURL = server.URL
+			provider := NewOpenRouterProvider(NewClient(config), nil)
+
+			var deltas []string
+			resp, err := provider.StreamCompletion(context.Background(), types.AIPIRequest{Model: "m", UserMessage: "hi"}, func(delta string) {
+				deltas = append(deltas, delta)
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("StreamCompletion succeeded")
+				}
+				var providerErr *types.ProviderError
+				if tt.wantStatus != 0 && (!errors.As(err, &providerErr) || providerErr.StatusCode != tt.wantStatus) {
+					t.Errorf("err = %v, want a provider error with status %d", err, tt.wantStatus)
+				}
+				if got := types.RetryAfter(err); got != tt.wantHint {
+					t.Errorf("retry after = %v, want %v", got, tt.wantHint)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("StreamCompletion: %v", err)
+			}
+			if resp.Content != tt.wantContent || resp.InputTokens != 5 || resp.OutputTokens != 2 {
+				t.Errorf("response = %+v, want %q with 5/2 tokens", resp, tt.wantContent)
+			}
+			if strings.Join(deltas, "|") != strings.Join(tt.wantDeltas, "|") {
+				t.Errorf("deltas = %q, want %q", deltas, tt.wantDeltas)
+			}
+		})
+	}
+}
+
+func TestGetCompletionRetryAfter(t *testing.T) {
+	for _, header := range []string{"12", ""} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if header != "" {
+				w.Header().Set("Retry-After", header)
+			}
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"code":429,"message":"rate limited"}}`))
+		}))
+
+		config := openrouter.DefaultConfig("key")
+		config.BaseURL = server.URL
+		_, err := NewOpenRouterProvider(NewClient(config), nil).GetCompletion(context.Background(), types.AIPIRequest{Model: "m", UserMessage: "hi"})
+		server.Close()
+
+		want := types.ParseRetryAfter(header)
+		if types.StatusCode(err) != http.StatusTooManyRequests || types.RetryAfter(err) != want {
+			t.Errorf("Retry-After %q: err = %v with hint %v, want a 429 with hint %v", header, err, types.RetryAfter(err), want)
+		}
+	}
+}
+
+func TestWrapError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{name: "api error", err: &openrouter.APIError{HTTPStatusCode: http.StatusBadGateway}, wantStatus: http.StatusBadGateway},
+		{name: "wrapped api error", err: fmt.Errorf("stream: %w", &openrouter.APIError{HTTPStatusCode: http.StatusTooManyRequests}), wantStatus: http.StatusTooManyRequests},
+		{name: "request error", err: &openrouter.RequestError{HTTPStatusCode: http.StatusServiceUnavailable}, wantStatus: http.StatusServiceUnavailable},
+		{name: "other error", err: errors.New("connection reset")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := wrapError(tt.err, 0)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("wrapError(%v) = %v, want it to wrap the original", tt.err, err)
+			}
+			var providerErr *types.ProviderError
+			isProviderErr := errors.As(err, &providerErr)
+			if tt.wantStatus == 0 && isProviderErr {
+				t.Errorf("wrapError(%v) = %v, want it unclassified", tt.err, err)
+			}
+			if tt.wantStatus != 0 && (!isProviderErr || providerErr.StatusCode != tt.wantStatus) {
+				t.Errorf("wrapError(%v) = %v, want status %d", tt.err, err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestBuildRequestStrictSchema(t *testing.T) {
+	closed := map[string]interface{}{
+		"type":                 "object",
+		"properties":           map[string]interface{}{"name": map[string]interface{}{"type": "string"}},
+		"required":             []string{"name"},
+		"additionalProperties": false,
+	}
+	open := map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"name": map[string]interface{}{"type": "string"}},
+	}
+	for _, tt := range []struct {
+		name   string
+		schema map[string]interface{}
+		want   bool
+	}{{"closed", closed, true}, {"open", open, false}} {
+		chatReq, err := buildRequest(types.AIPIRequest{Model: "m", UserMessage: "hi", ResponseSchema: tt.schema})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := chatReq.ResponseFormat.JSONSchema.Strict; got != tt.want {
+			t.Errorf("%s schema: strict = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
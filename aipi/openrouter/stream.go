@@ -0,0 +1,90 @@
+package openrouter
+
+import (
+	"strings"
+
+	"github.com/SomtoJF/iris-worker/aipi/types"
+	"github.com/revrost/go-openrouter"
+)
+
+// streamAccumulator rebuilds a regular completion response from stream chunks so
+// streamed and unstreamed calls share mapResponse.
+type streamAccumulator struct {
+	model     string
+	content   strings.Builder
+	toolCalls []*openrouter.ToolCall
+	usage     *openrouter.Usage
+	finished  bool
+}
+
+func newStreamAccumulator() *streamAccumulator {
+	return &streamAccumulator{}
+}
+
+func (a *streamAccumulator) add(chunk openrouter.ChatCompletionStreamResponse, onDelta types.StreamHandler) {
+	if chunk.Model != "" {
+		a.model = chunk.Model
+	}
+	if chunk.Usage != nil {
+		a.usage = chunk.Usage
+	}
+	if len(chunk.Choices) == 0 {
+		return
+	}
+
+	choice := chunk.Choices[0]
+	if choice.FinishReason != "" {
+		a.finished = true
+	}
+
+	if choice.Delta.Content != "" {
+		a.content.WriteString(choice.Delta.Content)
+		onDelta(choice.Delta.Content)
+	}
+
+	for _, delta := range choice.Delta.ToolCalls {
+		call := a.toolCall(delta)
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Function.Name != "" {
+			call.Function.Name = delta.Function.Name
+		}
+		if delta.Function.Arguments != "" {
+			call.Function.Arguments += delta.Function.Arguments
+			onDelta(delta.Function.Arguments)
+		}
+	}
+}
+
+// toolCall returns the call a delta belongs to. Deltas carry the call's index;
+// ones without it continue the most recent call.
+func (a *streamAccumulator) toolCall(delta openrouter.ToolCall) *openrouter.ToolCall {
+	index := len(a.toolCalls) - 1
+	if delta.Index != nil {
+		index = *delta.Index
+	}
+	if index < 0 {
+		index = 0
+	}
+	for len(a.toolCalls) <= index {
+		a.toolCalls = append(a.toolCalls, &openrouter.ToolCall{Type: openrouter.ToolTypeFunction})
+	}
+	return a.toolCalls[index]
+}
+
+func (a *streamAccumulator) response() openrouter.ChatCompletionResponse {
+	message := openrouter.ChatCompletionMessage{
+		Role:    openrouter.ChatMessageRoleAssistant,
+		Content: openrouter.Content{Text: a.content.String()},
+	}
+	for _, call := range a.toolCalls {
+		message.ToolCalls = append(message.ToolCalls, *call)
+	}
+
+	return openrouter.ChatCompletionResponse{
+		Model:   a.model,
+		Choices: []openrouter.ChatCompletionChoice{{Message: message}},
+		Usage:   a.usage,
+	}
+}
@@ -0,0 +1,65 @@
+package pricing
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/revrost/go-openrouter"
+)
+
+// OpenRouterSource lists models from OpenRouter's models endpoint, which quotes
+// prices in USD per token as decimal strings.
+func OpenRouterSource(client *openrouter.Client) Source {
+	return func(ctx context.Context) ([]ModelInfo, error) {
+		listed, err := client.ListModels(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		models := make([]ModelInfo, 0, len(listed))
+		for _, model := range listed {
+			info := ModelInfo{
+				ID:                  model.ID,
+				InputPerMillion:     perMillion(model.Pricing.Prompt),
+				OutputPerMillion:    perMillion(model.Pricing.Completion),
+				ContextLength:       intValue(model.ContextLength),
+				MaxCompletionTokens: intValue(model.TopProvider.MaxCompletionTokens),
+			}
+			if model.Pricing.InputCacheRead != nil {
+				info.CacheReadPerMillion = perMillion(*model.Pricing.InputCacheRead)
+			}
+			if model.Pricing.InputCacheWrite != nil {
+				info.CacheWritePerMillion = perMillion(*model.Pricing.InputCacheWrite)
+			}
+			if info.ContextLength == 0 {
+				info.ContextLength = intValue(model.TopProvider.ContextLength)
+			}
+			models = append(models, info)
+
+			// Responses sometimes name the canonical slug rather than the alias.
+			if model.CanonicalSlug != nil && *model.CanonicalSlug != model.ID {
+				alias := info
+				alias.ID = *model.CanonicalSlug
+				models = append(models, alias)
+			}
+		}
+		return models, nil
+	}
+}
+
+// perMillion converts a per-token price string. Unparseable prices, including
+// OpenRouter's "-1" for variable pricing, count as unknown.
+func perMillion(perToken string) float64 {
+	price, err := strconv.ParseFloat(perToken, 64)
+	if err != nil || price < 0 {
+		return 0
+	}
+	return price * 1_000_000
+}
+
+func intValue(v *int64) int {
+	if v == nil {
+		return 0
+	}
+	return int(*v)
+}
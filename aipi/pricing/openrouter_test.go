@@ -0,0 +1,76 @@
+package pricing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/revrost/go-openrouter"
+)
+
+const modelList = `{"data":[
+	{"id":"anthropic/claude-sonnet-4","canonical_slug":"anthropic/claude-4-sonnet-20250522","context_length":200000,
+	 "pricing":{"prompt":"0.000003","completion":"0.000015","input_cache_read":"0.0000003","input_cache_write":"0.00000375"},
+	 "top_provider":{"context_length":200000,"max_completion_tokens":64000}},
+	{"id":"openrouter/auto","pricing":{"prompt":"-1","completion":"-1"},"top_provider":{"context_length":2000000}},
+	{"id":"meta-llama/llama-3.3-70b:free","canonical_slug":"meta-llama/llama-3.3-70b:free","context_length":131072,
+	 "pricing":{"prompt":"0","completion":"0"},"top_provider":{}}
+]}`
+
+func TestOpenRouterSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models" {
+			t.Errorf("path = %s, want /models", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(modelList))
+	}))
+	defer server.Close()
+
+	config := openrouter.DefaultConfig("key")
+	config.BaseURL = server.URL
+	models, err := OpenRouterSource(openrouter.NewClientWithConfig(*config))(context.Background())
+	if err != nil {
+		t.Fatalf("OpenRouterSource: %v", err)
+	}
+
+	sonnet := ModelInfo{
+		ID:                   "anthropic/claude-sonnet-4",
+		InputPerMillion:      3,
+		OutputPerMillion:     15,
+		CacheReadPerMillion:  0.3,
+		CacheWritePerMillion: 3.75,
+		ContextLength:        200000,
+		MaxCompletionTokens:  64000,
+	}
+	canonical := sonnet
+	canonical.ID = "anthropic/claude-4-sonnet-20250522"
+	want := []ModelInfo{
+		sonnet,
+		canonical,
+		// Variable prices are unknown; the context window falls back to the top provider's.
+		{ID: "openrouter/auto", ContextLength: 2000000},
+		{ID: "meta-llama/llama-3.3-70b:free", ContextLength: 131072},
+	}
+	if len(models) != len(want) {
+		t.Fatalf("got %d models, want %d: %+v", len(models), len(want), models)
+	}
+	for i := range want {
+		if !approxEqual(models[i], want[i]) {
+			t.Errorf("model %d = %+v, want %+v", i, models[i], want[i])
+		}
+	}
+}
+
+// approxEqual compares prices to within float rounding of the per-token strings.
+func approxEqual(a, b ModelInfo) bool {
+	near := func(x, y float64) bool { return x-y < 1e-9 && y-x < 1e-9 }
+	return a.ID == b.ID &&
+		near(a.InputPerMillion, b.InputPerMillion) &&
+		near(a.OutputPerMillion, b.OutputPerMillion) &&
+		near(a.CacheReadPerMillion, b.CacheReadPerMillion) &&
+		near(a.CacheWritePerMillion, b.CacheWritePerMillion) &&
+		a.ContextLength == b.ContextLength &&
+		a.MaxCompletionTokens == b.MaxCompletionTokens
+}
@@ -0,0 +1,237 @@
+// Package pricing keeps per-model token prices and context-window limits, loaded
+// from OpenRouter's model list and patched by local overrides.
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// ModelInfo describes one model. Prices are in USD per million tokens; zero means
+// unknown or free. Limits of zero mean unknown.
+type ModelInfo struct {
+	ID                   string    `gorm:"primaryKey;column:id" json:"id"`
+	InputPerMillion      float64   `gorm:"not null;default:0" json:"input_per_million,omitempty"`
+	OutputPerMillion     float64   `gorm:"not null;default:0" json:"output_per_million,omitempty"`
+	CacheReadPerMillion  float64   `gorm:"not null;default:0" json:"cache_read_per_million,omitempty"`
+	CacheWritePerMillion float64   `gorm:"not null;default:0" json:"cache_write_per_million,omitempty"`
+	ContextLength        int       `gorm:"not null;default:0" json:"context_length,omitempty"`
+	MaxCompletionTokens  int       `gorm:"not null;default:0" json:"max_completion_tokens,omitempty"`
+	UpdatedAt            time.Time `gorm:"default:CURRENT_TIMESTAMP;autoUpdateTime" json:"-"`
+}
+
+func (ModelInfo) TableName() string {
+	return "model_pricing"
+}
+
+// Source fetches the current model list from upstream.
+type Source func(ctx context.Context) ([]ModelInfo, error)
+
+// Store persists the last fetched model list so a worker can price calls even
+// when it starts without network access.
+type Store interface {
+	Load() ([]ModelInfo, error)
+	Save(models []ModelInfo) error
+}
+
+// Registry answers price and limit lookups. It is safe for concurrent use.
+type Registry struct {
+	source Source
+	store  Store
+
+	mu        sync.RWMutex
+	models    map[string]ModelInfo
+	overrides map[string]ModelInfo
+}
+
+// NewRegistry returns an empty registry. Either argument may be nil, in which case
+// the registry only knows what overrides tell it.
+func NewRegistry(source Source, store Store) *Registry {
+	return &Registry{
+		source:    source,
+		store:     store,
+		models:    map[string]ModelInfo{},
+		overrides: map[string]ModelInfo{},
+	}
+}
+
+// LoadOverrides reads a JSON object keyed by model id, e.g.
+//
+//	{"anthropic:claude-sonnet-4": {"input_per_million": 3, "output_per_million": 15}}
+//
+// Fields set in an override replace the fetched values; unset fields keep them.
+// Overrides also cover models OpenRouter does not list, such as local ones.
+func (r *Registry) LoadOverrides(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read pricing overrides: %w", err)
+	}
+
+	overrides := map[string]ModelInfo{}
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return fmt.Errorf("failed to parse pricing overrides %s: %w", path, err)
+	}
+	for id, info := range overrides {
+		info.ID = id
+		overrides[id] = info
+	}
+
+	r.mu.Lock()
+	r.overrides = overrides
+	r.mu.Unlock()
+	return nil
+}
+
+// LoadSnapshot fills the registry from the store without touching the network.
+func (r *Registry) LoadSnapshot() error {
+	if r.store == nil {
+		return nil
+	}
+	models, err := r.store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load pricing snapshot: %w", err)
+	}
+	r.replace(models)
+	return nil
+}
+
+// Refresh fetches the model list from the source and saves it as the new snapshot.
+// On failure the registry keeps what it had.
+func (r *Registry) Refresh(ctx context.Context) error {
+	if r.source == nil {
+		return nil
+	}
+	models, err := r.source(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch model pricing: %w", err)
+	}
+	r.replace(models)
+
+	if r.store != nil {
+		if err := r.store.Save(models); err != nil {
+			return fmt.Errorf("failed to save pricing snapshot: %w", err)
+		}
+	}
+	return nil
+}
+
+// Start loads the snapshot, then refreshes right away and every interval until
+// ctx is done. Refresh failures are logged and retried on the next tick.
+func (r *Registry) Start(ctx context.Context, interval time.Duration) {
+	if err := r.LoadSnapshot(); err != nil {
+		log.Println(err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := r.Refresh(ctx); err != nil && ctx.Err() == nil {
+				log.Println(err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (r *Registry) replace(models []ModelInfo) {
+	if len(models) == 0 {
+		return
+	}
+	byID := make(map[string]ModelInfo, len(models))
+	for _, model := range models {
+		byID[model.ID] = model
+	}
+
+	r.mu.Lock()
+	r.models = byID
+	r.mu.Unlock()
+}
+
+// Lookup returns what is known about model, with overrides applied.
+func (r *Registry) Lookup(model string) (ModelInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	info, known := r.models[model]
+	override, overridden := r.overrides[model]
+	if !known && !overridden {
+		return ModelInfo{}, false
+	}
+	if overridden {
+		info = merge(info, override)
+	}
+	info.ID = model
+	return info, true
+}
+
+// ContextLength returns the model's context window in tokens, or 0 if unknown.
+func (r *Registry) ContextLength(model string) int {
+	info, _ := r.Lookup(model)
+	return info.ContextLength
+}
+
+// Usage is the token count of one call. Input includes the cached tokens.
+type Usage struct {
+	Input      int
+	Output     int
+	CacheRead  int
+	CacheWrite int
+}
+
+// Costs prices a call. Cached input is charged at the cache rates, falling back
+// to the input rate for models without one. ok is false when the model has no
+// known prices.
+func (r *Registry) Costs(model string, usage Usage) (inputCost float64, outputCost float64, ok bool) {
+	info, found := r.Lookup(model)
+	if !found || (info.InputPerMillion == 0 && info.OutputPerMillion == 0) {
+		return 0, 0, false
+	}
+
+	cacheReadRate := info.CacheReadPerMillion
+	if cacheReadRate == 0 {
+		cacheReadRate = info.InputPerMillion
+	}
+	cacheWriteRate := info.CacheWritePerMillion
+	if cacheWriteRate == 0 {
+		cacheWriteRate = info.InputPerMillion
+	}
+
+	uncached := max(0, usage.Input-usage.CacheRead-usage.CacheWrite)
+	inputCost = (float64(uncached)*info.InputPerMillion +
+		float64(usage.CacheRead)*cacheReadRate +
+		float64(usage.CacheWrite)*cacheWriteRate) / 1_000_000
+	outputCost = float64(usage.Output) * info.OutputPerMillion / 1_000_000
+	return inputCost, outputCost, true
+}
+
+func merge(base, override ModelInfo) ModelInfo {
+	if override.InputPerMillion != 0 {
+		base.InputPerMillion = override.InputPerMillion
+	}
+	if override.OutputPerMillion != 0 {
+		base.OutputPerMillion = override.OutputPerMillion
+	}
+	if override.CacheReadPerMillion != 0 {
+		base.CacheReadPerMillion = override.CacheReadPerMillion
+	}
+	if override.CacheWritePerMillion != 0 {
+		base.CacheWritePerMillion = override.CacheWritePerMillion
+	}
+	if override.ContextLength != 0 {
+		base.ContextLength = override.ContextLength
+	}
+	if override.MaxCompletionTokens != 0 {
+		base.MaxCompletionTokens = override.MaxCompletionTokens
+	}
+	return base
+}
@@ -0,0 +1,88 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type memoryStore struct {
+	models []ModelInfo
+}
+
+func (s *memoryStore) Load() ([]ModelInfo, error) { return s.models, nil }
+
+func (s *memoryStore) Save(models []ModelInfo) error {
+	s.models = models
+	return nil
+}
+
+var sonnet = ModelInfo{ID: "sonnet", InputPerMillion: 3, OutputPerMillion: 15, CacheReadPerMillion: 0.3, ContextLength: 200000}
+
+func TestRegistryRestoresSnapshot(t *testing.T) {
+	store := &memoryStore{}
+	online := NewRegistry(func(context.Context) ([]ModelInfo, error) { return []ModelInfo{sonnet}, nil }, store)
+	if err := online.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	offline := NewRegistry(func(context.Context) ([]ModelInfo, error) { return nil, errors.New("no network") }, store)
+	if err := offline.LoadSnapshot(); err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	if err := offline.Refresh(context.Background()); err == nil {
+		t.Error("Refresh succeeded without a network")
+	}
+	if info, ok := offline.Lookup("sonnet"); !ok || info != sonnet {
+		t.Errorf("Lookup = %+v, %v, want the snapshot kept after a failed refresh", info, ok)
+	}
+}
+
+func TestRegistryCosts(t *testing.T) {
+	registry := NewRegistry(func(context.Context) ([]ModelInfo, error) {
+		return []ModelInfo{sonnet, {ID: "free", ContextLength: 8192}}, nil
+	}, nil)
+	if err := registry.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	overrides := filepath.Join(t.TempDir(), "pricing.json")
+	if err := os.WriteFile(overrides, []byte(`{"sonnet":{"output_per_million":10},"ollama:qwen2.5":{"input_per_million":0.1,"output_per_million":0.2}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.LoadOverrides(overrides); err != nil {
+		t.Fatalf("LoadOverrides: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		model      string
+		usage      Usage
+		wantInput  float64
+		wantOutput float64
+		wantOK     bool
+	}{
+		{name: "cached input", model: "sonnet", usage: Usage{Input: 1_000_000, Output: 1_000_000, CacheRead: 500_000}, wantInput: 1.65, wantOutput: 10, wantOK: true},
+		{name: "cache write falls back to the input rate", model: "sonnet", usage: Usage{Input: 1_000_000, CacheWrite: 1_000_000}, wantInput: 3, wantOK: true},
+		{name: "override only", model: "ollama:qwen2.5", usage: Usage{Input: 1_000_000, Output: 1_000_000}, wantInput: 0.1, wantOutput: 0.2, wantOK: true},
+		{name: "listed without prices", model: "free", usage: Usage{Input: 100}},
+		{name: "unknown model", model: "nobody/knows", usage: Usage{Input: 100, Output: 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, output, ok := registry.Costs(tt.model, tt.usage)
+			if ok != tt.wantOK || math.Abs(input-tt.wantInput) > 1e-9 || math.Abs(output-tt.wantOutput) > 1e-9 {
+				t.Errorf("Costs = %v, %v, %v, want %v, %v, %v", input, output, ok, tt.wantInput, tt.wantOutput, tt.wantOK)
+			}
+		})
+	}
+
+	if got := registry.ContextLength("nobody/knows"); got != 0 {
+		t.Errorf("ContextLength of an unknown model = %d, want 0", got)
+	}
+	if got := registry.ContextLength("free"); got != 8192 {
+		t.Errorf("ContextLength = %d, want 8192", got)
+	}
+}
@@ -0,0 +1,37 @@
+package pricing
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SQLiteStore keeps the snapshot in the model_pricing table, which must be migrated
+// along with the other models.
+type SQLiteStore struct {
+	db *gorm.DB
+}
+
+func NewSQLiteStore(db *gorm.DB) *SQLiteStore {
+	return &SQLiteStore{db: db}
+}
+
+func (s *SQLiteStore) Load() ([]ModelInfo, error) {
+	var models []ModelInfo
+	if err := s.db.Find(&models).Error; err != nil {
+		return nil, err
+	}
+	return models, nil
+}
+
+// Save replaces the snapshot, dropping models that are no longer listed.
+func (s *SQLiteStore) Save(models []ModelInfo) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&ModelInfo{}).Error; err != nil {
+			return err
+		}
+		if len(models) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(models, 200).Error
+	})
+}
@@ -0,0 +1,45 @@
+package pricing
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSQLiteStoreRestoresSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pricing.db")
+	open := func() *SQLiteStore {
+		db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.AutoMigrate(&ModelInfo{}); err != nil {
+			t.Fatal(err)
+		}
+		return NewSQLiteStore(db)
+	}
+
+	store := open()
+	if err := store.Save([]ModelInfo{sonnet, {ID: "retired", InputPerMillion: 1}}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	updated := sonnet
+	updated.OutputPerMillion = 10
+	if err := store.Save([]ModelInfo{updated}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// A restarted worker prices calls from the last snapshot alone.
+	registry := NewRegistry(nil, open())
+	if err := registry.LoadSnapshot(); err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	if info, ok := registry.Lookup("sonnet"); !ok || info.OutputPerMillion != 10 || info.ContextLength != sonnet.ContextLength {
+		t.Errorf("Lookup = %+v, %v, want the latest snapshot", info, ok)
+	}
+	if _, ok := registry.Lookup("retired"); ok {
+		t.Error("a model dropped from the list survived the snapshot")
+	}
+}
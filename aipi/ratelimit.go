@@ -0,0 +1,128 @@
+package aipi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimit caps traffic to a provider or model. Zero leaves that dimension unlimited.
+type RateLimit struct {
+	RequestsPerMinute int `json:"requests_per_minute"`
+	TokensPerMinute   int `json:"tokens_per_minute"`
+}
+
+// rateLimiter holds one token bucket per provider and one per model, shared by
+// every caller of the client. A request waits on both its provider's and its
+// model's bucket.
+type rateLimiter struct {
+	limits  map[string]RateLimit
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	requests *rate.Limiter
+	tokens   *rate.Limiter
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+func newRateLimiter(limits map[string]RateLimit) *rateLimiter {
+	return &rateLimiter{limits: limits, buckets: map[string]*bucket{}}
+}
+
+// wait blocks until the provider and model buckets admit a request of roughly
+// tokens tokens, and returns how long that took.
+func (l *rateLimiter) wait(ctx context.Context, provider, model string, tokens int) (time.Duration, error) {
+	startedAt := time.Now()
+	for _, b := range []*bucket{l.get(provider), l.get(model)} {
+		if err := b.wait(ctx, tokens); err != nil {
+			return time.Since(startedAt), err
+		}
+	}
+	return time.Since(startedAt), nil
+}
+
+// record charges the model's buckets for tokens used beyond the estimate they
+// were admitted with. Overestimates are not refunded.
+func (l *rateLimiter) record(provider, model string, estimated, actual int) {
+	if actual <= estimated {
+		return
+	}
+	for _, b := range []*bucket{l.get(provider), l.get(model)} {
+		if b.tokens != nil {
+			b.tokens.ReserveN(time.Now(), min(actual-estimated, b.tokens.Burst()))
+		}
+	}
+}
+
+// pause holds back the model's bucket after a 429 for as long as the provider
+// asked. Other models on the same provider keep going.
+func (l *rateLimiter) pause(model string, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	b := l.get(model)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until := time.Now().Add(d); until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+}
+
+func (l *rateLimiter) get(key string) *bucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = newBucket(l.limits[key])
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// newBucket lets a full minute's allowance through at once, then refills evenly.
+func newBucket(limit RateLimit) *bucket {
+	b := &bucket{}
+	if limit.RequestsPerMinute > 0 {
+		b.requests = rate.NewLimiter(rate.Limit(float64(limit.RequestsPerMinute)/60), limit.RequestsPerMinute)
+	}
+	if limit.TokensPerMinute > 0 {
+		b.tokens = rate.NewLimiter(rate.Limit(float64(limit.TokensPerMinute)/60), limit.TokensPerMinute)
+	}
+	return b
+}
+
+func (b *bucket) wait(ctx context.Context, tokens int) error {
+	b.mu.Lock()
+	pause := time.Until(b.pausedUntil)
+	b.mu.Unlock()
+
+	if pause > 0 {
+		timer := time.NewTimer(pause)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if b.requests != nil {
+		if err := b.requests.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if b.tokens != nil && tokens > 0 {
+		// A request bigger than the whole bucket waits for a full bucket instead of failing.
+		if err := b.tokens.WaitN(ctx, min(tokens, b.tokens.Burst())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package aipi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SomtoJF/iris-worker/aipi/types"
+)
+
+// waitBriefly waits on l with a short deadline and reports whether it was admitted.
+func waitBriefly(l *rateLimiter, provider, model string, tokens int) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := l.wait(ctx, provider, model, tokens)
+	return err == nil
+}
+
+func TestRateLimiterRequests(t *testing.T) {
+	limiter := newRateLimiter(map[string]RateLimit{"openrouter": {RequestsPerMinute: 2}})
+
+	if !waitBriefly(limiter, "openrouter", "a", 0) || !waitBriefly(limiter, "openrouter", "b", 0) {
+		t.Fatal("a minute's allowance wasn't admitted at once")
+	}
+	if waitBriefly(limiter, "openrouter", "a", 0) {
+		t.Error("a third request was admitted within the minute")
+	}
+	if !waitBriefly(limiter, "ollama", "a", 0) {
+		t.Error("a provider without a limit was held back")
+	}
+}
+
+func TestRateLimiterTokens(t *testing.T) {
+	limiter := newRateLimiter(map[string]RateLimit{"m": {TokensPerMinute: 1000}})
+
+	// A request bigger than the bucket waits for a full bucket instead of failing.
+	if !waitBriefly(limiter, "openrouter", "m", 5000) {
+		t.Fatal("an oversized request was refused on a full bucket")
+	}
+	if waitBriefly(limiter, "openrouter", "m", 100) {
+		t.Error("a request was admitted on an empty bucket")
+	}
+
+	limiter = newRateLimiter(map[string]RateLimit{"m": {TokensPerMinute: 1000}})
+	if !waitBriefly(limiter, "openrouter", "m", 100) {
+		t.Fatal("a request within the bucket was refused")
+	}
+	limiter.record("openrouter", "m", 100, 1000)
+	if waitBriefly(limiter, "openrouter", "m", 100) {
+		t.Error("tokens used beyond the estimate weren't charged")
+	}
+}
+
+func TestRateLimiterPauseOnlyExtends(t *testing.T) {
+	limiter := newRateLimiter(nil)
+	b := limiter.get("m")
+
+	limiter.pause("m", time.Hour)
+	until := b.pausedUntil
+	limiter.pause("m", time.Second)
+	if !b.pausedUntil.Equal(until) {
+		t.Errorf("a shorter pause moved the end from %v to %v", until, b.pausedUntil)
+	}
+	limiter.pause("m", 2*time.Hour)
+	if !b.pausedUntil.After(until) {
+		t.Error("a longer pause didn't extend the wait")
+	}
+
+	if waitBriefly(limiter, "openrouter", "m", 0) {
+		t.Error("a paused model was admitted")
+	}
+	if !waitBriefly(limiter, "openrouter", "other", 0) {
+		t.Error("pausing one model held back another")
+	}
+}
+
+func TestRateLimiterWaitCancelled(t *testing.T) {
+	limiter := newRateLimiter(nil)
+	limiter.pause("m", time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	startedAt := time.Now()
+	_, err := limiter.wait(ctx, "openrouter", "m", 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if waited := time.Since(startedAt); waited > time.Second {
+		t.Errorf("waited %v after cancellation", waited)
+	}
+}
+
+// rateLimitedAIPI answers every request with a 429 carrying retryAfter.
+type rateLimitedAIPI struct {
+	retryAfter time.Duration
+}
+
+func (p rateLimitedAIPI) GetCompletion(ctx context.Context, req types.AIPIRequest) (types.AIPIResponse, error) {
+	return types.AIPIResponse{}, &types.ProviderError{StatusCode: http.StatusTooManyRequests, RetryAfter: p.retryAfter, Err: errors.New("rate limited")}
+}
+
+func TestClientPausesAfterRateLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter time.Duration
+		want       time.Duration
+	}{
+		{name: "hinted", retryAfter: time.Minute, want: time.Minute},
+		{name: "no hint", want: defaultRateLimitPause},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewAIPIClient(nil, nil, Config{})
+			client.RegisterProvider("fake", rateLimitedAIPI{retryAfter: tt.retryAfter})
+
+			startedAt := time.Now()
+			if _, err := client.GetCompletion(context.Background(), types.AIPIRequest{Model: "fake:m"}); err == nil {
+				t.Fatal("GetCompletion succeeded")
+			}
+			pause := client.limiter.get("fake:m").pausedUntil.Sub(startedAt)
+			if pause < tt.want || pause > tt.want+time.Second {
+				t.Errorf("paused for %v, want %v", pause, tt.want)
+			}
+		})
+	}
+}
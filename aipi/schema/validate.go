@@ -0,0 +1,283 @@
+// Package schema validates decoded JSON against the subset of JSON Schema that
+// structured outputs use: type, properties, required, additionalProperties,
+// items, enum and nullable. Annotations such as title and description are
+// allowed and ignored. Any other keyword, such as anyOf, $ref, minimum, pattern
+// or format, makes the schema unsupported rather than silently unchecked.
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ErrUnsupportedSchema is returned for a schema that uses keywords outside the
+// supported subset.
+var ErrUnsupportedSchema = errors.New("unsupported schema")
+
+// keywords are the keywords a supported schema may use. The false ones are
+// annotations that don't constrain values.
+var keywords = map[string]bool{
+	"type":                 true,
+	"properties":           true,
+	"required":             true,
+	"additionalProperties": true,
+	"items":                true,
+	"enum":                 true,
+	"nullable":             true,
+	"$schema":              false,
+	"$comment":             false,
+	"title":                false,
+	"description":          false,
+	"default":              false,
+	"examples":             false,
+}
+
+// Check reports an ErrUnsupportedSchema for the first keyword in schema that
+// Validate would not check.
+func Check(schema map[string]interface{}) error {
+	normalized, err := normalize(schema)
+	if err != nil {
+		return err
+	}
+	return checkKeywords(normalized, "$")
+}
+
+// Validate returns one message per violation, each prefixed with the JSON path
+// of the offending value. An empty result means data conforms to schema. A
+// schema Check rejects is an error.
+func Validate(schema map[string]interface{}, data interface{}) ([]string, error) {
+	normalized, err := normalize(schema)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKeywords(normalized, "$"); err != nil {
+		return nil, err
+	}
+
+	errs := []string{}
+	validate(normalized, data, "$", &errs)
+	return errs, nil
+}
+
+// normalize round-trips the schema through JSON so hand-built schemas using
+// []string or nested Go maps look the same as decoded ones.
+func normalize(schema map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	normalized := map[string]interface{}{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return normalized, nil
+}
+
+func checkKeywords(schema map[string]interface{}, path string) error {
+	keys := make([]string, 0, len(schema))
+	for key := range schema {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, known := keywords[key]; !known {
+			return fmt.Errorf("%w: %s uses %q", ErrUnsupportedSchema, path, key)
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if property, ok := properties[name].(map[string]interface{}); ok {
+			if err := checkKeywords(property, path+"."+name); err != nil {
+				return err
+			}
+		}
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		if err := checkKeywords(items, path+"[]"); err != nil {
+			return err
+		}
+	}
+	if additional, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+		if err := checkKeywords(additional, path+".*"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsStrict reports whether schema meets what providers require of strict
+// structured outputs: every object sets additionalProperties to false and lists
+// all of its properties as required.
+func IsStrict(schema map[string]interface{}) bool {
+	normalized, err := normalize(schema)
+	if err != nil {
+		return false
+	}
+	return isStrict(normalized)
+}
+
+func isStrict(schema map[string]interface{}) bool {
+	properties, hasProperties := schema["properties"].(map[string]interface{})
+	if hasProperties || allowsType(schema, "object") {
+		if schema["additionalProperties"] != false {
+			return false
+		}
+		required := map[string]bool{}
+		names, _ := schema["required"].([]interface{})
+		for _, name := range names {
+			if key, ok := name.(string); ok {
+				required[key] = true
+			}
+		}
+		for key, property := range properties {
+			propertySchema, ok := property.(map[string]interface{})
+			if !required[key] || !ok || !isStrict(propertySchema) {
+				return false
+			}
+		}
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok && !isStrict(items) {
+		return false
+	}
+	return true
+}
+
+func validate(schema map[string]interface{}, data interface{}, path string, errs *[]string) {
+	if data == nil && (schema["nullable"] == true || allowsType(schema, "null")) {
+		return
+	}
+
+	if types := schemaTypes(schema); len(types) > 0 && !matchesAnyType(types, data) {
+		*errs = append(*errs, fmt.Sprintf("%s: expected %v, got %s", path, types, jsonType(data)))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok && !containsValue(enum, data) {
+		*errs = append(*errs, fmt.Sprintf("%s: %v is not one of %v", path, data, enum))
+	}
+
+	switch value := data.(type) {
+	case map[string]interface{}:
+		validateObject(schema, value, path, errs)
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range value {
+				validate(items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	}
+}
+
+func validateObject(schema map[string]interface{}, value map[string]interface{}, path string, errs *[]string) {
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			key, _ := name.(string)
+			if _, exists := value[key]; !exists {
+				*errs = append(*errs, fmt.Sprintf("%s: missing required property %q", path, key))
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		propertySchema, known := properties[key].(map[string]interface{})
+		if known {
+			validate(propertySchema, value[key], path+"."+key, errs)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				*errs = append(*errs, fmt.Sprintf("%s: unexpected property %q", path, key))
+			}
+		case map[string]interface{}:
+			validate(additional, value[key], path+"."+key, errs)
+		}
+	}
+}
+
+func schemaTypes(schema map[string]interface{}) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := []string{}
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func allowsType(schema map[string]interface{}, want string) bool {
+	for _, t := range schemaTypes(schema) {
+		if t == want {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyType(types []string, data interface{}) bool {
+	actual := jsonType(data)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonType(data interface{}) string {
+	switch value := data.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", data)
+}
+
+// containsValue only matches scalars; objects and arrays never equal an enum entry.
+func containsValue(values []interface{}, data interface{}) bool {
+	switch data.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+	for _, value := range values {
+		if value == data {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package schema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var applicant = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"name":   map[string]interface{}{"type": "string", "description": "Full name"},
+		"years":  map[string]interface{}{"type": "integer"},
+		"status": map[string]interface{}{"type": "string", "enum": []string{"new", "screened"}},
+		"skills": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		"phone":  map[string]interface{}{"type": []string{"string", "null"}},
+	},
+	"required":             []string{"name", "years", "status", "skills", "phone"},
+	"additionalProperties": false,
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		want []string
+	}{
+		{
+			name: "conforms",
+			data: map[string]interface{}{"name": "Jane", "years": 4.0, "status": "new", "skills": []interface{}{"go"}, "phone": nil},
+		},
+		{
+			name: "violations",
+			data: map[string]interface{}{"name": 1.0, "years": 4.5, "status": "hired", "skills": []interface{}{"go", 2.0}, "extra": true},
+			want: []string{
+				`$: missing required property "phone"`,
+				`$: unexpected property "extra"`,
+				`$.name: expected [string], got integer`,
+				`$.skills[1]: expected [string], got integer`,
+				`$.status: hired is not one of [new screened]`,
+				`$.years: expected [integer], got number`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Validate(applicant, tt.data)
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("violations:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestCheckRejectsUnsupportedKeywords(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema map[string]interface{}
+		want   string
+	}{
+		{name: "anyOf", schema: map[string]interface{}{"anyOf": []interface{}{}}, want: `$ uses "anyOf"`},
+		{name: "$ref", schema: map[string]interface{}{"$ref": "#/$defs/a"}, want: `$ uses "$ref"`},
+		{
+			name:   "nested minimum",
+			schema: map[string]interface{}{"type": "object", "properties": map[string]interface{}{"age": map[string]interface{}{"type": "integer", "minimum": 18}}},
+			want:   `$.age uses "minimum"`,
+		},
+		{
+			name:   "pattern in items",
+			schema: map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "pattern": "^a"}},
+			want:   `$[] uses "pattern"`,
+		},
+		{name: "format", schema: map[string]interface{}{"type": "string", "format": "email"}, want: `$ uses "format"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(tt.schema)
+			if !errors.Is(err, ErrUnsupportedSchema) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Check = %v, want %v naming %s", err, ErrUnsupportedSchema, tt.want)
+			}
+			if _, err := Validate(tt.schema, "anything"); !errors.Is(err, ErrUnsupportedSchema) {
+				t.Errorf("Validate = %v, want %v", err, ErrUnsupportedSchema)
+			}
+		})
+	}
+
+	if err := Check(applicant); err != nil {
+		t.Errorf("Check(applicant) = %v", err)
+	}
+}
+
+func TestIsStrict(t *testing.T) {
+	object := func(additional interface{}, required ...string) map[string]interface{} {
+		return map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"name": map[string]interface{}{"type": "string"},
+				"tags": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			},
+			"required":             required,
+			"additionalProperties": additional,
+		}
+	}
+	nested := object(false, "name", "tags")
+	nested["properties"].(map[string]interface{})["tags"] = map[string]interface{}{"type": "array", "items": object(false, "name")}
+
+	tests := []struct {
+		name   string
+		schema map[string]interface{}
+		want   bool
+	}{
+		{name: "closed and all required", schema: object(false, "name", "tags"), want: true},
+		{name: "optional property", schema: object(false, "name")},
+		{name: "open object", schema: object(true, "name", "tags")},
+		{name: "additionalProperties unset", schema: object(nil, "name", "tags")},
+		{name: "optional property in nested item", schema: nested},
+		{name: "not an object", schema: map[string]interface{}{"type": "string"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsStrict(tt.schema); got != tt.want {
+				t.Errorf("IsStrict = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package aipi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/SomtoJF/iris-worker/aipi/schema"
+	"github.com/SomtoJF/iris-worker/aipi/types"
+	"github.com/revrost/go-openrouter/jsonschema"
+)
+
+// ErrSchemaViolation is returned by CompleteStructured when the model's answer
+// still fails validation after being shown its mistakes.
+var ErrSchemaViolation = errors.New("response does not match schema")
+
+// SchemaFor generates a JSON Schema document from T's struct fields and json tags.
+// Fields tagged omitempty are optional; description and enum tags are honored.
+func SchemaFor[T any]() (map[string]interface{}, error) {
+	definition, err := jsonschema.GenerateSchema[T]()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate schema: %w", err)
+	}
+
+	data, err := json.Marshal(definition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode schema: %w", err)
+	}
+
+	document := map[string]interface{}{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to encode schema: %w", err)
+	}
+	return document, nil
+}
+
+// CompleteStructured asks for a response matching T's schema, validates it and
+// decodes it into T. If the model returns invalid JSON it is asked once more with
+// the validation errors. The returned response sums usage over both attempts.
+// A ResponseSchema already set on req is used instead of the generated one; it
+// must stay within the subset the schema package checks, or no request is made.
+// onDelta, if not nil, receives each attempt's output as it streams.
+func CompleteStructured[T any](ctx context.Context, client types.AIPI, req types.AIPIRequest, onDelta types.StreamHandler) (T, types.AIPIResponse, error) {
+	var result T
+
+	if req.ResponseSchema == nil {
+		document, err := SchemaFor[T]()
+		if err != nil {
+			return result, types.AIPIResponse{}, err
+		}
+		req.ResponseSchema = document
+	}
+	if err := schema.Check(req.ResponseSchema); err != nil {
+		return result, types.AIPIResponse{}, err
+	}
+
+	resp, err := types.Complete(ctx, client, req, onDelta)
+	if err != nil {
+		return result, types.AIPIResponse{}, err
+	}
+
+	problems, err := decodeStructured(req.ResponseSchema, resp.Content, &result)
+	if err != nil || len(problems) == 0 {
+		return result, resp, err
+	}
+
+	retry := req
+	retry.Messages = append(append([]types.Message{}, req.AllMessages()...),
+		types.Message{Role: types.MessageRoleAssistant, Parts: []types.ContentPart{types.TextPart(resp.Content)}},
+		types.Message{Role: types.MessageRoleUser, Parts: []types.ContentPart{types.TextPart(
+			"Your response did not match the required JSON schema:\n- " + strings.Join(problems, "\n- ") +
+				"\nRespond again with only the corrected JSON.")}},
+	)
+	retry.SystemMessage = ""
+	retry.UserMessage = ""
+	retry.ImageUrl = nil
+
+	retryResp, err := types.Complete(ctx, client, retry, onDelta)
+	if err != nil {
+		return result, resp, err
+	}
+	combined := addUsage(resp, retryResp)
+
+	problems, err = decodeStructured(req.ResponseSchema, retryResp.Content, &result)
+	if err != nil {
+		return result, combined, err
+	}
+	if len(problems) > 0 {
+		return result, combined, fmt.Errorf("%w after retry: %s", ErrSchemaViolation, strings.Join(problems, "; "))
+	}
+	return result, combined, nil
+}
+
+// decodeStructured returns schema violations for content, or decodes it into v
+// when there are none. Only an unusable schema is reported as an error.
+func decodeStructured(document map[string]interface{}, content string, v interface{}) ([]string, error) {
+	content = strings.TrimSpace(content)
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimSuffix(strings.TrimPrefix(content, "```"), "```")
+
+	var data interface{}
+	if err := json.Unmarshal([]byte(content), &data); err != nil {
+		return []string{fmt.Sprintf("response is not valid JSON: %v", err)}, nil
+	}
+
+	problems, err := schema.Validate(document, data)
+	if err != nil || len(problems) > 0 {
+		return problems, err
+	}
+
+	if err := json.Unmarshal([]byte(content), v); err != nil {
+		return []string{fmt.Sprintf("response does not decode into the expected type: %v", err)}, nil
+	}
+	return nil, nil
+}
+
+// addUsage returns latest with token counts and costs summed over both responses.
+func addUsage(first, latest types.AIPIResponse) types.AIPIResponse {
+	latest.InputTokens += first.InputTokens
+	latest.OutputTokens += first.OutputTokens
+	latest.CacheReadTokens += first.CacheReadTokens
+	latest.CacheWriteTokens += first.CacheWriteTokens
+	latest.InputCost += first.InputCost
+	latest.OutputCost += first.OutputCost
+	latest.TotalCost += first.TotalCost
+	return latest
+}
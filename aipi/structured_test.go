@@ -0,0 +1,86 @@
+package aipi
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/SomtoJF/iris-worker/aipi/aipitest"
+	"github.com/SomtoJF/iris-worker/aipi/schema"
+	"github.com/SomtoJF/iris-worker/aipi/types"
+)
+
+type applicant struct {
+	Name  string `json:"name"`
+	Years int    `json:"years"`
+}
+
+func TestCompleteStructured(t *testing.T) {
+	tests := []struct {
+		name      string
+		contents  []string
+		want      applicant
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "valid answer", contents: []string{`{"name":"Jane","years":4}`}, want: applicant{"Jane", 4}, wantCalls: 1},
+		{name: "fenced answer", contents: []string{"```json\n{\"name\":\"Jane\",\"years\":4}\n```"}, want: applicant{"Jane", 4}, wantCalls: 1},
+		{name: "fixed on retry", contents: []string{`{"name":"Jane","years":"four"}`, `{"name":"Jane","years":4}`}, want: applicant{"Jane", 4}, wantCalls: 2},
+		{name: "not json, then fixed", contents: []string{"Jane, 4 years", `{"name":"Jane","years":4}`}, want: applicant{"Jane", 4}, wantCalls: 2},
+		{name: "wrong twice", contents: []string{`{"name":"Jane"}`, `{"years":4}`}, wantCalls: 2, wantErr: ErrSchemaViolation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := aipitest.Contents(tt.contents...)
+			for i := range client.Responses {
+				client.Responses[i].InputTokens, client.Responses[i].OutputTokens = 10, 5
+			}
+			got, resp, err := CompleteStructured[applicant](context.Background(), client, types.AIPIRequest{Model: "m", UserMessage: "who applied?"}, nil)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("CompleteStructured: %v", err)
+			} else if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+
+			requests := client.Requests()
+			if len(requests) != tt.wantCalls {
+				t.Fatalf("made %d calls, want %d", len(requests), tt.wantCalls)
+			}
+			if requests[0].ResponseSchema == nil {
+				t.Error("request was sent without a response schema")
+			}
+			if resp.InputTokens != 10*tt.wantCalls || resp.OutputTokens != 5*tt.wantCalls {
+				t.Errorf("usage = %d/%d, want it summed over %d calls", resp.InputTokens, resp.OutputTokens, tt.wantCalls)
+			}
+			if tt.wantCalls > 1 {
+				retry := requests[1].Messages
+				if len(retry) != 3 || retry[1].Role != types.MessageRoleAssistant || !strings.Contains(retry[2].Parts[0].Text, "did not match") {
+					t.Errorf("retry messages = %+v, want the first answer and what was wrong with it", retry)
+				}
+			}
+		})
+	}
+}
+
+func TestCompleteStructuredUnsupportedSchema(t *testing.T) {
+	client := aipitest.Contents(`{"name":"Jane"}`)
+	req := types.AIPIRequest{
+		Model:       "m",
+		UserMessage: "who applied?",
+		ResponseSchema: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"name": map[string]interface{}{"type": "string", "pattern": "^[A-Z]"}},
+		},
+	}
+	if _, _, err := CompleteStructured[applicant](context.Background(), client, req, nil); !errors.Is(err, schema.ErrUnsupportedSchema) {
+		t.Errorf("err = %v, want %v", err, schema.ErrUnsupportedSchema)
+	}
+	if requests := client.Requests(); len(requests) != 0 {
+		t.Errorf("made %d calls with a schema that can't be checked", len(requests))
+	}
+}
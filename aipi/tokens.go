@@ -0,0 +1,124 @@
+package aipi
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+
+	"github.com/SomtoJF/iris-worker/aipi/types"
+)
+
+// Token estimates err on the high side: they decide what to cut from a prompt,
+// and overshooting costs a little detail while undershooting fails the request.
+
+// defaultOutputEstimate stands in for the output of requests without MaxTokens.
+const defaultOutputEstimate = 1024
+
+// EstimateTextTokens approximates how many tokens model's tokenizer produces for text.
+func EstimateTextTokens(model, text string) int {
+	if text == "" {
+		return 0
+	}
+	return int(math.Ceil(float64(len(text)) / charsPerToken(model)))
+}
+
+// EstimateImageTokens approximates what an image of the given size costs as input,
+// following each provider family's published sizing rules.
+func EstimateImageTokens(model string, width, height int) int {
+	if width <= 0 || height <= 0 {
+		return 0
+	}
+
+	switch modelFamily(model) {
+	case "anthropic":
+		// Images are scaled to at most 1568px on the long edge, then cost w*h/750.
+		width, height = ScaleToFit(width, height, 1568)
+		return int(math.Ceil(float64(width*height) / 750))
+	case "google":
+		// Small images are one tile; larger ones are cut into 768px tiles.
+		if width <= 384 && height <= 384 {
+			return 258
+		}
+		return tiles(width, 768) * tiles(height, 768) * 258
+	default:
+		// OpenAI high detail: fit in 2048px, shrink the short side to 768px, then
+		// charge per 512px tile. Also the fallback since it prices highest.
+		width, height = ScaleToFit(width, height, 2048)
+		if short := min(width, height); short > 768 {
+			width = width * 768 / short
+			height = height * 768 / short
+		}
+		return 85 + 170*tiles(width, 512)*tiles(height, 512)
+	}
+}
+
+// EstimateToolTokens approximates the prompt space taken by tool definitions.
+func EstimateToolTokens(model string, tools []types.ToolDefinition) int {
+	if len(tools) == 0 {
+		return 0
+	}
+	data, err := json.Marshal(tools)
+	if err != nil {
+		return 0
+	}
+	return EstimateTextTokens(model, string(data))
+}
+
+// EstimateRequestTokens approximates the tokens a request consumes, counting its
+// output allowance. Image sizes aren't known here, so each image is priced as a
+// full-HD screenshot.
+func EstimateRequestTokens(req types.AIPIRequest) int {
+	tokens := EstimateToolTokens(req.Model, req.Tools)
+	for _, message := range req.AllMessages() {
+		for _, part := range message.Parts {
+			switch part.Type {
+			case types.ContentPartTypeText:
+				tokens += EstimateTextTokens(req.Model, part.Text)
+			case types.ContentPartTypeImage:
+				tokens += EstimateImageTokens(req.Model, 1920, 1080)
+			}
+		}
+		for _, call := range message.ToolCalls {
+			tokens += EstimateTextTokens(req.Model, call.Arguments)
+		}
+	}
+
+	if req.MaxTokens != nil {
+		return tokens + *req.MaxTokens
+	}
+	return tokens + defaultOutputEstimate
+}
+
+// ScaleToFit shrinks width and height proportionally so neither exceeds maxDimension.
+// Images already within bounds, and a maxDimension of zero, leave them unchanged.
+func ScaleToFit(width, height, maxDimension int) (int, int) {
+	longest := max(width, height)
+	if maxDimension <= 0 || longest <= maxDimension {
+		return width, height
+	}
+	return max(1, width*maxDimension/longest), max(1, height*maxDimension/longest)
+}
+
+func charsPerToken(model string) float64 {
+	if modelFamily(model) == "anthropic" {
+		return 3.5
+	}
+	return 4
+}
+
+// modelFamily reads the vendor from ids like "google/gemini-2.5-flash" or
+// "anthropic:claude-sonnet-4".
+func modelFamily(model string) string {
+	model = strings.ToLower(model)
+	switch {
+	case strings.HasPrefix(model, "anthropic"), strings.Contains(model, "claude"):
+		return "anthropic"
+	case strings.HasPrefix(model, "google/"), strings.Contains(model, "gemini"):
+		return "google"
+	}
+	return "openai"
+}
+
+func tiles(length, tileSize int) int {
+	return (length + tileSize - 1) / tileSize
+}
@@ -0,0 +1,91 @@
+package types
+
+type MessageRole string
+
+const (
+	MessageRoleSystem    MessageRole = "system"
+	MessageRoleUser      MessageRole = "user"
+	MessageRoleAssistant MessageRole = "assistant"
+	MessageRoleTool      MessageRole = "tool"
+)
+
+type ContentPartType string
+
+const (
+	ContentPartTypeText  ContentPartType = "text"
+	ContentPartTypeImage ContentPartType = "image"
+)
+
+// ContentPart is one piece of a message. ImageUrl follows the same rules as
+// AIPIRequest.ImageUrl: a url or a base64 data url.
+type ContentPart struct {
+	Type     ContentPartType `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageUrl string          `json:"image_url,omitempty"`
+	// MaxImageDimension asks for a local image to be downscaled so neither side
+	// exceeds it before sending. Zero sends the image as is.
+	MaxImageDimension int `json:"max_image_dimension,omitempty"`
+	// Cacheable ends a cacheable prefix: the conversation up to and including this
+	// part may be served from the provider's prompt cache on later requests.
+	// Providers without prompt caching ignore it.
+	Cacheable bool `json:"cacheable,omitempty"`
+}
+
+type Message struct {
+	Role  MessageRole   `json:"role"`
+	Parts []ContentPart `json:"parts"`
+	// ToolCalls are the calls an assistant turn made; ToolCallID ties a tool turn
+	// to the call it answers.
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: ContentPartTypeText, Text: text}
+}
+
+// CacheableTextPart is a text part that ends a cacheable prefix.
+func CacheableTextPart(text string) ContentPart {
+	return ContentPart{Type: ContentPartTypeText, Text: text, Cacheable: true}
+}
+
+func ImagePart(imageUrl string) ContentPart {
+	return ContentPart{Type: ContentPartTypeImage, ImageUrl: imageUrl}
+}
+
+// Text concatenates the message's text parts.
+func (m Message) Text() string {
+	text := ""
+	for _, part := range m.Parts {
+		if part.Type == ContentPartTypeText {
+			text += part.Text
+		}
+	}
+	return text
+}
+
+// AllMessages expands the request into one ordered conversation: the shorthand
+// system message first, then Messages, then the shorthand user turn. Providers map
+// this instead of reading the shorthand fields themselves.
+func (r AIPIRequest) AllMessages() []Message {
+	messages := []Message{}
+
+	if r.SystemMessage != "" {
+		system := TextPart(r.SystemMessage)
+		system.Cacheable = r.CacheSystemMessage
+		messages = append(messages, Message{Role: MessageRoleSystem, Parts: []ContentPart{system}})
+	}
+
+	messages = append(messages, r.Messages...)
+
+	hasImage := r.ImageUrl != nil && *r.ImageUrl != ""
+	if r.UserMessage != "" || hasImage || len(r.Messages) == 0 {
+		user := Message{Role: MessageRoleUser, Parts: []ContentPart{TextPart(r.UserMessage)}}
+		if hasImage {
+			user.Parts = append(user.Parts, ImagePart(*r.ImageUrl))
+		}
+		messages = append(messages, user)
+	}
+
+	return messages
+}
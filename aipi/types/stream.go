@@ -0,0 +1,23 @@
+package types
+
+import "context"
+
+// StreamHandler receives each fragment of output as the model produces it: content
+// text, or tool call arguments when the model answers with a tool call.
+type StreamHandler func(delta string)
+
+// StreamingAIPI is implemented by clients that can deliver a completion as it is
+// generated. The returned response is the same one GetCompletion would return.
+type StreamingAIPI interface {
+	AIPI
+	StreamCompletion(ctx context.Context, req AIPIRequest, onDelta StreamHandler) (AIPIResponse, error)
+}
+
+// Complete streams req through client when onDelta is set and the client supports
+// it, and otherwise makes a single GetCompletion call.
+func Complete(ctx context.Context, client AIPI, req AIPIRequest, onDelta StreamHandler) (AIPIResponse, error) {
+	if streamer, ok := client.(StreamingAIPI); ok && onDelta != nil {
+		return streamer.StreamCompletion(ctx, req, onDelta)
+	}
+	return client.GetCompletion(ctx, req)
+}
@@ -0,0 +1,26 @@
+package types
+
+// ToolDefinition describes a function the model may call. Parameters is a JSON
+// Schema object describing the arguments.
+type ToolDefinition struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+// ToolChoice is "auto", "none", "required", or the name of a tool the model must call.
+type ToolChoice string
+
+const (
+	ToolChoiceAuto     ToolChoice = "auto"
+	ToolChoiceNone     ToolChoice = "none"
+	ToolChoiceRequired ToolChoice = "required"
+)
+
+// ToolCall is a function call requested by the model. Arguments is the raw JSON
+// the model produced.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
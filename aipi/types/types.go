@@ -2,29 +2,142 @@ package types
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// UseCase names what a completion is for, so the client can pick a fallback chain.
+type UseCase string
+
+const (
+	UseCasePlanner    UseCase = "planner"
+	UseCaseExtraction UseCase = "extraction"
+	UseCaseWriting    UseCase = "writing"
+)
+
+// AIPIRequest takes either the SystemMessage/UserMessage/ImageUrl shorthand for a
+// single turn, an ordered Messages conversation, or both; see AllMessages.
 type AIPIRequest struct {
-	SystemMessage string `json:"system_message"`
-	UserMessage   string `json:"user_message"`
-	Model         string `json:"model"`
+	SystemMessage string    `json:"system_message"`
+	UserMessage   string    `json:"user_message"`
+	Messages      []Message `json:"messages,omitempty"`
+	Model         string    `json:"model"`
+	UseCase       UseCase   `json:"use_case,omitempty"`
 	// ImageUrl can either be a url or a base64 encoded image
-	ImageUrl       *string                `json:"image_url,omitempty"`
-	MaxTokens      *int                   `json:"max_tokens,omitempty"`
+	ImageUrl  *string `json:"image_url,omitempty"`
+	MaxTokens *int    `json:"max_tokens,omitempty"`
+	// ResponseSchema is a JSON Schema document the response must conform to. Use
+	// aipi.SchemaFor to build one from a Go type.
 	ResponseSchema map[string]interface{} `json:"response_schema,omitempty"`
 	Temperature    *float64               `json:"temperature,omitempty"`
+	Tools          []ToolDefinition       `json:"tools,omitempty"`
+	ToolChoice     ToolChoice             `json:"tool_choice,omitempty"`
+	// ParallelToolCalls lets the model return several tool calls at once. Nil leaves
+	// the provider default.
+	ParallelToolCalls *bool `json:"parallel_tool_calls,omitempty"`
+	// BypassCache forces a fresh completion even when a cached one exists.
+	BypassCache bool `json:"bypass_cache,omitempty"`
+	// CacheSystemMessage marks SystemMessage as cacheable, for prompts that repeat
+	// across requests. See ContentPart.Cacheable.
+	CacheSystemMessage bool `json:"cache_system_message,omitempty"`
 }
 
 type AIPIResponse struct {
-	Content      string  `json:"content"`
-	InputTokens  int     `json:"input_tokens,omitempty"`
-	OutputTokens int     `json:"output_tokens,omitempty"`
-	InputCost    float64 `json:"input_cost,omitempty"`
-	OutputCost   float64 `json:"output_cost,omitempty"`
-	TotalCost    float64 `json:"total_cost,omitempty"`
-	Model        string  `json:"model,omitempty"`
+	Content      string     `json:"content"`
+	ToolCalls    []ToolCall `json:"tool_calls,omitempty"`
+	InputTokens  int        `json:"input_tokens,omitempty"`
+	OutputTokens int        `json:"output_tokens,omitempty"`
+	InputCost    float64    `json:"input_cost,omitempty"`
+	OutputCost   float64    `json:"output_cost,omitempty"`
+	TotalCost    float64    `json:"total_cost,omitempty"`
+	Model        string     `json:"model,omitempty"`
+	// CacheReadTokens and CacheWriteTokens are the parts of InputTokens served from
+	// and written to the provider's prompt cache.
+	CacheReadTokens  int `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
+	// RequestedModel is the model the caller asked for. It differs from Model when a
+	// fallback answered instead.
+	RequestedModel string `json:"requested_model,omitempty"`
+	// Cached is set when the response was served from the response cache, in which
+	// case nothing was billed for it.
+	Cached bool `json:"cached,omitempty"`
+	// QueueTime is how long the request waited for the client's rate limiter.
+	QueueTime time.Duration `json:"queue_time,omitempty"`
 }
 
 type AIPI interface {
 	GetCompletion(ctx context.Context, req AIPIRequest) (AIPIResponse, error)
 }
+
+// ProviderError is returned by providers when the upstream API rejects a request,
+// so callers can tell transient failures from bad requests without knowing the provider.
+type ProviderError struct {
+	StatusCode int
+	// RetryAfter is the provider's Retry-After hint, or zero if it sent none.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("provider returned status %d: %v", e.StatusCode, e.Err)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the HTTP status carried by err, or 0 if there is none.
+func StatusCode(err error) int {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.StatusCode
+	}
+	return 0
+}
+
+// RetryAfter returns the Retry-After hint carried by err, or 0 if there is none.
+func RetryAfter(err error) time.Duration {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.RetryAfter
+	}
+	return 0
+}
+
+// ParseRetryAfter reads a Retry-After header, which is either a number of seconds
+// or an HTTP date. Anything unparseable, or a date in the past, yields 0.
+func ParseRetryAfter(header string) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return max(0, time.Duration(seconds)*time.Second)
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return max(0, time.Until(at))
+	}
+	return 0
+}
+
+// SplitDataURL breaks a base64 data URL into its media type and payload. ok is false
+// for anything that isn't a base64 data URL, such as a plain http(s) url.
+func SplitDataURL(url string) (mediaType string, data string, ok bool) {
+	rest, found := strings.CutPrefix(url, "data:")
+	if !found {
+		return "", "", false
+	}
+	header, data, found := strings.Cut(rest, ",")
+	if !found {
+		return "", "", false
+	}
+	mediaType, found = strings.CutSuffix(header, ";base64")
+	if !found {
+		return "", "", false
+	}
+	return mediaType, data, true
+}
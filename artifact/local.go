@@ -0,0 +1,137 @@
+package artifact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LocalStore keeps artifacts in a directory on the worker and hands out file:// URIs.
+type LocalStore struct {
+	root string
+}
+
+func NewLocalStore(root string) (*LocalStore, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve artifact directory: %w", err)
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+	return &LocalStore{root: root}, nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, ns Namespace, data []byte, ext string) (string, error) {
+	path := filepath.Join(s.root, filepath.FromSlash(Key(ns, data, ext)))
+	uri := (&url.URL{Scheme: "file", Path: path}).String()
+
+	// The name is the content hash, so an existing file already holds these bytes.
+	// Touching it restarts its retention period.
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err == nil {
+		return uri, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+
+	// Write to a temporary file first so readers never see a partial artifact.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create artifact: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write artifact: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write artifact: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to write artifact: %w", err)
+	}
+	return uri, nil
+}
+
+func (s *LocalStore) Get(ctx context.Context, uri string) ([]byte, error) {
+	path, err := s.path(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, uri)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact %s: %w", uri, err)
+	}
+	return data, nil
+}
+
+// path maps a URI back to a file, refusing anything outside the root.
+func (s *LocalStore) path(uri string) (string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return "", fmt.Errorf("%w: %s", ErrInvalidURI, uri)
+	}
+
+	path := filepath.Clean(parsed.Path)
+	relative, err := filepath.Rel(s.root, path)
+	if err != nil || relative == "." || strings.HasPrefix(relative, "..") {
+		return "", fmt.Errorf("%w: %s is outside %s", ErrInvalidURI, uri, s.root)
+	}
+	return path, nil
+}
+
+func (s *LocalStore) Sweep(ctx context.Context, cutoff time.Time) (int, error) {
+	removed := 0
+	var dirs []string
+
+	err := filepath.WalkDir(s.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if entry.IsDir() {
+			if path != s.root {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(cutoff) {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("failed to sweep artifacts: %w", err)
+	}
+
+	// Walk order lists parents before children, so going backwards empties run
+	// directories before their workflow directories. Non-empty ones stay.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+	return removed, nil
+}
@@ -0,0 +1,275 @@
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config points an S3Store at a bucket. Any S3-compatible server works, such as
+// MinIO at http://localhost:9000.
+type S3Config struct {
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix, if set, is prepended to every key, e.g. "iris/".
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// S3Store keeps artifacts in an S3 bucket and hands out s3://bucket/key URIs.
+// Requests are path-style and signed with Signature Version 4.
+type S3Store struct {
+	config     S3Config
+	endpoint   *url.URL
+	httpClient *http.Client
+}
+
+func NewS3Store(config S3Config) (*S3Store, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("s3 artifact store needs a bucket")
+	}
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("s3 artifact store needs an endpoint")
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", config.Endpoint)
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	return &S3Store{
+		config:     config,
+		endpoint:   endpoint,
+		httpClient: &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, ns Namespace, data []byte, ext string) (string, error) {
+	key := s.config.Prefix + Key(ns, data, ext)
+	header := http.Header{"Content-Type": {http.DetectContentType(data)}}
+
+	resp, err := s.do(ctx, http.MethodPut, key, nil, header, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to put artifact %s: %w", key, err)
+	}
+	resp.Body.Close()
+	return "s3://" + s.config.Bucket + "/" + key, nil
+}
+
+func (s *S3Store) Get(ctx context.Context, uri string) ([]byte, error) {
+	// The URI holds the key as is, percent signs from escaped ids included, so
+	// it is cut out rather than parsed, which would decode them.
+	key, found := strings.CutPrefix(uri, "s3://"+s.config.Bucket+"/")
+	if !found || key == "" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidURI, uri)
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		if statusCode(err) == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, uri)
+		}
+		return nil, fmt.Errorf("failed to get artifact %s: %w", uri, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact %s: %w", uri, err)
+	}
+	return data, nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// Sweep lists everything under the prefix and deletes what is older than cutoff.
+// Buckets with a lifecycle rule can leave retention to the server instead.
+func (s *S3Store) Sweep(ctx context.Context, cutoff time.Time) (int, error) {
+	removed := 0
+	query := url.Values{"list-type": {"2"}, "prefix": {s.config.Prefix}}
+
+	for {
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return removed, fmt.Errorf("failed to list artifacts: %w", err)
+		}
+		var page listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return removed, fmt.Errorf("failed to parse artifact listing: %w", err)
+		}
+
+		for _, object := range page.Contents {
+			if !object.LastModified.Before(cutoff) {
+				continue
+			}
+			resp, err := s.do(ctx, http.MethodDelete, object.Key, nil, nil, nil)
+			if err != nil {
+				return removed, fmt.Errorf("failed to delete artifact %s: %w", object.Key, err)
+			}
+			resp.Body.Close()
+			removed++
+		}
+
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return removed, nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+// s3Error is a non-2xx response.
+type s3Error struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *s3Error) Error() string {
+	return fmt.Sprintf("s3 returned %d: %s", e.StatusCode, e.Body)
+}
+
+func statusCode(err error) int {
+	var s3Err *s3Error
+	if errors.As(err, &s3Err) {
+		return s3Err.StatusCode
+	}
+	return 0
+}
+
+// do sends a signed request for key, or for the bucket itself when key is empty.
+// Responses other than 2xx come back as *s3Error.
+func (s *S3Store) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	target := *s.endpoint
+	target.Path = "/" + s.config.Bucket
+	target.RawPath = "/" + escape(s.config.Bucket, true)
+	if key != "" {
+		target.Path += "/" + key
+		target.RawPath += "/" + escape(key, false)
+	}
+	target.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	s.sign(req, body, time.Now().UTC())
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &s3Error{StatusCode: resp.StatusCode, Body: string(message)}
+	}
+	return resp, nil
+}
+
+// sign adds a Signature Version 4 Authorization header covering the host, the
+// payload hash and the date.
+func (s *S3Store) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := hashHex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hashHex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.config.SecretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, s.config.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes query sorted by key, as SigV4 requires. The same string
+// is sent, so what was signed is exactly what the server sees.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, escape(key, true)+"="+escape(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// escape percent-encodes everything but the characters SigV4 leaves unreserved.
+// Slashes are kept unless encodeSlash is set.
+func escape(s string, encodeSlash bool) string {
+	var out strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			out.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			out.WriteByte(b)
+		default:
+			fmt.Fprintf(&out, "%%%02X", b)
+		}
+	}
+	return out.String()
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,206 @@
+package artifact
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a path-style bucket in memory. It lists one object per page so
+// pagination is exercised.
+type fakeS3 struct {
+	t        *testing.T
+	bucket   string
+	mu       sync.Mutex
+	objects  map[string][]byte
+	modified map[string]time.Time
+	fail     int
+}
+
+func newFakeS3(t *testing.T, bucket string) (*fakeS3, *S3Store) {
+	fake := &fakeS3{t: t, bucket: bucket, objects: map[string][]byte{}, modified: map[string]time.Time{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store, err := NewS3Store(S3Config{
+		Endpoint:        server.URL,
+		Bucket:          bucket,
+		Prefix:          "iris/",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, store
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if auth := r.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") {
+		f.t.Errorf("%s %s has Authorization %q", r.Method, r.URL, auth)
+	}
+	if f.fail != 0 {
+		http.Error(w, "<Error><Code>InternalError</Code></Error>", f.fail)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key, found := strings.CutPrefix(r.URL.Path, "/"+f.bucket)
+	if !found {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	key = strings.TrimPrefix(key, "/")
+
+	switch {
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = data
+		f.modified[key] = time.Now()
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, r)
+	case r.Method == http.MethodGet:
+		data, exists := f.objects[key]
+		if !exists {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		delete(f.modified, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, r.URL.Query().Get("prefix")) && key > r.URL.Query().Get("continuation-token") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var result listBucketResult
+	if len(keys) > 0 {
+		result.Contents = append(result.Contents, struct {
+			Key          string    `xml:"Key"`
+			LastModified time.Time `xml:"LastModified"`
+		}{keys[0], f.modified[keys[0]]})
+	}
+	if len(keys) > 1 {
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[0]
+	}
+	xml.NewEncoder(w).Encode(result)
+}
+
+func TestS3PutGet(t *testing.T) {
+	fake, store := newFakeS3(t, "artifacts")
+	ctx := context.Background()
+	// Ids are escaped into the key, so the key itself holds percent signs.
+	ns := Namespace{WorkflowID: "job 1/apply", RunID: "run%2"}
+	data := []byte("\x89PNG screenshot")
+
+	uri, err := store.Put(ctx, ns, data, ".png")
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	key := "iris/" + Key(ns, data, ".png")
+	if want := "s3://artifacts/" + key; uri != want {
+		t.Errorf("uri = %q, want %q", uri, want)
+	}
+	if _, stored := fake.objects[key]; !stored {
+		t.Errorf("server has %v, want an object at %q", fake.objects, key)
+	}
+
+	got, err := store.Get(ctx, uri)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if string(got) != string(data) {
+		t.Errorf("Get = %q, want %q", got, data)
+	}
+}
+
+func TestS3GetErrors(t *testing.T) {
+	fake, store := newFakeS3(t, "artifacts")
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		uri  string
+		fail int
+		want error
+	}{
+		{name: "missing object", uri: "s3://artifacts/iris/job/run/missing.png", want: ErrNotFound},
+		{name: "other bucket", uri: "s3://elsewhere/iris/job/run/a.png", want: ErrInvalidURI},
+		{name: "other scheme", uri: "file:///tmp/a.png", want: ErrInvalidURI},
+		{name: "no key", uri: "s3://artifacts/", want: ErrInvalidURI},
+		{name: "server error", uri: "s3://artifacts/iris/job/run/a.png", fail: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.fail = tt.fail
+			_, err := store.Get(ctx, tt.uri)
+			if err == nil {
+				t.Fatal("Get succeeded")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+			if tt.fail != 0 && statusCode(err) != tt.fail {
+				t.Errorf("status = %d, want %d", statusCode(err), tt.fail)
+			}
+		})
+	}
+}
+
+func TestS3Sweep(t *testing.T) {
+	fake, store := newFakeS3(t, "artifacts")
+	ctx := context.Background()
+	ns := Namespace{WorkflowID: "job", RunID: "run"}
+
+	var uris []string
+	for _, content := range []string{"old", "older", "new"} {
+		uri, err := store.Put(ctx, ns, []byte(content), ".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		uris = append(uris, uri)
+	}
+	fake.objects["outside/prefix.txt"] = []byte("not ours")
+	cutoff := time.Now().Add(-time.Hour)
+	fake.modified["iris/"+Key(ns, []byte("old"), ".txt")] = cutoff.Add(-time.Minute)
+	fake.modified["iris/"+Key(ns, []byte("older"), ".txt")] = cutoff.Add(-time.Hour)
+	fake.modified["outside/prefix.txt"] = cutoff.Add(-time.Hour)
+
+	removed, err := store.Sweep(ctx, cutoff)
+	if err != nil {
+		t.Fatalf("Sweep: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("removed = %d, want 2", removed)
+	}
+	if _, err := store.Get(ctx, uris[2]); err != nil {
+		t.Errorf("the new artifact is gone: %v", err)
+	}
+	for _, uri := range uris[:2] {
+		if _, err := store.Get(ctx, uri); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%s) = %v, want it swept", uri, err)
+		}
+	}
+	if _, kept := fake.objects["outside/prefix.txt"]; !kept {
+		t.Error("an object outside the prefix was swept")
+	}
+}
@@ -0,0 +1,76 @@
+// Package artifact keeps the files activities produce, such as screenshots, apart
+// per workflow run. Artifacts are content-addressed and handed between activities
+// by URI, so identical captures are stored once and workflow histories stay small.
+package artifact
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/url"
+	"time"
+)
+
+var (
+	// ErrNotFound means the URI is well formed but nothing is stored under it.
+	ErrNotFound = errors.New("artifact not found")
+	// ErrInvalidURI means the URI does not belong to the store it was given to.
+	ErrInvalidURI = errors.New("invalid artifact uri")
+)
+
+// Namespace scopes artifacts to the workflow run that produced them.
+type Namespace struct {
+	WorkflowID string `json:"workflow_id"`
+	RunID      string `json:"run_id"`
+}
+
+// Store persists artifacts. Implementations must be safe for concurrent use.
+type Store interface {
+	// Put stores data under ns and returns its URI. ext, such as ".png", is kept
+	// on the key. Putting the same bytes twice returns the same URI.
+	Put(ctx context.Context, ns Namespace, data []byte, ext string) (string, error)
+	// Get returns the artifact a URI from Put points to.
+	Get(ctx context.Context, uri string) ([]byte, error)
+	// Sweep deletes artifacts last written before cutoff and returns how many it removed.
+	Sweep(ctx context.Context, cutoff time.Time) (int, error)
+}
+
+// Key is where an artifact lives inside a store: <workflow>/<run>/<sha256><ext>.
+func Key(ns Namespace, data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	return segment(ns.WorkflowID) + "/" + segment(ns.RunID) + "/" + hex.EncodeToString(sum[:]) + ext
+}
+
+// segment escapes an id for use as a single path segment. Ids that would read
+// as the current or parent directory are prefixed so they can't escape the root.
+func segment(id string) string {
+	escaped := url.PathEscape(id)
+	if escaped == "" || escaped == "." || escaped == ".." {
+		return "_" + escaped
+	}
+	return escaped
+}
+
+// StartRetention sweeps artifacts older than maxAge right away and every interval
+// until ctx is done. Failures are logged and retried on the next tick.
+func StartRetention(ctx context.Context, store Store, maxAge, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			removed, err := store.Sweep(ctx, time.Now().Add(-maxAge))
+			if err != nil && ctx.Err() == nil {
+				log.Println("failed to sweep artifacts:", err)
+			} else if removed > 0 {
+				log.Printf("artifact retention: removed %d artifacts older than %s", removed, maxAge)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
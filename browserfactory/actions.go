@@ -0,0 +1,189 @@
+package browserfactory
+
+import (
+	"fmt"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+func (b *BrowserFactory) Click(page *rod.Page, node *TaggedAccessibilityNode) error {
+	if node.Element == nil {
+		return fmt.Errorf("element at index %d has no DOM element", node.Index)
+	}
+
+	// rod's own click hit-tests with a check that stops at shadow boundaries and
+	// sends input to the element's session, so shadow-hosted elements and ones in
+	// out-of-process iframes are clicked by coordinates from the top page instead.
+	inShadowTree, err := isInShadowTree(node.Element)
+	if err != nil {
+		return fmt.Errorf("failed to inspect element: %w", err)
+	}
+	if node.Frame != nil || inShadowTree {
+		err = clickAtCenter(page, node)
+	} else {
+		err = node.Element.Click(proto.InputMouseButtonLeft, 1)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to click element: %w", err)
+	}
+
+	page.MustWaitIdle()
+	return nil
+}
+
+// isInShadowTree reports whether el lives in a shadow root or hosts one. Custom
+// elements count even when their root is closed and shadowRoot reads null.
+func isInShadowTree(el *rod.Element) (bool, error) {
+	res, err := el.Eval(`() => this.getRootNode() instanceof ShadowRoot || !!this.shadowRoot || this.localName.includes('-')`)
+	if err != nil {
+		return false, err
+	}
+	return res.Value.Bool(), nil
+}
+
+// hitTestScript checks that a click at the center of this element would land on
+// it. It measures in the element's own document, which may be a same-process
+// iframe, follows open shadow roots down to the innermost element at that point,
+// and accepts it if it is this element or sits inside it across shadow
+// boundaries. A closed root stops the descent at its host, so a hit on a host
+// this element sits inside is accepted too. It returns what is in the way, or
+// an empty string.
+const hitTestScript = `() => {
+	const rect = this.getBoundingClientRect();
+	const x = rect.left + rect.width / 2;
+	const y = rect.top + rect.height / 2;
+	let hit = document.elementFromPoint(x, y);
+	while (hit && hit.shadowRoot) {
+		const inner = hit.shadowRoot.elementFromPoint(x, y);
+		if (!inner || inner === hit) break;
+		hit = inner;
+	}
+	if (!hit) return 'nothing';
+
+	const composedParent = (node) => node.parentNode || node.host;
+	for (let node = hit; node; node = composedParent(node)) {
+		if (node === this) return '';
+	}
+	for (let node = this; node; node = composedParent(node)) {
+		if (node === hit) return '';
+	}
+	return hit.outerHTML.slice(0, 200);
+}`
+
+// selectContentsScript selects everything this element holds so typing replaces
+// it. Inputs and textareas have select(); anything else, such as a
+// contenteditable or an ARIA textbox, gets a range over its contents in its own
+// document's selection.
+const selectContentsScript = `() => {
+	if (typeof this.select === 'function') {
+		this.select();
+		return;
+	}
+	const range = this.ownerDocument.createRange();
+	range.selectNodeContents(this);
+	const selection = this.ownerDocument.defaultView.getSelection();
+	selection.removeAllRanges();
+	selection.addRange(range);
+}`
+
+// clickAtCenter scrolls to node, checks nothing covers its center and clicks
+// there with the top page's mouse. Mouse input reaches out-of-process iframes
+// only through the top page, so their coordinates are translated to it.
+func clickAtCenter(page *rod.Page, node *TaggedAccessibilityNode) error {
+	if err := node.Element.ScrollIntoView(); err != nil {
+		return err
+	}
+
+	session, err := frameSession(page, node.Frame)
+	if err != nil {
+		return err
+	}
+	res, err := node.Element.Eval(hitTestScript)
+	if err != nil {
+		return err
+	}
+	if covering := res.Value.Str(); covering != "" {
+		return fmt.Errorf("element at index %d is covered by %s", node.Index, covering)
+	}
+
+	bounds, err := pageBounds(page, session, node.Frame, node.Node)
+	if err != nil {
+		return err
+	}
+	if bounds == nil {
+		return fmt.Errorf("element at index %d is not rendered", node.Index)
+	}
+
+	center := proto.Point{X: bounds.X + bounds.Width/2, Y: bounds.Y + bounds.Height/2}
+	if err := page.Mouse.MoveTo(center); err != nil {
+		return err
+	}
+	return page.Mouse.Click(proto.InputMouseButtonLeft, 1)
+}
+
+// Input replaces the element's content with text. Replacing rather than appending
+// makes typing safe to repeat, so a retried activity doesn't type a field twice.
+func (b *BrowserFactory) Input(page *rod.Page, node *TaggedAccessibilityNode, text string) error {
+	if node.Element == nil {
+		return fmt.Errorf("element at index %d has no DOM element", node.Index)
+	}
+
+	// Text inserted over a selection replaces it.
+	if err := node.Element.Focus(); err != nil {
+		return fmt.Errorf("failed to focus the element: %w", err)
+	}
+	if _, err := node.Element.Eval(selectContentsScript); err != nil {
+		return fmt.Errorf("failed to select the element's text: %w", err)
+	}
+
+	// Keyboard input for out-of-process iframes goes through the top page, which
+	// forwards it to the focused frame.
+	if node.Frame != nil {
+		if err := page.InsertText(text); err != nil {
+			return fmt.Errorf("failed to type text: %w", err)
+		}
+	} else if err := node.Element.Input(text); err != nil {
+		return fmt.Errorf("failed to type text: %w", err)
+	}
+
+	page.MustWaitIdle()
+	return nil
+}
+
+// Scroll moves the viewport by ratio of its height; multiplier is 1 for down and -1 for up.
+func (b *BrowserFactory) Scroll(page *rod.Page, ratio float64, multiplier float64) error {
+	_, err := page.Eval(`(ratio, mult) => {
+		const amount = window.innerHeight * ratio * mult;
+		window.scrollBy({
+			top: amount,
+			behavior: 'instant'
+		});
+	}`, ratio, multiplier)
+
+	if err != nil {
+		return fmt.Errorf("failed to scroll: %w", err)
+	}
+
+	page.MustWaitIdle()
+	return nil
+}
+
+func (b *BrowserFactory) Navigate(page *rod.Page, url string) error {
+	err := page.Navigate(url)
+	if err != nil {
+		return fmt.Errorf("failed to navigate to %s: %w", url, err)
+	}
+
+	page.MustWaitStable()
+	return nil
+}
+
+func (b *BrowserFactory) ClosePage(page *rod.Page) error {
+	err := page.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close page: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package browserfactory
+
+import (
+	"os"
+	"testing"
+)
+
+func TestActionsThroughShadowRoots(t *testing.T) {
+	html, err := os.ReadFile("testdata/shadow.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	factory, page := testPage(t, string(html))
+
+	capture, err := factory.ScreenshotForLLM(page, CaptureOptions{})
+	if err != nil {
+		t.Fatalf("ScreenshotForLLM: %v", err)
+	}
+	tagged := func(role, name string) *TaggedAccessibilityNode {
+		t.Helper()
+		for _, node := range capture.TaggedNodes {
+			if gotRole, gotName := roleAndName(node.Node); gotRole == role && gotName == name {
+				resolved, err := factory.Resolve(page, node.Ref())
+				if err != nil {
+					t.Fatalf("Resolve %s %q: %v", role, name, err)
+				}
+				return resolved
+			}
+		}
+		t.Fatalf("%s %q was not tagged", role, name)
+		return nil
+	}
+
+	// One element of each kind in the open root, and one in the closed root
+	// nested inside it.
+	// Typing twice replaces the first text, as a retried activity would.
+	for _, text := range []string{"jane@exam", "jane@example.com"} {
+		if err := factory.Input(page, tagged("textbox", "Email"), text); err != nil {
+			t.Fatalf("Input Email: %v", err)
+		}
+	}
+	for _, text := range []string{"Dear", "Dear hiring team"} {
+		if err := factory.Input(page, tagged("textbox", "Cover letter"), text); err != nil {
+			t.Fatalf("Input Cover letter: %v", err)
+		}
+	}
+	if err := factory.Click(page, tagged("button", "Continue")); err != nil {
+		t.Fatalf("Click Continue: %v", err)
+	}
+	if err := factory.Input(page, tagged("textbox", "Phone"), "+2348000000000"); err != nil {
+		t.Fatalf("Input Phone: %v", err)
+	}
+	if err := factory.Click(page, tagged("button", "Save phone")); err != nil {
+		t.Fatalf("Click Save phone: %v", err)
+	}
+
+	state := page.MustEval(`() => ({
+		email: document.querySelector('apply-form').shadowRoot.getElementById('email').value,
+		cover: document.querySelector('apply-form').shadowRoot.getElementById('cover').textContent,
+		phone: window.phoneRoot.getElementById('phone').value,
+		clicks: window.clicks.join(','),
+	})`)
+	if got := state.Get("email").Str(); got != "jane@example.com" {
+		t.Errorf("email = %q, want jane@example.com", got)
+	}
+	if got := state.Get("cover").Str(); got != "Dear hiring team" {
+		t.Errorf("cover letter = %q, want Dear hiring team", got)
+	}
+	if got := state.Get("phone").Str(); got != "+2348000000000" {
+		t.Errorf("phone = %q, want +2348000000000", got)
+	}
+	if got := state.Get("clicks").Str(); got != "continue,save" {
+		t.Errorf("clicks = %q, want continue,save", got)
+	}
+}
@@ -0,0 +1,29 @@
+package browserfactory
+
+import (
+	"testing"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+)
+
+// testPage opens a blank page in a local headless browser showing html. Tests
+// that need one are skipped where no browser is installed.
+func testPage(tb testing.TB, html string) (*BrowserFactory, *rod.Page) {
+	tb.Helper()
+	bin, found := launcher.LookPath()
+	if !found {
+		tb.Skip("no browser installed")
+	}
+
+	l := launcher.New().Bin(bin).Headless(true)
+	tb.Cleanup(l.Kill)
+	browser := rod.New().ControlURL(l.MustLaunch()).MustConnect().NoDefaultDevice()
+	tb.Cleanup(func() { browser.Close() })
+
+	page := browser.MustPage("")
+	page.MustSetViewport(1280, 800, 1, false)
+	page.MustSetDocumentContent(html)
+	page.MustWaitStable()
+	return &BrowserFactory{browser: browser}, page
+}
@@ -4,20 +4,17 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/SomtoJF/iris-worker/initializers/fs"
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/proto"
 )
 
 type BrowserFactory struct {
 	browser *rod.Browser
-	fs      *fs.TemporaryFileSystem
 }
 
-func NewBrowserFactory(fs *fs.TemporaryFileSystem) *BrowserFactory {
+func NewBrowserFactory() *BrowserFactory {
 	return &BrowserFactory{
 		browser: rod.New().MustConnect().NoDefaultDevice(),
-		fs:      fs,
 	}
 }
 
@@ -25,34 +22,46 @@ func (b *BrowserFactory) GetBrowser() *rod.Browser {
 	return b.browser
 }
 
-func (b *BrowserFactory) ScreenshotForLLM(page *rod.Page, fileName string) (string, []*TaggedAccessibilityNode, error) {
-	screenshotPath := b.fs.ConcatenatePath(fileName)
-
-	var taggedNodes []*TaggedAccessibilityNode
+// ScreenshotForLLM tags the page's interactive elements and captures the viewport
+// with the tags drawn on. The overlay is removed again before it returns, so the
+// page is left as it was found. Storing the screenshots is up to the caller.
+func (b *BrowserFactory) ScreenshotForLLM(page *rod.Page, options CaptureOptions) (Capture, error) {
+	var capture Capture
 
 	err := rod.Try(func() {
 		page.MustWaitStable()
-		// Get the accessibility tree for the page
-		accessibilityTree, _ := getPageAccessibilityTree(page)
+		// Read the accessibility trees and layout of the page and all its frames
+		frames, err := captureFrames(page)
+		if err != nil {
+			panic(err)
+		}
+
+		scroll, err := pageScroll(page)
+		if err != nil {
+			panic(err)
+		}
 
-		// Draw transparent grid lines over the page
-		drawTransparentGrid(page)
+		if options.Clean {
+			capture.Clean = page.MustScreenshot()
+		}
 
-		taggedNodes = tagAccessibilityNodes(page, accessibilityTree)
+		defer removeOverlay(page)
+		drawOverlay(page)
 
-		page.MustScreenshot(screenshotPath)
+		capture.TaggedNodes = tagAccessibilityNodes(frames, scroll)
+		drawTags(page, capture.TaggedNodes)
+		if options.Text {
+			capture.Text = renderPageText(frames, capture.TaggedNodes)
+		}
 
+		capture.Annotated = page.MustScreenshot()
 	})
 
 	if err != nil {
-		return "", nil, err
+		return Capture{}, err
 	}
 
-	return screenshotPath, taggedNodes, nil
-}
-
-func (b *BrowserFactory) OpenUrl(page *rod.Page, url string) *rod.Page {
-	return page.MustNavigate(url)
+	return capture, nil
 }
 
 func (b *BrowserFactory) OpenPageNewTab(browser *rod.Browser, url string) *rod.Page {
@@ -61,81 +70,38 @@ func (b *BrowserFactory) OpenPageNewTab(browser *rod.Browser, url string) *rod.P
 	return page
 }
 
-func getPageAccessibilityTree(page *rod.Page) ([]*proto.AccessibilityAXNode, error) {
-	res, err := proto.AccessibilityGetFullAXTree{}.Call(page)
-	if err != nil {
-		return nil, err
-	}
-	return res.Nodes, nil
-}
-
-func drawTransparentGrid(page *rod.Page) {
-	page.MustEval(`() => {
-		const canvas = document.createElement('canvas');
-		canvas.id = 'agent-grid';
-		canvas.style = 'position:fixed; top:0; left:0; pointer-events:none; z-index:9999;';
-		canvas.width = window.innerWidth;
-		canvas.height = window.innerHeight;
-		const ctx = canvas.getContext('2d');
-		ctx.strokeStyle = 'rgba(255, 0, 0, 0.2)'; // Faint red lines
-		// Draw horizontal/vertical lines every 100px
-		for(let i=0; i<canvas.width; i+=100) { ctx.strokeRect(i, 0, 0, canvas.height); }
-		for(let i=0; i<canvas.height; i+=100) { ctx.strokeRect(0, i, canvas.width, 0); }
-		document.body.appendChild(canvas);
-	}`)
-}
-
-func tagAccessibilityNodes(page *rod.Page, accessibilityTree []*proto.AccessibilityAXNode) []*TaggedAccessibilityNode {
-	// Filter for focusable nodes with valid BackendDOMNodeID
-	var focusableNodes []*proto.AccessibilityAXNode
-	for _, node := range accessibilityTree {
-		if !node.Ignored && isInteractive(node) && node.BackendDOMNodeID != 0 {
-			focusableNodes = append(focusableNodes, node)
-		}
-	}
-
+// tagAccessibilityNodes numbers every rendered interactive node across all
+// frames. Geometry comes from one snapshot per process rather than a call per
+// node, so the cost doesn't grow in round trips with the size of the form.
+// scroll is the top page's scroll offset the frames were captured at.
+func tagAccessibilityNodes(frames []frameDocument, scroll proto.Point) []*TaggedAccessibilityNode {
 	var taggedNodes []*TaggedAccessibilityNode
-
-	// Inject tagging script for each focusable element
-	for i, node := range focusableNodes {
-		bounds := getNodeBounds(page, node)
-		if bounds != nil {
-			page.MustEval(`(x, y, w, h, i) => {
-				const tag = document.createElement('div');
-				tag.innerText = i;
-				tag.style = `+"`"+`
-					position: fixed;
-					left: ${x}px;
-					top: ${y}px;
-					background: #ff0000;
-					color: white;
-					padding: 2px 4px;
-					font-size: 10px;
-					font-weight: bold;
-					border-radius: 3px;
-					z-index: 1000000;
-					pointer-events: none;
-				`+"`"+`;
-				document.body.appendChild(tag);
-			}`, bounds.X, bounds.Y, bounds.Width, bounds.Height, i)
-		} else {
-			continue
+	i := 0
+	for _, frame := range frames {
+		for _, node := range frame.nodes {
+			// Filter for focusable nodes with valid BackendDOMNodeID
+			if node.Ignored || !isInteractive(node) || node.BackendDOMNodeID == 0 {
+				continue
+			}
+			index := i
+			i++
+
+			// Nodes without a layout box aren't rendered and can't be tagged.
+			bounds, rendered := frame.bounds[node.BackendDOMNodeID]
+			if !rendered {
+				continue
+			}
+
+			taggedNodes = append(taggedNodes, &TaggedAccessibilityNode{
+				Node:        node,
+				Frame:       frame.frame,
+				Bounds:      bounds,
+				Scroll:      scroll,
+				Index:       index,
+				Description: getDescriptionFromNode(node, index),
+			})
 		}
-
-		element := getElementFromNode(page, node)
-		description := getDescriptionFromNode(node, i)
-
-		fmt.Println("description: ", description)
-
-		taggedNodes = append(taggedNodes, &TaggedAccessibilityNode{
-			Node:        node,
-			Element:     element,
-			Bounds:      bounds,
-			Index:       i,
-			Description: description,
-		})
 	}
-
 	return taggedNodes
 }
 
@@ -208,44 +174,3 @@ func isInteractive(node *proto.AccessibilityAXNode) bool {
 
 	return false
 }
-
-// getNodeBounds retrieves element bounds using DOM.getBoxModel
-func getNodeBounds(page *rod.Page, node *proto.AccessibilityAXNode) *proto.DOMRect {
-	if node.BackendDOMNodeID == 0 {
-		return nil
-	}
-
-	res, err := proto.DOMGetBoxModel{BackendNodeID: node.BackendDOMNodeID}.Call(page)
-	if err != nil || res.Model == nil || len(res.Model.Border) < 4 {
-		return nil
-	}
-
-	// Model.Border is [x1, y1, x2, y2, x3, y3, x4, y4] - use top-left corner
-	x := res.Model.Border[0]
-	y := res.Model.Border[1]
-	// Calculate width/height from quad points
-	width := res.Model.Border[2] - res.Model.Border[0]  // x2 - x1
-	height := res.Model.Border[5] - res.Model.Border[1] // y3 - y1
-
-	return &proto.DOMRect{
-		X:      x,
-		Y:      y,
-		Width:  width,
-		Height: height,
-	}
-}
-
-func getElementFromNode(page *rod.Page, node *proto.AccessibilityAXNode) *rod.Element {
-	if node.BackendDOMNodeID == 0 {
-		return nil
-	}
-
-	el, err := page.ElementFromNode(&proto.DOMNode{
-		BackendNodeID: node.BackendDOMNodeID,
-	})
-	if err != nil {
-		return nil
-	}
-
-	return el
-}
@@ -0,0 +1,166 @@
+package browserfactory
+
+import (
+	"fmt"
+
+	"github.com/go-rod/rod"
+)
+
+// FieldRoles are the roles an element may have and still be a form field. File
+// inputs show up as buttons, so buttons are candidates too; DescribeField sorts
+// out the ones that are only buttons.
+var FieldRoles = map[string]bool{
+	"textbox":   true,
+	"searchbox": true,
+	"textarea":  true,
+	"input":     true,
+	"checkbox":  true,
+	"radio":     true,
+	"combobox":  true,
+	"select":    true,
+	"switch":    true,
+	"slider":    true,
+	"button":    true,
+}
+
+// FormField is one form control as the page defines it, independent of how it is
+// drawn, so planning, autofill and review all read the same model of a form.
+type FormField struct {
+	// Index is the control's tag index in the capture it was described from.
+	Index int    `json:"index"`
+	Role  string `json:"role"`
+	// Type is the input type for <input> elements, "select" or "textarea" for
+	// those elements, and the role for custom widgets.
+	Type string `json:"type"`
+	// Label comes from aria-labelledby, a <label>, aria-label or the nearest text
+	// before the control, in that order.
+	Label        string        `json:"label"`
+	Name         string        `json:"name,omitempty"`
+	Placeholder  string        `json:"placeholder,omitempty"`
+	Value        string        `json:"value,omitempty"`
+	Checked      bool          `json:"checked,omitempty"`
+	Required     bool          `json:"required"`
+	Invalid      bool          `json:"invalid"`
+	Disabled     bool          `json:"disabled,omitempty"`
+	Options      []FieldOption `json:"options,omitempty"`
+	Autocomplete string        `json:"autocomplete,omitempty"`
+	// Section is the fieldset legend, labelled group or closest heading above the
+	// control.
+	Section string `json:"section,omitempty"`
+}
+
+// FieldOption is one choice of a select, combobox or listbox.
+type FieldOption struct {
+	Label    string `json:"label"`
+	Value    string `json:"value,omitempty"`
+	Selected bool   `json:"selected,omitempty"`
+}
+
+// describeFieldScript reads a control's field model, or null if this is not a
+// form control. It looks ids up in the control's own root so controls inside
+// shadow trees resolve their labels too.
+const describeFieldScript = `() => {
+	const el = this;
+	const root = el.getRootNode();
+	const text = (node) => (node?.innerText ?? node?.textContent ?? '').replace(/\s+/g, ' ').trim();
+	const byIds = (ids) => (ids || '').split(/\s+/).map((id) => id && root.getElementById?.(id)).filter(Boolean);
+	const composedParent = (node) => node.parentNode || node.host;
+
+	const tag = el.localName;
+	const role = el.getAttribute('role') || '';
+	const nativeInput = tag === 'input' && !['hidden', 'submit', 'button', 'reset', 'image'].includes(el.type);
+	const widget = ['textbox', 'searchbox', 'combobox', 'listbox', 'checkbox', 'radio', 'switch', 'slider', 'spinbutton'].includes(role);
+	if (!nativeInput && tag !== 'select' && tag !== 'textarea' && !widget) return null;
+
+	const nearestText = () => {
+		for (let node = el, depth = 0; node && depth < 3; node = composedParent(node), depth++) {
+			for (let sibling = node.previousElementSibling; sibling; sibling = sibling.previousElementSibling) {
+				const found = text(sibling);
+				if (found) return found;
+			}
+		}
+		return '';
+	};
+	const label = () => {
+		const labelledBy = byIds(el.getAttribute('aria-labelledby')).map(text).join(' ').trim();
+		if (labelledBy) return labelledBy;
+		const labels = Array.from(el.labels || []).map(text).join(' ').trim();
+		if (labels) return labels;
+		return (el.getAttribute('aria-label') || '').trim() || nearestText();
+	};
+
+	const section = () => {
+		for (let node = composedParent(el); node && node.nodeType === Node.ELEMENT_NODE; node = composedParent(node)) {
+			if (node.localName === 'fieldset') {
+				const legend = text(node.querySelector(':scope > legend'));
+				if (legend) return legend;
+			}
+			if (['group', 'radiogroup', 'region'].includes(node.getAttribute('role')) || node.localName === 'section' || node.localName === 'form') {
+				const name = byIds(node.getAttribute('aria-labelledby')).map(text).join(' ').trim() || (node.getAttribute('aria-label') || '').trim();
+				if (name) return name;
+			}
+		}
+		const headings = Array.from(root.querySelectorAll('h1, h2, h3, h4, h5, h6, [role=heading]'))
+			.filter((heading) => heading.compareDocumentPosition(el) & Node.DOCUMENT_POSITION_FOLLOWING);
+		return headings.length ? text(headings[headings.length - 1]) : '';
+	};
+
+	const options = () => {
+		if (tag === 'select') {
+			return Array.from(el.options).map((option) => ({ label: text(option) || option.label, value: option.value, selected: option.selected }));
+		}
+		const popups = [el, ...byIds(el.getAttribute('aria-controls')), ...byIds(el.getAttribute('aria-owns'))];
+		return popups.flatMap((popup) => Array.from(popup.querySelectorAll('[role=option]')))
+			.map((option) => ({ label: text(option), value: option.getAttribute('data-value') || '', selected: option.getAttribute('aria-selected') === 'true' }));
+	};
+
+	const ariaBool = (name) => el.getAttribute(name) === 'true';
+	let value = '';
+	if (el.type === 'file') value = Array.from(el.files || []).map((file) => file.name).join(', ');
+	else if (nativeInput || tag === 'select' || tag === 'textarea') value = el.value;
+	else if (el.isContentEditable) value = text(el);
+	else value = el.getAttribute('aria-valuetext') || el.getAttribute('aria-valuenow') || '';
+
+	return {
+		type: nativeInput ? el.type : (tag === 'select' || tag === 'textarea' ? tag : role),
+		label: label(),
+		name: el.getAttribute('name') || '',
+		placeholder: el.getAttribute('placeholder') || el.getAttribute('aria-placeholder') || '',
+		value,
+		checked: !!el.checked || ariaBool('aria-checked'),
+		required: !!el.required || ariaBool('aria-required'),
+		invalid: (el.validity ? !el.validity.valid : false) || ariaBool('aria-invalid'),
+		disabled: !!el.disabled || ariaBool('aria-disabled'),
+		options: options(),
+		autocomplete: el.getAttribute('autocomplete') || '',
+		section: section(),
+	};
+}`
+
+// DescribeField reads the field model of node's element. It returns nil for
+// elements that aren't form controls, such as plain buttons.
+func (b *BrowserFactory) DescribeField(page *rod.Page, node *TaggedAccessibilityNode) (*FormField, error) {
+	if node.Element == nil {
+		return nil, fmt.Errorf("element at index %d has no DOM element", node.Index)
+	}
+
+	res, err := node.Element.Eval(describeFieldScript)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe element at index %d: %w", node.Index, err)
+	}
+	if res.Value.Nil() {
+		return nil, nil
+	}
+
+	var field FormField
+	if err := res.Value.Unmarshal(&field); err != nil {
+		return nil, fmt.Errorf("failed to read field at index %d: %w", node.Index, err)
+	}
+	role, name := roleAndName(node.Node)
+	field.Index = node.Index
+	field.Role = role
+	if field.Label == "" {
+		field.Label = name
+	}
+	return &field, nil
+}
@@ -0,0 +1,134 @@
+package browserfactory
+
+import (
+	"fmt"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// maxFrameDepth bounds how deeply nested out-of-process iframes are followed.
+const maxFrameDepth = 5
+
+// FrameRef locates an out-of-process iframe (OOPIF): the target its document is
+// served from and the <iframe> element hosting it. Nodes in the top page and in
+// same-process iframes have no FrameRef, since the page's own session reaches them.
+type FrameRef struct {
+	TargetID    proto.TargetTargetID   `json:"target_id"`
+	OwnerNodeID proto.DOMBackendNodeID `json:"owner_node_id"`
+	// Parent is the OOPIF the owner element lives in, or nil for the top page.
+	Parent *FrameRef `json:"parent,omitempty"`
+}
+
+// frameDocument is one document's accessibility tree with page-relative bounds
+// for its nodes.
+type frameDocument struct {
+	frame      *FrameRef
+	nodes      []*proto.AccessibilityAXNode
+	bounds     map[proto.DOMBackendNodeID]*proto.DOMRect
+	inputTypes map[proto.DOMBackendNodeID]string
+}
+
+// captureFrames collects the top document and every iframe below it, same-origin
+// or not. Frames that can't be read, e.g. because they navigated away mid-capture,
+// are skipped.
+func captureFrames(page *rod.Page) ([]frameDocument, error) {
+	return captureSession(page, page, nil, proto.Point{}, 0)
+}
+
+func captureSession(page, session *rod.Page, frame *FrameRef, offset proto.Point, depth int) ([]frameDocument, error) {
+	layout, err := captureLayout(session, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []frameDocument
+	for _, frameID := range layout.frameIDs {
+		tree, err := proto.AccessibilityGetFullAXTree{FrameID: frameID}.Call(session)
+		if err != nil {
+			continue
+		}
+		documents = append(documents, frameDocument{
+			frame:      frame,
+			nodes:      tree.Nodes,
+			bounds:     layout.bounds,
+			inputTypes: layout.inputTypes,
+		})
+	}
+
+	if depth >= maxFrameDepth {
+		return documents, nil
+	}
+	for _, owner := range layout.remoteFrameOwners {
+		child, err := remoteFrame(session, frame, owner)
+		if err != nil {
+			continue
+		}
+		childSession, err := frameSession(page, child)
+		if err != nil {
+			continue
+		}
+		origin, err := contentOrigin(session, owner)
+		if err != nil {
+			continue
+		}
+
+		childOffset := proto.Point{X: offset.X + origin.X, Y: offset.Y + origin.Y}
+		childDocuments, err := captureSession(page, childSession, child, childOffset, depth+1)
+		if err != nil {
+			continue
+		}
+		documents = append(documents, childDocuments...)
+	}
+	return documents, nil
+}
+
+// remoteFrame identifies the OOPIF hosted by owner, an <iframe> in session. An
+// OOPIF's target id is its frame id.
+func remoteFrame(session *rod.Page, parent *FrameRef, owner proto.DOMBackendNodeID) (*FrameRef, error) {
+	res, err := proto.DOMDescribeNode{BackendNodeID: owner}.Call(session)
+	if err != nil {
+		return nil, err
+	}
+	if res.Node == nil || res.Node.FrameID == "" {
+		return nil, fmt.Errorf("node %d hosts no frame", owner)
+	}
+	return &FrameRef{
+		TargetID:    proto.TargetTargetID(res.Node.FrameID),
+		OwnerNodeID: owner,
+		Parent:      parent,
+	}, nil
+}
+
+// frameSession returns the session that reaches frame's document.
+func frameSession(page *rod.Page, frame *FrameRef) (*rod.Page, error) {
+	if frame == nil {
+		return page, nil
+	}
+	session, err := page.Browser().PageFromTarget(frame.TargetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach to frame %s: %w", frame.TargetID, err)
+	}
+	return session, nil
+}
+
+// frameOffset returns where frame's viewport currently sits on the page. It is
+// measured live, since scrolling any ancestor moves it.
+func frameOffset(page *rod.Page, frame *FrameRef) (proto.Point, error) {
+	if frame == nil {
+		return proto.Point{}, nil
+	}
+	parentOffset, err := frameOffset(page, frame.Parent)
+	if err != nil {
+		return proto.Point{}, err
+	}
+	parentSession, err := frameSession(page, frame.Parent)
+	if err != nil {
+		return proto.Point{}, err
+	}
+	origin, err := contentOrigin(parentSession, frame.OwnerNodeID)
+	if err != nil {
+		return proto.Point{}, fmt.Errorf("failed to locate frame %s: %w", frame.TargetID, err)
+	}
+	return proto.Point{X: parentOffset.X + origin.X, Y: parentOffset.Y + origin.Y}, nil
+}
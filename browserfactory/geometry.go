@@ -0,0 +1,145 @@
+package browserfactory
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// sessionLayout is what one DOM snapshot says about the documents of a session:
+// the top page's, or an out-of-process iframe's. Same-process iframes are
+// included in their parent's snapshot.
+type sessionLayout struct {
+	// bounds are page-relative bounding boxes of every rendered node, keyed by
+	// backend node id.
+	bounds map[proto.DOMBackendNodeID]*proto.DOMRect
+	// frameIDs lists the frame of each document, the session's root first.
+	frameIDs []proto.PageFrameID
+	// remoteFrameOwners are <iframe> elements whose document isn't in the
+	// snapshot because it lives in another process.
+	remoteFrameOwners []proto.DOMBackendNodeID
+	// inputTypes are the type attributes of <input> elements, which the
+	// accessibility tree folds into roles.
+	inputTypes map[proto.DOMBackendNodeID]string
+}
+
+// captureLayout takes one DOMSnapshot of session, where DOM.getBoxModel would take
+// a round trip per node. offset is where the session's viewport sits on the page.
+func captureLayout(session *rod.Page, offset proto.Point) (*sessionLayout, error) {
+	res, err := proto.DOMSnapshotCaptureSnapshot{ComputedStyles: []string{}}.Call(session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture dom snapshot: %w", err)
+	}
+	if len(res.Documents) == 0 {
+		return nil, fmt.Errorf("dom snapshot has no documents")
+	}
+
+	layout := &sessionLayout{
+		bounds:     map[proto.DOMBackendNodeID]*proto.DOMRect{},
+		inputTypes: map[proto.DOMBackendNodeID]string{},
+	}
+	origins := map[int]proto.Point{0: offset}
+
+	// Child documents come after the document that owns them, so each document's
+	// origin is known by the time it is reached.
+	for index, document := range res.Documents {
+		origin, reachable := origins[index]
+		if !reachable || document.Nodes == nil {
+			continue
+		}
+		layout.frameIDs = append(layout.frameIDs, proto.PageFrameID(snapshotString(res.Strings, document.FrameID)))
+
+		nodes := document.Nodes
+		hasContentDocument := map[int]bool{}
+		if nodes.ContentDocumentIndex != nil {
+			for i, nodeIndex := range nodes.ContentDocumentIndex.Index {
+				hasContentDocument[nodeIndex] = true
+				owner := nodes.BackendNodeID[nodeIndex]
+				// Box models of same-process frames are already relative to the
+				// session's viewport, so only offset needs adding.
+				if content, err := contentOrigin(session, owner); err == nil {
+					origins[nodes.ContentDocumentIndex.Value[i]] = proto.Point{X: offset.X + content.X, Y: offset.Y + content.Y}
+				}
+			}
+		}
+		for nodeIndex, name := range nodes.NodeName {
+			tag := strings.ToUpper(snapshotString(res.Strings, name))
+			if (tag == "IFRAME" || tag == "FRAME") && !hasContentDocument[nodeIndex] {
+				layout.remoteFrameOwners = append(layout.remoteFrameOwners, nodes.BackendNodeID[nodeIndex])
+			}
+			if tag == "INPUT" && nodeIndex < len(nodes.Attributes) {
+				if inputType := snapshotAttribute(res.Strings, nodes.Attributes[nodeIndex], "type"); inputType != "" {
+					layout.inputTypes[nodes.BackendNodeID[nodeIndex]] = strings.ToLower(inputType)
+				}
+			}
+		}
+
+		if document.Layout == nil {
+			continue
+		}
+
+		// Layout bounds are relative to the document; tags are drawn relative to
+		// the viewport.
+		var scrollX, scrollY float64
+		if document.ScrollOffsetX != nil {
+			scrollX = *document.ScrollOffsetX
+		}
+		if document.ScrollOffsetY != nil {
+			scrollY = *document.ScrollOffsetY
+		}
+
+		for i, nodeIndex := range document.Layout.NodeIndex {
+			if i >= len(document.Layout.Bounds) || nodeIndex >= len(nodes.BackendNodeID) {
+				continue
+			}
+			rect := document.Layout.Bounds[i]
+			if len(rect) < 4 {
+				continue
+			}
+			backendNodeID := nodes.BackendNodeID[nodeIndex]
+			// An inline element split across lines has a box per line; keep the first.
+			if _, seen := layout.bounds[backendNodeID]; seen {
+				continue
+			}
+			layout.bounds[backendNodeID] = &proto.DOMRect{
+				X:      rect[0] - scrollX + origin.X,
+				Y:      rect[1] - scrollY + origin.Y,
+				Width:  rect[2],
+				Height: rect[3],
+			}
+		}
+	}
+	return layout, nil
+}
+
+// contentOrigin returns the top-left corner of node's content box, relative to
+// the viewport of session. For an <iframe> that is where its document starts.
+func contentOrigin(session *rod.Page, node proto.DOMBackendNodeID) (proto.Point, error) {
+	res, err := proto.DOMGetBoxModel{BackendNodeID: node}.Call(session)
+	if err != nil {
+		return proto.Point{}, err
+	}
+	if res.Model == nil || len(res.Model.Content) < 2 {
+		return proto.Point{}, fmt.Errorf("node %d has no content box", node)
+	}
+	return proto.Point{X: res.Model.Content[0], Y: res.Model.Content[1]}, nil
+}
+
+func snapshotString(table []string, index proto.DOMSnapshotStringIndex) string {
+	if int(index) < 0 || int(index) >= len(table) {
+		return ""
+	}
+	return table[index]
+}
+
+// snapshotAttribute looks name up in a snapshot node's flattened attribute pairs.
+func snapshotAttribute(table []string, attributes proto.DOMSnapshotArrayOfStrings, name string) string {
+	for i := 0; i+1 < len(attributes); i += 2 {
+		if strings.EqualFold(snapshotString(table, attributes[i]), name) {
+			return snapshotString(table, attributes[i+1])
+		}
+	}
+	return ""
+}
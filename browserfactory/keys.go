@@ -0,0 +1,116 @@
+package browserfactory
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/input"
+)
+
+// modifierKeys are the keys that may be held down in a chord, by lowercased name.
+var modifierKeys = map[string]input.Key{
+	"ctrl":    input.ControlLeft,
+	"control": input.ControlLeft,
+	"shift":   input.ShiftLeft,
+	"alt":     input.AltLeft,
+	"option":  input.AltLeft,
+	"meta":    input.MetaLeft,
+	"cmd":     input.MetaLeft,
+	"command": input.MetaLeft,
+}
+
+// namedKeys are the non-character keys a chord may end in, by lowercased name.
+var namedKeys = map[string]input.Key{
+	"enter":      input.Enter,
+	"return":     input.Enter,
+	"tab":        input.Tab,
+	"escape":     input.Escape,
+	"esc":        input.Escape,
+	"backspace":  input.Backspace,
+	"delete":     input.Delete,
+	"space":      input.Space,
+	"arrowup":    input.ArrowUp,
+	"arrowdown":  input.ArrowDown,
+	"arrowleft":  input.ArrowLeft,
+	"arrowright": input.ArrowRight,
+	"up":         input.ArrowUp,
+	"down":       input.ArrowDown,
+	"left":       input.ArrowLeft,
+	"right":      input.ArrowRight,
+	"home":       input.Home,
+	"end":        input.End,
+	"pageup":     input.PageUp,
+	"pagedown":   input.PageDown,
+}
+
+// ParseKeyChord reads a key or a chord of modifiers and one key joined by "+",
+// such as "Enter", "Ctrl+A" or "Shift+Tab". Names are case-insensitive; a letter
+// is its unshifted key, so "A" presses the a key and capitals need Shift.
+func ParseKeyChord(chord string) ([]input.Key, error) {
+	parts := strings.Split(strings.TrimSpace(chord), "+")
+	keys := make([]input.Key, 0, len(parts))
+	for i, part := range parts {
+		name := strings.ToLower(strings.TrimSpace(part))
+		if name == "" {
+			return nil, fmt.Errorf("key chord %q has an empty key", chord)
+		}
+
+		if i < len(parts)-1 {
+			modifier, exists := modifierKeys[name]
+			if !exists {
+				return nil, fmt.Errorf("key chord %q: %s is not a modifier", chord, part)
+			}
+			keys = append(keys, modifier)
+			continue
+		}
+
+		key, err := chordKey(name)
+		if err != nil {
+			return nil, fmt.Errorf("key chord %q: %w", chord, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func chordKey(name string) (input.Key, error) {
+	if key, exists := namedKeys[name]; exists {
+		return key, nil
+	}
+	if key, exists := modifierKeys[name]; exists {
+		return key, nil
+	}
+	if len(name) == 1 && (name[0] >= 'a' && name[0] <= 'z' || name[0] >= '0' && name[0] <= '9') {
+		return input.Key(name[0]), nil
+	}
+	return 0, fmt.Errorf("unknown key %s", name)
+}
+
+// PressKey presses chord on the page's keyboard, after focusing node if it isn't
+// nil. Modifiers are held while the last key is typed and released afterwards.
+// Keyboard input for out-of-process iframes goes through the top page too, which
+// forwards it to the focused frame.
+func (b *BrowserFactory) PressKey(page *rod.Page, node *TaggedAccessibilityNode, chord string) error {
+	keys, err := ParseKeyChord(chord)
+	if err != nil {
+		return err
+	}
+
+	if node != nil {
+		if node.Element == nil {
+			return fmt.Errorf("element at index %d has no DOM element", node.Index)
+		}
+		if err := node.Element.Focus(); err != nil {
+			return fmt.Errorf("failed to focus element: %w", err)
+		}
+	}
+
+	modifiers, key := keys[:len(keys)-1], keys[len(keys)-1]
+	if err := page.KeyActions().Press(modifiers...).Type(key).Do(); err != nil {
+		return fmt.Errorf("failed to press %s: %w", chord, err)
+	}
+
+	page.MustWaitIdle()
+	return nil
+}
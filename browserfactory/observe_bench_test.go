@@ -0,0 +1,48 @@
+package browserfactory
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// formPage builds a long application form with fields controls: labelled
+// inputs, with a select and a checkbox mixed in.
+func formPage(fields int) string {
+	var html strings.Builder
+	html.WriteString("<!doctype html><html><head><title>Apply</title></head><body><form><h1>Apply</h1>")
+	for i := 0; i < fields; i++ {
+		switch i % 10 {
+		case 8:
+			fmt.Fprintf(&html, `<label>Country %d <select name="country%d"><option>Nigeria</option><option>Kenya</option></select></label><br>`, i, i)
+		case 9:
+			fmt.Fprintf(&html, `<label><input type="checkbox" name="agree%d"> I agree %d</label><br>`, i, i)
+		default:
+			fmt.Fprintf(&html, `<label>Question %d <input type="text" name="q%d"></label><br>`, i, i)
+		}
+	}
+	html.WriteString(`<button type="submit">Submit</button></form></body></html>`)
+	return html.String()
+}
+
+func benchmarkObserve(b *testing.B, fields int, options CaptureOptions) {
+	factory, page := testPage(b, formPage(fields))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		capture, err := factory.ScreenshotForLLM(page, options)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(capture.TaggedNodes) == 0 {
+			b.Fatal("nothing was tagged")
+		}
+	}
+}
+
+func BenchmarkObserve50(b *testing.B)   { benchmarkObserve(b, 50, CaptureOptions{}) }
+func BenchmarkObserve200(b *testing.B)  { benchmarkObserve(b, 200, CaptureOptions{}) }
+func BenchmarkObserve1000(b *testing.B) { benchmarkObserve(b, 1000, CaptureOptions{}) }
+
+func BenchmarkObserve1000WithText(b *testing.B) {
+	benchmarkObserve(b, 1000, CaptureOptions{Text: true})
+}
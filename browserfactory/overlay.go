@@ -0,0 +1,79 @@
+package browserfactory
+
+import (
+	"github.com/go-rod/rod"
+)
+
+// overlayID names the element holding the grid and tags. Everything drawn for a
+// capture lives in its shadow root, so page styles can't reach the overlay, the
+// overlay can't restyle the page, and nothing ends up inside a form.
+const overlayID = "iris-overlay"
+
+// drawOverlay adds the overlay container with a faint grid, replacing one a
+// failed capture may have left behind.
+func drawOverlay(page *rod.Page) {
+	page.MustEval(`(id) => {
+		document.getElementById(id)?.remove();
+
+		const host = document.createElement('div');
+		host.id = id;
+		host.style = 'position:fixed; inset:0; pointer-events:none; z-index:2147483647;';
+		const root = host.attachShadow({ mode: 'open' });
+
+		const canvas = document.createElement('canvas');
+		canvas.style = 'position:fixed; top:0; left:0;';
+		canvas.width = window.innerWidth;
+		canvas.height = window.innerHeight;
+		const ctx = canvas.getContext('2d');
+		ctx.strokeStyle = 'rgba(255, 0, 0, 0.2)'; // Faint red lines
+		// Draw horizontal/vertical lines every 100px
+		for(let i=0; i<canvas.width; i+=100) { ctx.strokeRect(i, 0, 0, canvas.height); }
+		for(let i=0; i<canvas.height; i+=100) { ctx.strokeRect(0, i, canvas.width, 0); }
+		root.appendChild(canvas);
+
+		document.documentElement.appendChild(host);
+	}`, overlayID)
+}
+
+// drawTags labels each node's bounds with its index inside the overlay, all in
+// one evaluation.
+func drawTags(page *rod.Page, nodes []*TaggedAccessibilityNode) {
+	type tag struct {
+		X     float64 `json:"x"`
+		Y     float64 `json:"y"`
+		Index int     `json:"index"`
+	}
+	tags := make([]tag, len(nodes))
+	for i, node := range nodes {
+		tags[i] = tag{X: node.Bounds.X, Y: node.Bounds.Y, Index: node.Index}
+	}
+
+	page.MustEval(`(id, tags) => {
+		const root = document.getElementById(id).shadowRoot;
+		const fragment = document.createDocumentFragment();
+		for (const { x, y, index } of tags) {
+			const tag = document.createElement('div');
+			tag.innerText = index;
+			tag.style = `+"`"+`
+				position: fixed;
+				left: ${x}px;
+				top: ${y}px;
+				background: #ff0000;
+				color: white;
+				padding: 2px 4px;
+				font-size: 10px;
+				font-weight: bold;
+				border-radius: 3px;
+			`+"`"+`;
+			fragment.appendChild(tag);
+		}
+		root.appendChild(fragment);
+	}`, overlayID, tags)
+}
+
+// removeOverlay takes the grid and tags off the page. It doesn't panic, so it can
+// run deferred after a failed capture; if it fails, the next drawOverlay cleans up.
+func removeOverlay(page *rod.Page) error {
+	_, err := page.Eval(`(id) => document.getElementById(id)?.remove()`, overlayID)
+	return err
+}
@@ -0,0 +1,224 @@
+package browserfactory
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-rod/rod/lib/proto"
+	"github.com/ysmood/gson"
+)
+
+// maxTextLength caps a line of page text, so one long paragraph can't crowd the
+// form out of the planner's prompt.
+const maxTextLength = 200
+
+// sectionRoles are containers worth naming in page text, since they tell the
+// planner which part of the page a control belongs to.
+var sectionRoles = map[string]bool{
+	"form":        true,
+	"dialog":      true,
+	"alertdialog": true,
+	"region":      true,
+	"main":        true,
+	"group":       true,
+	"radiogroup":  true,
+}
+
+// plainInputTypes are input types the role already says everything about.
+var plainInputTypes = map[string]bool{
+	"text":     true,
+	"checkbox": true,
+	"radio":    true,
+	"button":   true,
+	"submit":   true,
+}
+
+// pageTextWriter renders one capture's documents as compact, markdown-like text.
+type pageTextWriter struct {
+	out     strings.Builder
+	indexes map[*proto.AccessibilityAXNode]int
+}
+
+// renderPageText describes the page in text for models that can't see, or as
+// context next to a screenshot: headings, named sections, text, and every tagged
+// control with its tag index, label, type, state, value and options. Controls
+// that weren't tagged aren't rendered, so nothing can act on them and they are
+// left out.
+func renderPageText(frames []frameDocument, taggedNodes []*TaggedAccessibilityNode) string {
+	w := &pageTextWriter{indexes: make(map[*proto.AccessibilityAXNode]int, len(taggedNodes))}
+	for _, node := range taggedNodes {
+		w.indexes[node.Node] = node.Index
+	}
+
+	for i, frame := range frames {
+		byID := make(map[proto.AccessibilityAXNodeID]*proto.AccessibilityAXNode, len(frame.nodes))
+		for _, node := range frame.nodes {
+			byID[node.NodeID] = node
+		}
+		for _, node := range frame.nodes {
+			if node.ParentID == "" {
+				w.writeDocument(node, byID, frame.inputTypes, i == 0)
+			}
+		}
+	}
+	return strings.TrimSpace(w.out.String())
+}
+
+func (w *pageTextWriter) writeDocument(root *proto.AccessibilityAXNode, byID map[proto.AccessibilityAXNodeID]*proto.AccessibilityAXNode,
+	inputTypes map[proto.DOMBackendNodeID]string, top bool) {
+	_, title := roleAndName(root)
+	title = compactText(title)
+	switch {
+	case top:
+		fmt.Fprintf(&w.out, "Title: %s\n", title)
+	case title != "":
+		fmt.Fprintf(&w.out, "\n--- frame: %s ---\n", title)
+	default:
+		w.out.WriteString("\n--- frame ---\n")
+	}
+
+	var walk func(node *proto.AccessibilityAXNode, indent string)
+	walk = func(node *proto.AccessibilityAXNode, indent string) {
+		children := func(indent string) {
+			for _, id := range node.ChildIDs {
+				if child, exists := byID[id]; exists {
+					walk(child, indent)
+				}
+			}
+		}
+		if node.Ignored {
+			children(indent)
+			return
+		}
+
+		role, name := roleAndName(node)
+		name = compactText(name)
+		switch {
+		case role == "heading":
+			level := min(max(axProperty(node, "level").Int(), 1), 6)
+			fmt.Fprintf(&w.out, "\n%s %s\n", strings.Repeat("#", level), name)
+		case isInteractive(node):
+			index, tagged := w.indexes[node]
+			if !tagged {
+				return
+			}
+			w.writeControl(node, index, inputTypes[node.BackendDOMNodeID], indent)
+			for _, option := range descendantOptions(node, byID) {
+				w.writeOption(option, indent+"  ")
+			}
+		case role == "labeltext":
+			// Labels come out as the names of the controls they label.
+		case role == "statictext":
+			if name != "" {
+				fmt.Fprintf(&w.out, "%s%s\n", indent, truncateText(name))
+			}
+		case sectionRoles[role] && name != "":
+			fmt.Fprintf(&w.out, "\n%s**%s: %s**\n", indent, role, name)
+			children(indent + "  ")
+		default:
+			children(indent)
+		}
+	}
+	walk(root, "")
+}
+
+// writeControl writes one line such as
+//
+//	[12] textbox (email) "Email" = "jane@example.com" required invalid
+func (w *pageTextWriter) writeControl(node *proto.AccessibilityAXNode, index int, inputType, indent string) {
+	role, name := roleAndName(node)
+	line := fmt.Sprintf("%s[%d] %s", indent, index, role)
+	if inputType != "" && !plainInputTypes[inputType] {
+		line += fmt.Sprintf(" (%s)", inputType)
+	}
+	line += fmt.Sprintf(" %q", truncateText(compactText(name)))
+	if node.Value != nil && !node.Value.Value.Nil() {
+		if value := compactText(node.Value.Value.String()); value != "" {
+			line += fmt.Sprintf(" = %q", truncateText(value))
+		}
+	}
+	if states := controlStates(node); len(states) > 0 {
+		line += " " + strings.Join(states, " ")
+	}
+	if node.Description != nil && !node.Description.Value.Nil() {
+		if description := compactText(node.Description.Value.String()); description != "" {
+			line += fmt.Sprintf(" (hint: %s)", truncateText(description))
+		}
+	}
+	w.out.WriteString(line + "\n")
+}
+
+// writeOption lists an option of a control, with its tag index if it has one.
+func (w *pageTextWriter) writeOption(node *proto.AccessibilityAXNode, indent string) {
+	_, name := roleAndName(node)
+	line := indent + "- "
+	if index, tagged := w.indexes[node]; tagged {
+		line += fmt.Sprintf("[%d] ", index)
+	}
+	line += truncateText(compactText(name))
+	if axProperty(node, "selected").Bool() {
+		line += " (selected)"
+	}
+	w.out.WriteString(line + "\n")
+}
+
+// controlStates lists the states of node the planner acts on.
+func controlStates(node *proto.AccessibilityAXNode) []string {
+	var states []string
+	switch axProperty(node, "checked").String() {
+	case "true":
+		states = append(states, "checked")
+	case "mixed":
+		states = append(states, "partly-checked")
+	}
+	for _, flag := range []string{"selected", "required", "disabled", "readonly"} {
+		if axProperty(node, flag).Bool() {
+			states = append(states, flag)
+		}
+	}
+	if invalid := axProperty(node, "invalid"); !invalid.Nil() && invalid.String() != "false" {
+		states = append(states, "invalid")
+	}
+	return states
+}
+
+// descendantOptions collects the options below a control such as a select or a
+// combobox, wherever its popup nests them.
+func descendantOptions(node *proto.AccessibilityAXNode, byID map[proto.AccessibilityAXNodeID]*proto.AccessibilityAXNode) []*proto.AccessibilityAXNode {
+	var options []*proto.AccessibilityAXNode
+	for _, id := range node.ChildIDs {
+		child, exists := byID[id]
+		if !exists {
+			continue
+		}
+		if role, _ := roleAndName(child); role == "option" && !child.Ignored {
+			options = append(options, child)
+			continue
+		}
+		options = append(options, descendantOptions(child, byID)...)
+	}
+	return options
+}
+
+// axProperty returns the value of node's property name, or a nil value.
+func axProperty(node *proto.AccessibilityAXNode, name string) gson.JSON {
+	for _, property := range node.Properties {
+		if string(property.Name) == name && property.Value != nil {
+			return property.Value.Value
+		}
+	}
+	return gson.JSON{}
+}
+
+// compactText collapses runs of whitespace, which page text is full of.
+func compactText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func truncateText(text string) string {
+	runes := []rune(text)
+	if len(runes) <= maxTextLength {
+		return text
+	}
+	return string(runes[:maxTextLength]) + "…"
+}
@@ -0,0 +1,216 @@
+package browserfactory
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/cdp"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// ErrStaleElement means an element no longer matches what a capture recorded
+// about it: it left the page, or something else now sits behind its node.
+var ErrStaleElement = errors.New("stale element")
+
+// maxBoundsDrift is how far, in CSS pixels, an element may move between capture
+// and action and still count as the same one. It absorbs small layout shifts such
+// as a validation message appearing above a field.
+const maxBoundsDrift = 64.0
+
+// Fingerprint is what a capture saw of an element, kept to check that the node an
+// action resolves to is still that element.
+type Fingerprint struct {
+	Role   string        `json:"role"`
+	Name   string        `json:"name"`
+	Bounds proto.DOMRect `json:"bounds"`
+	// Scroll is the top page's scroll offset at capture, so drift is measured on
+	// the document rather than the viewport and scrolling between capture and
+	// action doesn't count as the element moving.
+	Scroll proto.Point `json:"scroll"`
+}
+
+// NodeRef points at an element tagged by an earlier capture.
+type NodeRef struct {
+	Index         int                    `json:"index"`
+	BackendNodeID proto.DOMBackendNodeID `json:"backend_node_id"`
+	Frame         *FrameRef              `json:"frame,omitempty"`
+	Fingerprint   Fingerprint            `json:"fingerprint"`
+}
+
+// Ref returns a reference to t that Resolve can check against the live page.
+func (t *TaggedAccessibilityNode) Ref() NodeRef {
+	role, name := roleAndName(t.Node)
+	ref := NodeRef{
+		Index:       t.Index,
+		Frame:       t.Frame,
+		Fingerprint: Fingerprint{Role: role, Name: name, Scroll: t.Scroll},
+	}
+	if t.Node != nil {
+		ref.BackendNodeID = t.Node.BackendDOMNodeID
+	}
+	if t.Bounds != nil {
+		ref.Fingerprint.Bounds = *t.Bounds
+	}
+	return ref
+}
+
+// Resolve finds the element ref points at without re-tagging the page, looking in
+// the frame it was tagged in. It fails with ErrStaleElement if the node is gone,
+// is no longer rendered, or its role, name or position no longer match the
+// fingerprint.
+func (b *BrowserFactory) Resolve(page *rod.Page, ref NodeRef) (*TaggedAccessibilityNode, error) {
+	session, err := frameSession(page, ref.Frame)
+	if err != nil {
+		return nil, fmt.Errorf("%w: the frame of element %d is gone", ErrStaleElement, ref.Index)
+	}
+
+	res, err := proto.AccessibilityGetPartialAXTree{
+		BackendNodeID:  ref.BackendNodeID,
+		FetchRelatives: false,
+	}.Call(session)
+	if err != nil {
+		// The browser answering with an error means it no longer knows the node.
+		var cdpErr *cdp.Error
+		if errors.As(err, &cdpErr) {
+			return nil, fmt.Errorf("%w: element %d is no longer on the page", ErrStaleElement, ref.Index)
+		}
+		return nil, fmt.Errorf("failed to look up element %d: %w", ref.Index, err)
+	}
+
+	var node *proto.AccessibilityAXNode
+	for _, candidate := range res.Nodes {
+		if candidate.BackendDOMNodeID == ref.BackendNodeID {
+			node = candidate
+			break
+		}
+	}
+	if node == nil {
+		return nil, fmt.Errorf("%w: element %d is no longer on the page", ErrStaleElement, ref.Index)
+	}
+
+	role, name := roleAndName(node)
+	if role != ref.Fingerprint.Role || name != ref.Fingerprint.Name {
+		return nil, fmt.Errorf("%w: element %d was %s %q, now %s %q",
+			ErrStaleElement, ref.Index, ref.Fingerprint.Role, ref.Fingerprint.Name, role, name)
+	}
+
+	bounds, err := pageBounds(page, session, ref.Frame, node)
+	if err != nil {
+		return nil, err
+	}
+	if bounds == nil {
+		return nil, fmt.Errorf("%w: element %d is no longer rendered", ErrStaleElement, ref.Index)
+	}
+	scroll, err := pageScroll(page)
+	if err != nil {
+		return nil, err
+	}
+	// Compare positions on the document: scrolling moves every element in the
+	// viewport without moving any of them on the page.
+	x, y := bounds.X+scroll.X, bounds.Y+scroll.Y
+	wasX, wasY := ref.Fingerprint.Bounds.X+ref.Fingerprint.Scroll.X, ref.Fingerprint.Bounds.Y+ref.Fingerprint.Scroll.Y
+	if math.Abs(x-wasX) > maxBoundsDrift || math.Abs(y-wasY) > maxBoundsDrift {
+		return nil, fmt.Errorf("%w: element %d moved from (%.0f, %.0f) to (%.0f, %.0f)", ErrStaleElement, ref.Index,
+			wasX, wasY, x, y)
+	}
+
+	return &TaggedAccessibilityNode{
+		Node:        node,
+		Element:     getElementFromNode(session, node),
+		Frame:       ref.Frame,
+		Bounds:      bounds,
+		Scroll:      scroll,
+		Index:       ref.Index,
+		Description: getDescriptionFromNode(node, ref.Index),
+	}, nil
+}
+
+// roleAndName reads the lowercased role and the accessible name of node.
+func roleAndName(node *proto.AccessibilityAXNode) (string, string) {
+	if node == nil {
+		return "", ""
+	}
+	role, name := "", ""
+	if node.Role != nil && !node.Role.Value.Nil() {
+		role = strings.ToLower(node.Role.Value.String())
+	}
+	if node.Name != nil && !node.Name.Value.Nil() {
+		name = node.Name.Value.String()
+	}
+	return role, name
+}
+
+// pageBounds measures node, which lives in session, relative to the top page's
+// viewport. It returns nil bounds for nodes that aren't rendered.
+func pageBounds(page, session *rod.Page, frame *FrameRef, node *proto.AccessibilityAXNode) (*proto.DOMRect, error) {
+	bounds := getNodeBounds(session, node)
+	if bounds == nil {
+		return nil, nil
+	}
+	offset, err := frameOffset(page, frame)
+	if err != nil {
+		return nil, err
+	}
+	bounds.X += offset.X
+	bounds.Y += offset.Y
+	return bounds, nil
+}
+
+// pageScroll reads how far the top page is scrolled, in CSS pixels.
+func pageScroll(page *rod.Page) (proto.Point, error) {
+	metrics, err := proto.PageGetLayoutMetrics{}.Call(page)
+	if err != nil {
+		return proto.Point{}, fmt.Errorf("failed to read the page's scroll offset: %w", err)
+	}
+	if metrics.CSSVisualViewport == nil {
+		return proto.Point{}, nil
+	}
+	return proto.Point{X: metrics.CSSVisualViewport.PageX, Y: metrics.CSSVisualViewport.PageY}, nil
+}
+
+// getNodeBounds measures node's border box in its session's viewport, or
+// returns nil if it has no box.
+func getNodeBounds(page *rod.Page, node *proto.AccessibilityAXNode) *proto.DOMRect {
+	if node.BackendDOMNodeID == 0 {
+		return nil
+	}
+
+	res, err := proto.DOMGetBoxModel{BackendNodeID: node.BackendDOMNodeID}.Call(page)
+	if err != nil || res.Model == nil || len(res.Model.Border) < 8 {
+		return nil
+	}
+
+	// Model.Border is [x1, y1, x2, y2, x3, y3, x4, y4] - use top-left corner
+	x := res.Model.Border[0]
+	y := res.Model.Border[1]
+	// Calculate width/height from quad points
+	width := res.Model.Border[2] - res.Model.Border[0]  // x2 - x1
+	height := res.Model.Border[5] - res.Model.Border[1] // y3 - y1
+
+	return &proto.DOMRect{
+		X:      x,
+		Y:      y,
+		Width:  width,
+		Height: height,
+	}
+}
+
+// getElementFromNode returns a handle to node's DOM element, or nil if it has
+// none.
+func getElementFromNode(page *rod.Page, node *proto.AccessibilityAXNode) *rod.Element {
+	if node.BackendDOMNodeID == 0 {
+		return nil
+	}
+
+	el, err := page.ElementFromNode(&proto.DOMNode{
+		BackendNodeID: node.BackendDOMNodeID,
+	})
+	if err != nil {
+		return nil
+	}
+
+	return el
+}
@@ -7,14 +7,54 @@ import (
 
 type BrowserClient interface {
 	GetBrowser() *rod.Browser
-	ScreenshotForLLM(*rod.Page, string) (string, []*TaggedAccessibilityNode, error)
+	ScreenshotForLLM(page *rod.Page, options CaptureOptions) (Capture, error)
+	// Resolve finds an element from an earlier capture on the live page.
+	Resolve(page *rod.Page, ref NodeRef) (*TaggedAccessibilityNode, error)
+	// DescribeField reads a form control's field model; nil if node isn't one.
+	DescribeField(page *rod.Page, node *TaggedAccessibilityNode) (*FormField, error)
+	ValidationErrors(page *rod.Page) ([]ValidationError, error)
 	OpenPageNewTab(browser *rod.Browser, url string) *rod.Page
+	Click(page *rod.Page, node *TaggedAccessibilityNode) error
+	Input(page *rod.Page, node *TaggedAccessibilityNode, text string) error
+	// PressKey presses a key or chord such as "Shift+Tab"; node, if not nil, is
+	// focused first.
+	PressKey(page *rod.Page, node *TaggedAccessibilityNode, chord string) error
+	Scroll(page *rod.Page, ratio float64, multiplier float64) error
+	Navigate(page *rod.Page, url string) error
+	ClosePage(page *rod.Page) error
+}
+
+// CaptureOptions picks what ScreenshotForLLM returns besides the annotated screenshot.
+type CaptureOptions struct {
+	// Clean also captures the viewport before any overlay is drawn.
+	Clean bool
+	// Text also describes the page in text, covering all of it rather than the viewport.
+	Text bool
+}
+
+// Capture is one ScreenshotForLLM call. Screenshots are PNG encoded.
+type Capture struct {
+	// Annotated shows the grid and the index tags of TaggedNodes.
+	Annotated []byte
+	// Clean is the page as a user sees it; nil unless CaptureOptions.Clean was set.
+	Clean []byte
+	// Text is markdown-like page text naming controls by their tag index; empty
+	// unless CaptureOptions.Text was set.
+	Text        string
+	TaggedNodes []*TaggedAccessibilityNode
 }
 
 type TaggedAccessibilityNode struct {
-	Node        *proto.AccessibilityAXNode
-	Element     *rod.Element
-	Bounds      *proto.DOMRect
+	Node    *proto.AccessibilityAXNode
+	Element *rod.Element
+	// Frame is set for nodes inside out-of-process iframes.
+	Frame *FrameRef
+	// Bounds are relative to the top page's viewport, whatever frame the node is in.
+	Bounds *proto.DOMRect
+	// Scroll is the top page's scroll offset when Bounds were measured. Adding
+	// it to Bounds gives the element's position on the document, which scrolling
+	// doesn't change.
+	Scroll      proto.Point
 	Index       int
 	Description string
 }
@@ -24,6 +64,8 @@ type TaggedAccessibilityNode struct {
 type SerializableTaggedNode struct {
 	Index       int     `json:"index"`
 	Description string  `json:"description"`
+	Role        string  `json:"role,omitempty"`
+	Name        string  `json:"name,omitempty"`
 	X           float64 `json:"x"`
 	Y           float64 `json:"y"`
 	Width       float64 `json:"width"`
@@ -32,7 +74,7 @@ type SerializableTaggedNode struct {
 
 // ToSerializable converts TaggedAccessibilityNode to SerializableTaggedNode
 func (t *TaggedAccessibilityNode) ToSerializable() SerializableTaggedNode {
-	return SerializableTaggedNode{
+	serializable := SerializableTaggedNode{
 		Index:       t.Index,
 		Description: t.Description,
 		X:           t.Bounds.X,
@@ -40,4 +82,6 @@ func (t *TaggedAccessibilityNode) ToSerializable() SerializableTaggedNode {
 		Width:       t.Bounds.Width,
 		Height:      t.Bounds.Height,
 	}
+	serializable.Role, serializable.Name = roleAndName(t.Node)
+	return serializable
 }
@@ -0,0 +1,244 @@
+package browserfactory
+
+import (
+	"fmt"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// ValidationError is an error message the page shows, usually after a submit.
+type ValidationError struct {
+	// BackendNodeID is the control the error is about, or 0 for messages about
+	// the form as a whole.
+	BackendNodeID proto.DOMBackendNodeID `json:"backend_node_id,omitempty"`
+	// Frame is the out-of-process iframe the error was found in, or nil for the
+	// top page and its same-process iframes, as on TaggedAccessibilityNode.
+	Frame *FrameRef `json:"frame,omitempty"`
+	// Field is the control's label.
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+	// Source says how the error was found: "aria-invalid", "validity", "alert"
+	// or "css".
+	Source string `json:"source"`
+}
+
+// validationScript finds the errors shown on the page, looking into open shadow
+// roots and iframes the page can reach. Controls count as invalid when they say so through aria-invalid, when
+// HTML5 validation failed after the user interacted with them, or when they carry
+// one of a short list of error classes common form libraries use. Visible alerts
+// and elements with those classes are tied to the control they describe, through
+// aria-describedby/aria-errormessage or by being the only control in a nearby
+// container. Classes merely containing "error" or "invalid" don't count, since
+// pages use them for icons, hidden templates and their own styling hooks. It
+// returns the controls and the errors, which refer to controls by position, and
+// whether any iframe was out of reach and has to be searched on its own.
+const validationScript = `() => {
+	const text = (node) => (node?.innerText ?? node?.textContent ?? '').replace(/\s+/g, ' ').trim();
+	const composedParent = (node) => node.parentNode || node.host;
+	const visible = (el) => {
+		const rect = el.getBoundingClientRect();
+		const style = getComputedStyle(el);
+		return rect.width > 0 && rect.height > 0 && style.visibility !== 'hidden' && style.display !== 'none';
+	};
+	let unreachableFrames = false;
+	const all = (root, selector) => {
+		const found = Array.from(root.querySelectorAll(selector));
+		for (const host of root.querySelectorAll('*')) {
+			if (host.shadowRoot) found.push(...all(host.shadowRoot, selector));
+			if (host.matches('iframe, frame')) {
+				if (host.contentDocument) found.push(...all(host.contentDocument, selector));
+				else unreachableFrames = true;
+			}
+		}
+		return found;
+	};
+	const byIds = (el, ids) => (ids || '').split(/\s+/).map((id) => id && el.getRootNode().getElementById?.(id)).filter(Boolean);
+
+	const controlSelector = 'input:not([type=hidden]):not([type=submit]):not([type=button]), select, textarea, ' +
+		'[role=textbox], [role=combobox], [role=listbox], [role=checkbox], [role=radio], [role=switch], [role=slider], [role=spinbutton]';
+	const errorSelector = '[role=alert], [aria-live=assertive], .error, .errors, .invalid-feedback, .is-invalid, ' +
+		'.field-error, .form-error, .error-message, .error-text, .validation-error, .field-validation-error, ' +
+		'.parsley-errors-list, .ng-invalid.ng-touched, mat-error';
+
+	const controls = [];
+	const errors = [];
+	const seen = new Set();
+	const add = (control, message, source) => {
+		message = (message || '').slice(0, 300);
+		let field = -1;
+		if (control) {
+			field = controls.indexOf(control);
+			if (field < 0) field = controls.push(control) - 1;
+		}
+		const key = field + '|' + message;
+		if (seen.has(key)) return;
+		seen.add(key);
+		errors.push({ field, label: control ? label(control) : '', message, source });
+	};
+	const label = (control) => byIds(control, control.getAttribute('aria-labelledby')).map(text).join(' ').trim() ||
+		Array.from(control.labels || []).map(text).join(' ').trim() ||
+		control.getAttribute('aria-label') || control.getAttribute('placeholder') || control.getAttribute('name') || '';
+	const describedErrors = (control) => [
+		...byIds(control, control.getAttribute('aria-errormessage')),
+		...byIds(control, control.getAttribute('aria-describedby')).filter((el) => el.matches(errorSelector)),
+	].filter(visible).map(text).filter(Boolean);
+	const controlError = (control, source) => {
+		const messages = describedErrors(control);
+		if (messages.length === 0) messages.push(control.validationMessage || '');
+		for (const message of messages) add(control, message, source);
+	};
+
+	// A control an error element describes: one pointing at it, or the only
+	// control in a container a few levels up.
+	const describedControl = (el, candidates) => {
+		if (el.id) {
+			const pointing = candidates.find((control) =>
+				[control.getAttribute('aria-describedby'), control.getAttribute('aria-errormessage')]
+					.some((ids) => (ids || '').split(/\s+/).includes(el.id)));
+			if (pointing) return pointing;
+		}
+		for (let node = composedParent(el), depth = 0; node && node.querySelectorAll && depth < 4; node = composedParent(node), depth++) {
+			const inside = Array.from(node.querySelectorAll(controlSelector));
+			if (inside.length === 1) return inside[0];
+			if (inside.length > 1) return null;
+		}
+		return null;
+	};
+
+	const candidates = all(document, controlSelector);
+	for (const control of candidates) {
+		if (control.getAttribute('aria-invalid') === 'true') {
+			controlError(control, 'aria-invalid');
+			continue;
+		}
+		let userInvalid = false;
+		try {
+			userInvalid = control.matches(':user-invalid');
+		} catch (e) {}
+		if (userInvalid) controlError(control, 'validity');
+	}
+
+	for (const el of all(document, errorSelector)) {
+		if (!visible(el)) continue;
+		if (el.matches(controlSelector)) {
+			// Angular marks required fields invalid before anyone has touched them.
+			if (!controls.includes(el) && !el.matches('.ng-untouched')) controlError(el, 'css');
+			continue;
+		}
+		// Wrappers such as .has-error hold the field itself; their inner error
+		// elements are reported instead.
+		if (el.querySelector(controlSelector) || el.querySelector(errorSelector)) continue;
+		const message = text(el);
+		if (!message) continue;
+		const source = el.matches('[role=alert], [aria-live=assertive]') ? 'alert' : 'css';
+		add(describedControl(el, candidates), message, source);
+	}
+
+	// A control reported once with the browser's message and once with the
+	// page's own keeps only the page's.
+	const withText = new Set(errors.filter((error) => error.message && error.field >= 0).map((error) => error.field));
+	const kept = errors.filter((error) => error.message || !withText.has(error.field));
+	return { controls, errors: kept, unreachableFrames };
+}`
+
+// ValidationErrors collects the error messages the page currently shows, open
+// shadow roots and iframes included. Embedded application forms, e.g.
+// Greenhouse's and Lever's, live in cross-origin iframes, which site isolation
+// puts in processes of their own. It is best effort: pages signal errors in many
+// ways and only the common ones are recognized, and frames that can't be read
+// are skipped.
+func (b *BrowserFactory) ValidationErrors(page *rod.Page) ([]ValidationError, error) {
+	return frameValidationErrors(page, page, nil, 0)
+}
+
+// frameValidationErrors searches the documents session reaches, then the
+// out-of-process iframes among them the same way captureSession does.
+func frameValidationErrors(page, session *rod.Page, frame *FrameRef, depth int) ([]ValidationError, error) {
+	validationErrors, unreachableFrames, err := sessionValidationErrors(session, frame)
+	if err != nil {
+		return nil, err
+	}
+	if !unreachableFrames || depth >= maxFrameDepth {
+		return validationErrors, nil
+	}
+
+	// Only frames the script couldn't enter are worth a snapshot. A cross-origin
+	// frame sharing the page's process, which happens only without site
+	// isolation, has no session of its own and isn't searched.
+	layout, err := captureLayout(session, proto.Point{})
+	if err != nil {
+		return validationErrors, nil
+	}
+	for _, owner := range layout.remoteFrameOwners {
+		child, err := remoteFrame(session, frame, owner)
+		if err != nil {
+			continue
+		}
+		childSession, err := frameSession(page, child)
+		if err != nil {
+			continue
+		}
+		childErrors, err := frameValidationErrors(page, childSession, child, depth+1)
+		if err != nil {
+			continue
+		}
+		validationErrors = append(validationErrors, childErrors...)
+	}
+	return validationErrors, nil
+}
+
+// sessionValidationErrors runs validationScript in session's main document,
+// reporting whether it met iframes it couldn't enter.
+func sessionValidationErrors(session *rod.Page, frame *FrameRef) ([]ValidationError, bool, error) {
+	found, err := session.Evaluate(rod.Eval(validationScript).ByObject())
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to look for validation errors: %w", err)
+	}
+	defer session.Release(found)
+
+	res, err := session.Evaluate(rod.Eval(`function () { return { errors: this.errors, unreachableFrames: this.unreachableFrames } }`).This(found))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read validation errors: %w", err)
+	}
+	var result struct {
+		Errors []struct {
+			Field   int    `json:"field"`
+			Label   string `json:"label"`
+			Message string `json:"message"`
+			Source  string `json:"source"`
+		} `json:"errors"`
+		UnreachableFrames bool `json:"unreachableFrames"`
+	}
+	if err := res.Value.Unmarshal(&result); err != nil {
+		return nil, false, fmt.Errorf("failed to read validation errors: %w", err)
+	}
+	detected := result.Errors
+	if len(detected) == 0 {
+		return nil, result.UnreachableFrames, nil
+	}
+
+	controls, err := session.ElementsByJS(rod.Eval(`function () { return this.controls }`).This(found))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read invalid controls: %w", err)
+	}
+	// The page runs this after every action, so its handles mustn't pile up.
+	defer func() {
+		for _, control := range controls {
+			control.Release()
+		}
+	}()
+
+	validationErrors := make([]ValidationError, 0, len(detected))
+	for _, detection := range detected {
+		validationError := ValidationError{Field: detection.Label, Message: detection.Message, Source: detection.Source, Frame: frame}
+		if detection.Field >= 0 && detection.Field < len(controls) {
+			node, err := proto.DOMDescribeNode{ObjectID: controls[detection.Field].Object.ObjectID}.Call(session)
+			if err == nil && node.Node != nil {
+				validationError.BackendNodeID = node.Node.BackendNodeID
+			}
+		}
+		validationErrors = append(validationErrors, validationError)
+	}
+	return validationErrors, result.UnreachableFrames, nil
+}
@@ -0,0 +1,50 @@
+package browserfactory
+
+import "testing"
+
+func TestValidationErrors(t *testing.T) {
+	factory, page := testPage(t, `<!doctype html><html><body><form>
+		<div><label for="email">Email</label>
+			<input id="email" aria-invalid="true" aria-describedby="email-error">
+			<span id="email-error" class="error-message">Enter a valid email</span></div>
+		<div><label for="name">Name</label><input id="name"><i class="icon-error-outline">!</i></div>
+		<div class="no-errors-banner">All good so far</div>
+		<div role="alert">Please fix the errors below</div>
+	</form></body></html>`)
+
+	found, err := factory.ValidationErrors(page)
+	if err != nil {
+		t.Fatalf("ValidationErrors: %v", err)
+	}
+
+	messages := map[string]string{}
+	for _, validationError := range found {
+		messages[validationError.Message] = validationError.Field
+	}
+	if field, ok := messages["Enter a valid email"]; !ok || field != "Email" {
+		t.Errorf("errors = %+v, want the email error tied to Email", found)
+	}
+	if _, ok := messages["Please fix the errors below"]; !ok {
+		t.Errorf("errors = %+v, want the alert", found)
+	}
+	if len(found) != 2 {
+		t.Errorf("errors = %+v, want only the email error and the alert", found)
+	}
+}
+
+func TestValidationErrorsInIframe(t *testing.T) {
+	factory, page := testPage(t, `<!doctype html><html><body>
+		<iframe srcdoc="<label for=phone>Phone</label>
+			<input id=phone aria-invalid=true aria-errormessage=phone-error>
+			<span id=phone-error>Enter a phone number</span>"></iframe>
+	</body></html>`)
+	page.MustElement("iframe").MustFrame().MustElement("#phone")
+
+	found, err := factory.ValidationErrors(page)
+	if err != nil {
+		t.Fatalf("ValidationErrors: %v", err)
+	}
+	if len(found) != 1 || found[0].Field != "Phone" || found[0].Message != "Enter a phone number" || found[0].BackendNodeID == 0 {
+		t.Errorf("errors = %+v, want the phone error from the iframe, tied to its control", found)
+	}
+}
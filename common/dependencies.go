@@ -1,43 +1,242 @@
 package common
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/SomtoJF/iris-worker/aipi"
+	"github.com/SomtoJF/iris-worker/aipi/anthropic"
+	"github.com/SomtoJF/iris-worker/aipi/cache"
+	"github.com/SomtoJF/iris-worker/aipi/ollama"
+	"github.com/SomtoJF/iris-worker/aipi/openaicompat"
+	localOpenRouter "github.com/SomtoJF/iris-worker/aipi/openrouter"
+	"github.com/SomtoJF/iris-worker/aipi/pricing"
+	"github.com/SomtoJF/iris-worker/aipi/types"
+	"github.com/SomtoJF/iris-worker/artifact"
 	"github.com/SomtoJF/iris-worker/browserfactory"
-	"github.com/SomtoJF/iris-worker/initializers/fs"
+	"github.com/SomtoJF/iris-worker/initializers/sqldb"
+	"github.com/SomtoJF/iris-worker/replay"
 	"github.com/revrost/go-openrouter"
 )
 
 type Dependencies interface {
-	GetAIPIClient() *aipi.AIPIClient
+	GetAIPIClient() types.AIPI
+	// GetPricingRegistry returns nil when replaying a bundle.
+	GetPricingRegistry() *pricing.Registry
 	GetBrowserClient() browserfactory.BrowserClient
+	GetArtifactStore() artifact.Store
 	Cleanup()
 }
 
 type dependencies struct {
-	aipiClient    *aipi.AIPIClient
+	aipiClient    types.AIPI
+	pricing       *pricing.Registry
+	stopPricing   context.CancelFunc
+	llmCache      *cache.CachedAIPI
 	browserClient browserfactory.BrowserClient
-	fs            *fs.TemporaryFileSystem
+	artifacts     artifact.Store
+	stopRetention context.CancelFunc
 }
 
-func (d *dependencies) GetAIPIClient() *aipi.AIPIClient {
+func (d *dependencies) GetAIPIClient() types.AIPI {
 	return d.aipiClient
 }
 
+func (d *dependencies) GetPricingRegistry() *pricing.Registry {
+	return d.pricing
+}
+
 func (d *dependencies) GetBrowserClient() browserfactory.BrowserClient {
 	return d.browserClient
 }
 
+func (d *dependencies) GetArtifactStore() artifact.Store {
+	return d.artifacts
+}
+
 func (d *dependencies) Cleanup() {
-	d.fs.Cleanup()
+	if d.stopPricing != nil {
+		d.stopPricing()
+	}
+	if d.stopRetention != nil {
+		d.stopRetention()
+	}
+	if d.llmCache != nil {
+		stats := d.llmCache.Stats()
+		log.Printf("llm cache: %d hits, %d misses, %d bypassed", stats.Hits.Load(), stats.Misses.Load(), stats.Bypassed.Load())
+	}
 }
 
 func MakeDependencies() (Dependencies, error) {
-	fs := fs.NewTemporaryFilesystem()
-	return &dependencies{
-		aipiClient:    aipi.NewAIPIClient(openrouter.NewClient(os.Getenv("OPENROUTER_API_KEY"))),
-		browserClient: browserfactory.NewBrowserFactory(fs),
-		fs:            fs,
-	}, nil
+	artifacts, err := makeArtifactStore()
+	if err != nil {
+		return nil, err
+	}
+
+	retention := 7 * 24 * time.Hour
+	if raw := os.Getenv("ARTIFACT_RETENTION"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ARTIFACT_RETENTION: %w", err)
+		}
+		retention = parsed
+	}
+
+	// Replaying a bundle serves recorded browser and LLM calls, so neither a
+	// browser nor a model is needed.
+	if bundleDir := os.Getenv("REPLAY_BUNDLE_DIR"); bundleDir != "" {
+		bundle, err := replay.OpenBundle(bundleDir)
+		if err != nil {
+			return nil, err
+		}
+		deps := &dependencies{
+			aipiClient:    replay.NewReplayAIPI(bundle),
+			browserClient: replay.NewReplayBrowserClient(bundle),
+			artifacts:     artifacts,
+		}
+		deps.startRetention(retention)
+		return deps, nil
+	}
+
+	openRouterClient := localOpenRouter.NewClient(openrouter.DefaultConfig(os.Getenv("OPENROUTER_API_KEY")))
+	registry, err := makePricingRegistry(openRouterClient)
+	if err != nil {
+		return nil, err
+	}
+
+	aipiClient, err := makeAIPIClient(openRouterClient, registry)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := &dependencies{
+		aipiClient:    aipiClient,
+		pricing:       registry,
+		browserClient: browserfactory.NewBrowserFactory(),
+		artifacts:     artifacts,
+	}
+
+	refreshInterval := 6 * time.Hour
+	if raw := os.Getenv("MODEL_PRICING_REFRESH_INTERVAL"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MODEL_PRICING_REFRESH_INTERVAL: %w", err)
+		}
+		refreshInterval = parsed
+	}
+	pricingCtx, stopPricing := context.WithCancel(context.Background())
+	registry.Start(pricingCtx, refreshInterval)
+	deps.stopPricing = stopPricing
+
+	// The response cache is meant for prompt development and stays off unless a
+	// cache directory is configured.
+	if cacheDir := os.Getenv("LLM_CACHE_DIR"); cacheDir != "" {
+		ttl := 24 * time.Hour
+		if raw := os.Getenv("LLM_CACHE_TTL"); raw != "" {
+			parsed, err := time.ParseDuration(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid LLM_CACHE_TTL: %w", err)
+			}
+			ttl = parsed
+		}
+
+		llmCache, err := cache.NewCachedAIPI(deps.aipiClient, cacheDir, ttl)
+		if err != nil {
+			return nil, err
+		}
+		deps.llmCache = llmCache
+		deps.aipiClient = llmCache
+	}
+
+	if bundleDir := os.Getenv("RECORD_BUNDLE_DIR"); bundleDir != "" {
+		bundle, err := replay.NewBundle(bundleDir)
+		if err != nil {
+			return nil, err
+		}
+		deps.aipiClient = replay.NewRecordingAIPI(deps.aipiClient, bundle)
+		deps.browserClient = replay.NewRecordingBrowserClient(deps.browserClient, bundle)
+	}
+
+	deps.startRetention(retention)
+	return deps, nil
+}
+
+// startRetention sweeps expired artifacts, and expired llm cache entries if the
+// cache is on, every hour until Cleanup.
+func (d *dependencies) startRetention(maxAge time.Duration) {
+	ctx, stop := context.WithCancel(context.Background())
+	artifact.StartRetention(ctx, d.artifacts, maxAge, time.Hour)
+	if d.llmCache != nil {
+		d.llmCache.StartSweeping(ctx, time.Hour)
+	}
+	d.stopRetention = stop
+}
+
+// makeArtifactStore picks the backend from ARTIFACT_STORE: "local" (the default)
+// writes under ARTIFACT_DIR, "s3" writes to any S3-compatible bucket.
+func makeArtifactStore() (artifact.Store, error) {
+	switch backend := os.Getenv("ARTIFACT_STORE"); backend {
+	case "", "local":
+		dir := os.Getenv("ARTIFACT_DIR")
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "iris-artifacts")
+		}
+		return artifact.NewLocalStore(dir)
+	case "s3":
+		return artifact.NewS3Store(artifact.S3Config{
+			Endpoint:        os.Getenv("ARTIFACT_S3_ENDPOINT"),
+			Region:          os.Getenv("ARTIFACT_S3_REGION"),
+			Bucket:          os.Getenv("ARTIFACT_S3_BUCKET"),
+			Prefix:          os.Getenv("ARTIFACT_S3_PREFIX"),
+			AccessKeyID:     os.Getenv("ARTIFACT_S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("ARTIFACT_S3_SECRET_ACCESS_KEY"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown ARTIFACT_STORE %q", backend)
+	}
+}
+
+// makePricingRegistry prices models from OpenRouter's model list, snapshotted to
+// SQLite, with overrides from MODEL_PRICING_FILE for anything it gets wrong or lacks.
+func makePricingRegistry(openRouterClient *openrouter.Client) (*pricing.Registry, error) {
+	registry := pricing.NewRegistry(pricing.OpenRouterSource(openRouterClient), pricing.NewSQLiteStore(sqldb.DB))
+
+	if path := os.Getenv("MODEL_PRICING_FILE"); path != "" {
+		if err := registry.LoadOverrides(path); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+func makeAIPIClient(openRouterClient *openrouter.Client, registry *pricing.Registry) (*aipi.AIPIClient, error) {
+	config := aipi.DefaultConfig()
+
+	// LLM_RATE_LIMITS is a JSON object keyed by provider or model, e.g.
+	// {"openrouter": {"requests_per_minute": 120, "tokens_per_minute": 400000}}.
+	if raw := os.Getenv("LLM_RATE_LIMITS"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &config.RateLimits); err != nil {
+			return nil, fmt.Errorf("invalid LLM_RATE_LIMITS: %w", err)
+		}
+	}
+
+	client := aipi.NewAIPIClient(openRouterClient, registry, config)
+
+	client.RegisterProvider(aipi.ProviderOllama, ollama.NewOllamaProvider(os.Getenv("OLLAMA_BASE_URL")))
+
+	if baseURL := os.Getenv("OPENAI_COMPATIBLE_BASE_URL"); baseURL != "" {
+		client.RegisterProvider(aipi.ProviderOpenAICompatible,
+			openaicompat.NewOpenAICompatibleProvider(baseURL, os.Getenv("OPENAI_COMPATIBLE_API_KEY")))
+	}
+
+	if apiKey := os.Getenv("ANTHROPIC_API_KEY"); apiKey != "" {
+		client.RegisterProvider(aipi.ProviderAnthropic, anthropic.NewAnthropicProvider(os.Getenv("ANTHROPIC_BASE_URL"), apiKey))
+	}
+
+	return client, nil
 }
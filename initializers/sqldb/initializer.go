@@ -17,7 +17,10 @@ func ConnectToSQLite() error {
 	}
 	dbPath := homeDir + "/iris/db/gorm.db"
 
-	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{
+		// Lets activities tell constraint violations from transient failures.
+		TranslateError: true,
+	})
 	if err != nil {
 		return err
 	}
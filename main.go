@@ -6,6 +6,7 @@ import (
 	"github.com/SomtoJF/iris-worker/activity/browser"
 	"github.com/SomtoJF/iris-worker/activity/llm"
 	sqldbActivities "github.com/SomtoJF/iris-worker/activity/sqldb"
+	"github.com/SomtoJF/iris-worker/aipi/pricing"
 	"github.com/SomtoJF/iris-worker/common"
 	"github.com/SomtoJF/iris-worker/initializers/sqldb"
 	"github.com/SomtoJF/iris-worker/workflow/jobapplication"
@@ -24,6 +25,11 @@ func init() {
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	err = sqldbActivities.Migrate(sqldb.DB, &pricing.ModelInfo{})
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
 func main() {
@@ -63,9 +69,9 @@ func registerJobApplicationActivities(w worker.Worker, dependencies common.Depen
 	sqldbActivities := sqldbActivities.NewActivities(sqldb.DB)
 	w.RegisterActivity(sqldbActivities)
 
-	llmActivities := llm.NewActivity(dependencies.GetAIPIClient())
+	llmActivities := llm.NewActivity(dependencies.GetAIPIClient(), dependencies.GetPricingRegistry(), dependencies.GetArtifactStore())
 	w.RegisterActivity(llmActivities)
 
-	browserActivities := browser.NewActivities(dependencies.GetBrowserClient())
+	browserActivities := browser.NewActivities(dependencies.GetBrowserClient(), dependencies.GetArtifactStore())
 	w.RegisterActivity(browserActivities)
 }
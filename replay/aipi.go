@@ -0,0 +1,68 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/SomtoJF/iris-worker/aipi/types"
+)
+
+// RecordingAIPI writes every request and response that passes through it into the bundle.
+type RecordingAIPI struct {
+	next   types.AIPI
+	bundle *Bundle
+}
+
+func NewRecordingAIPI(next types.AIPI, bundle *Bundle) *RecordingAIPI {
+	return &RecordingAIPI{next: next, bundle: bundle}
+}
+
+func (r *RecordingAIPI) GetCompletion(ctx context.Context, req types.AIPIRequest) (types.AIPIResponse, error) {
+	return r.StreamCompletion(ctx, req, nil)
+}
+
+// StreamCompletion keeps streaming available while recording. Only the final
+// response is recorded, since replay hands it back in one piece.
+func (r *RecordingAIPI) StreamCompletion(ctx context.Context, req types.AIPIRequest, onDelta types.StreamHandler) (types.AIPIResponse, error) {
+	resp, err := types.Complete(ctx, r.next, req, onDelta)
+	if recordErr := r.bundle.appendLLMCall(LLMCall{Request: req, Response: resp, Error: recordLLMError(err)}); recordErr != nil {
+		log.Println("failed to record llm call:", recordErr)
+	}
+	return resp, err
+}
+
+// ReplayAIPI answers requests with the bundle's recorded responses in order. It
+// checks the model of each request so a diverging run fails instead of silently
+// getting answers meant for other prompts.
+type ReplayAIPI struct {
+	bundle *Bundle
+	mu     sync.Mutex
+	cursor int
+}
+
+func NewReplayAIPI(bundle *Bundle) *ReplayAIPI {
+	return &ReplayAIPI{bundle: bundle}
+}
+
+func (r *ReplayAIPI) GetCompletion(ctx context.Context, req types.AIPIRequest) (types.AIPIResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	calls := r.bundle.manifest.LLMCalls
+	if r.cursor >= len(calls) {
+		return types.AIPIResponse{}, fmt.Errorf("replay exhausted: no recorded llm call left for %s", req.Model)
+	}
+
+	call := calls[r.cursor]
+	if call.Request.Model != req.Model {
+		return types.AIPIResponse{}, fmt.Errorf("replay diverged at llm call %d: recorded model %s, got %s", r.cursor, call.Request.Model, req.Model)
+	}
+	r.cursor++
+
+	if call.Error != nil {
+		return types.AIPIResponse{}, call.Error.err()
+	}
+	return call.Response, nil
+}
@@ -0,0 +1,342 @@
+package replay
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/SomtoJF/iris-worker/browserfactory"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"github.com/ysmood/gson"
+)
+
+// RecordingBrowserClient passes every call through to the real client and writes
+// it, with its screenshot, DOM snapshot and tagged nodes, into the bundle.
+type RecordingBrowserClient struct {
+	next   browserfactory.BrowserClient
+	bundle *Bundle
+	mu     sync.Mutex
+	seq    int
+}
+
+func NewRecordingBrowserClient(next browserfactory.BrowserClient, bundle *Bundle) *RecordingBrowserClient {
+	return &RecordingBrowserClient{next: next, bundle: bundle}
+}
+
+func (r *RecordingBrowserClient) GetBrowser() *rod.Browser {
+	return r.next.GetBrowser()
+}
+
+func (r *RecordingBrowserClient) OpenPageNewTab(browser *rod.Browser, url string) *rod.Page {
+	page := r.next.OpenPageNewTab(browser, url)
+	r.record(BrowserCall{Method: MethodOpenPageNewTab, Url: url})
+	return page
+}
+
+func (r *RecordingBrowserClient) ScreenshotForLLM(page *rod.Page, options browserfactory.CaptureOptions) (browserfactory.Capture, error) {
+	capture, err := r.next.ScreenshotForLLM(page, options)
+
+	call := BrowserCall{Method: MethodScreenshotForLLM, Error: recordBrowserError(err)}
+	if err == nil {
+		seq := r.nextSeq()
+		call.PageText = capture.Text
+		call.TaggedNodes = make([]browserfactory.SerializableTaggedNode, len(capture.TaggedNodes))
+		for i, node := range capture.TaggedNodes {
+			call.TaggedNodes[i] = node.ToSerializable()
+		}
+
+		var writeErr error
+		call.ScreenshotFile, writeErr = r.bundle.writeFile(fmt.Sprintf("screenshots/%04d.png", seq), capture.Annotated)
+		if writeErr != nil {
+			log.Println("failed to record screenshot:", writeErr)
+		}
+		if capture.Clean != nil {
+			call.CleanScreenshotFile, writeErr = r.bundle.writeFile(fmt.Sprintf("screenshots/%04d-clean.png", seq), capture.Clean)
+			if writeErr != nil {
+				log.Println("failed to record clean screenshot:", writeErr)
+			}
+		}
+
+		if html, htmlErr := page.HTML(); htmlErr == nil {
+			call.DOMSnapshotFile, htmlErr = r.bundle.writeFile(fmt.Sprintf("dom/%04d.html", seq), []byte(html))
+			if htmlErr != nil {
+				log.Println("failed to record dom snapshot:", htmlErr)
+			}
+		}
+	}
+	r.record(call)
+
+	return capture, err
+}
+
+func (r *RecordingBrowserClient) Resolve(page *rod.Page, ref browserfactory.NodeRef) (*browserfactory.TaggedAccessibilityNode, error) {
+	node, err := r.next.Resolve(page, ref)
+	r.record(BrowserCall{Method: MethodResolve, ElementIndex: ref.Index, Error: recordBrowserError(err)})
+	return node, err
+}
+
+func (r *RecordingBrowserClient) DescribeField(page *rod.Page, node *browserfactory.TaggedAccessibilityNode) (*browserfactory.FormField, error) {
+	field, err := r.next.DescribeField(page, node)
+	r.record(BrowserCall{Method: MethodDescribeField, ElementIndex: node.Index, Field: field, Error: recordBrowserError(err)})
+	return field, err
+}
+
+func (r *RecordingBrowserClient) ValidationErrors(page *rod.Page) ([]browserfactory.ValidationError, error) {
+	validationErrors, err := r.next.ValidationErrors(page)
+	r.record(BrowserCall{Method: MethodValidationErrors, ValidationErrors: validationErrors, Error: recordBrowserError(err)})
+	return validationErrors, err
+}
+
+func (r *RecordingBrowserClient) Click(page *rod.Page, node *browserfactory.TaggedAccessibilityNode) error {
+	err := r.next.Click(page, node)
+	r.record(BrowserCall{Method: MethodClick, ElementIndex: node.Index, Error: recordBrowserError(err)})
+	return err
+}
+
+func (r *RecordingBrowserClient) Input(page *rod.Page, node *browserfactory.TaggedAccessibilityNode, text string) error {
+	err := r.next.Input(page, node, text)
+	r.record(BrowserCall{Method: MethodInput, ElementIndex: node.Index, Text: text, Error: recordBrowserError(err)})
+	return err
+}
+
+func (r *RecordingBrowserClient) PressKey(page *rod.Page, node *browserfactory.TaggedAccessibilityNode, chord string) error {
+	err := r.next.PressKey(page, node, chord)
+	call := BrowserCall{Method: MethodPressKey, Text: chord, Error: recordBrowserError(err)}
+	if node != nil {
+		call.ElementIndex = node.Index
+	}
+	r.record(call)
+	return err
+}
+
+func (r *RecordingBrowserClient) Scroll(page *rod.Page, ratio float64, multiplier float64) error {
+	err := r.next.Scroll(page, ratio, multiplier)
+	r.record(BrowserCall{Method: MethodScroll, Ratio: ratio, Multiplier: multiplier, Error: recordBrowserError(err)})
+	return err
+}
+
+func (r *RecordingBrowserClient) Navigate(page *rod.Page, url string) error {
+	err := r.next.Navigate(page, url)
+	r.record(BrowserCall{Method: MethodNavigate, Url: url, Error: recordBrowserError(err)})
+	return err
+}
+
+func (r *RecordingBrowserClient) ClosePage(page *rod.Page) error {
+	err := r.next.ClosePage(page)
+	r.record(BrowserCall{Method: MethodClosePage, Error: recordBrowserError(err)})
+	return err
+}
+
+func (r *RecordingBrowserClient) nextSeq() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	return r.seq
+}
+
+func (r *RecordingBrowserClient) record(call BrowserCall) {
+	if err := r.bundle.appendBrowserCall(call); err != nil {
+		log.Println("failed to record browser call:", err)
+	}
+}
+
+// ReplayBrowserClient serves a bundle's browser calls back in recorded order. It
+// never touches a real browser: pages are nil and tagged nodes carry no DOM
+// handles, so it only works behind activities that go through BrowserClient.
+type ReplayBrowserClient struct {
+	bundle *Bundle
+	mu     sync.Mutex
+	cursor int
+}
+
+func NewReplayBrowserClient(bundle *Bundle) *ReplayBrowserClient {
+	return &ReplayBrowserClient{bundle: bundle}
+}
+
+func (r *ReplayBrowserClient) GetBrowser() *rod.Browser {
+	return nil
+}
+
+func (r *ReplayBrowserClient) OpenPageNewTab(browser *rod.Browser, url string) *rod.Page {
+	if _, err := r.next(MethodOpenPageNewTab); err != nil {
+		log.Println(err)
+	}
+	return nil
+}
+
+func (r *ReplayBrowserClient) ScreenshotForLLM(page *rod.Page, options browserfactory.CaptureOptions) (browserfactory.Capture, error) {
+	call, err := r.next(MethodScreenshotForLLM)
+	if err != nil {
+		return browserfactory.Capture{}, err
+	}
+	if call.Error != nil {
+		return browserfactory.Capture{}, call.Error.err()
+	}
+
+	capture := browserfactory.Capture{}
+	capture.Annotated, err = os.ReadFile(r.bundle.Path(call.ScreenshotFile))
+	if err != nil {
+		return browserfactory.Capture{}, fmt.Errorf("failed to read recorded screenshot: %w", err)
+	}
+	if options.Clean && call.CleanScreenshotFile != "" {
+		capture.Clean, err = os.ReadFile(r.bundle.Path(call.CleanScreenshotFile))
+		if err != nil {
+			return browserfactory.Capture{}, fmt.Errorf("failed to read recorded clean screenshot: %w", err)
+		}
+	}
+
+	if options.Text {
+		capture.Text = call.PageText
+	}
+
+	capture.TaggedNodes = make([]*browserfactory.TaggedAccessibilityNode, len(call.TaggedNodes))
+	for i, node := range call.TaggedNodes {
+		capture.TaggedNodes[i] = &browserfactory.TaggedAccessibilityNode{
+			Node:        replayAXNode(node),
+			Index:       node.Index,
+			Description: node.Description,
+			Bounds: &proto.DOMRect{
+				X:      node.X,
+				Y:      node.Y,
+				Width:  node.Width,
+				Height: node.Height,
+			},
+		}
+	}
+
+	return capture, nil
+}
+
+// replayAXNode restores the role and name the recording kept, so replayed nodes
+// serialize the same way recorded ones did.
+func replayAXNode(node browserfactory.SerializableTaggedNode) *proto.AccessibilityAXNode {
+	axNode := &proto.AccessibilityAXNode{}
+	if node.Role != "" {
+		axNode.Role = &proto.AccessibilityAXValue{Type: proto.AccessibilityAXValueTypeRole, Value: gson.New(node.Role)}
+	}
+	if node.Name != "" {
+		axNode.Name = &proto.AccessibilityAXValue{Type: proto.AccessibilityAXValueTypeComputedString, Value: gson.New(node.Name)}
+	}
+	return axNode
+}
+
+// Resolve hands back a node built from the reference alone, since there is no DOM
+// to look it up in. A run that resolves a different element than the recording
+// did has diverged, even if the calls still line up.
+func (r *ReplayBrowserClient) Resolve(page *rod.Page, ref browserfactory.NodeRef) (*browserfactory.TaggedAccessibilityNode, error) {
+	call, err := r.nextElement(MethodResolve, ref.Index)
+	if err != nil {
+		return nil, err
+	}
+	if call.Error != nil {
+		return nil, call.Error.err()
+	}
+	bounds := ref.Fingerprint.Bounds
+	return &browserfactory.TaggedAccessibilityNode{
+		Node: replayAXNode(browserfactory.SerializableTaggedNode{
+			Role: ref.Fingerprint.Role,
+			Name: ref.Fingerprint.Name,
+		}),
+		Index:  ref.Index,
+		Bounds: &bounds,
+		Scroll: ref.Fingerprint.Scroll,
+	}, nil
+}
+
+func (r *ReplayBrowserClient) DescribeField(page *rod.Page, node *browserfactory.TaggedAccessibilityNode) (*browserfactory.FormField, error) {
+	call, err := r.next(MethodDescribeField)
+	if err != nil {
+		return nil, err
+	}
+	if call.Error != nil {
+		return nil, call.Error.err()
+	}
+	return call.Field, nil
+}
+
+func (r *ReplayBrowserClient) ValidationErrors(page *rod.Page) ([]browserfactory.ValidationError, error) {
+	call, err := r.next(MethodValidationErrors)
+	if err != nil {
+		return nil, err
+	}
+	if call.Error != nil {
+		return nil, call.Error.err()
+	}
+	return call.ValidationErrors, nil
+}
+
+func (r *ReplayBrowserClient) Click(page *rod.Page, node *browserfactory.TaggedAccessibilityNode) error {
+	return r.replayError(MethodClick)
+}
+
+func (r *ReplayBrowserClient) Input(page *rod.Page, node *browserfactory.TaggedAccessibilityNode, text string) error {
+	return r.replayError(MethodInput)
+}
+
+func (r *ReplayBrowserClient) PressKey(page *rod.Page, node *browserfactory.TaggedAccessibilityNode, chord string) error {
+	return r.replayError(MethodPressKey)
+}
+
+func (r *ReplayBrowserClient) Scroll(page *rod.Page, ratio float64, multiplier float64) error {
+	return r.replayError(MethodScroll)
+}
+
+func (r *ReplayBrowserClient) Navigate(page *rod.Page, url string) error {
+	return r.replayError(MethodNavigate)
+}
+
+func (r *ReplayBrowserClient) ClosePage(page *rod.Page) error {
+	return r.replayError(MethodClosePage)
+}
+
+func (r *ReplayBrowserClient) replayError(method BrowserMethod) error {
+	call, err := r.next(method)
+	if err != nil {
+		return err
+	}
+	if call.Error != nil {
+		return call.Error.err()
+	}
+	return nil
+}
+
+// next returns the next recorded call, failing loudly if the run has diverged
+// from the recording.
+func (r *ReplayBrowserClient) next(method BrowserMethod) (BrowserCall, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.nextLocked(method)
+}
+
+// nextElement is next for a call on a tagged element, which must also be the
+// element the recording used.
+func (r *ReplayBrowserClient) nextElement(method BrowserMethod, index int) (BrowserCall, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	call, err := r.nextLocked(method)
+	if err != nil {
+		return BrowserCall{}, err
+	}
+	if call.ElementIndex != index {
+		return BrowserCall{}, fmt.Errorf("replay diverged at browser call %d: recorded %s of element %d, got element %d",
+			r.cursor-1, method, call.ElementIndex, index)
+	}
+	return call, nil
+}
+
+func (r *ReplayBrowserClient) nextLocked(method BrowserMethod) (BrowserCall, error) {
+	calls := r.bundle.manifest.BrowserCalls
+	if r.cursor >= len(calls) {
+		return BrowserCall{}, fmt.Errorf("replay exhausted: no recorded browser call left for %s", method)
+	}
+
+	call := calls[r.cursor]
+	if call.Method != method {
+		return BrowserCall{}, fmt.Errorf("replay diverged at browser call %d: recorded %s, got %s", r.cursor, call.Method, method)
+	}
+	r.cursor++
+	return call, nil
+}
@@ -0,0 +1,279 @@
+// Package replay records a run's browser and LLM interactions into a portable
+// bundle and serves them back, so a failed run can be reproduced without the
+// real site or model.
+//
+// A bundle is a directory holding two call logs, browser_calls.jsonl and
+// llm_calls.jsonl, plus the screenshots, DOM snapshots and prompt images they
+// reference by relative path. Calls are kept in two ordered streams, one per
+// interface, so a worker should record a single workflow at a time. Bundles
+// recorded before the logs existed hold a single manifest.json instead, which
+// OpenBundle still reads.
+package replay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/SomtoJF/iris-worker/aipi/types"
+	"github.com/SomtoJF/iris-worker/browserfactory"
+)
+
+const (
+	manifestFileName     = "manifest.json"
+	browserCallsFileName = "browser_calls.jsonl"
+	llmCallsFileName     = "llm_calls.jsonl"
+)
+
+type BrowserMethod string
+
+const (
+	MethodOpenPageNewTab   BrowserMethod = "OpenPageNewTab"
+	MethodScreenshotForLLM BrowserMethod = "ScreenshotForLLM"
+	MethodResolve          BrowserMethod = "Resolve"
+	MethodDescribeField    BrowserMethod = "DescribeField"
+	MethodValidationErrors BrowserMethod = "ValidationErrors"
+	MethodClick            BrowserMethod = "Click"
+	MethodInput            BrowserMethod = "Input"
+	MethodPressKey         BrowserMethod = "PressKey"
+	MethodScroll           BrowserMethod = "Scroll"
+	MethodNavigate         BrowserMethod = "Navigate"
+	MethodClosePage        BrowserMethod = "ClosePage"
+)
+
+type BrowserCall struct {
+	Method BrowserMethod `json:"method"`
+	Url    string        `json:"url,omitempty"`
+	// ScreenshotFile, CleanScreenshotFile and DOMSnapshotFile are relative to the
+	// bundle directory.
+	ScreenshotFile      string                                  `json:"screenshot_file,omitempty"`
+	CleanScreenshotFile string                                  `json:"clean_screenshot_file,omitempty"`
+	DOMSnapshotFile     string                                  `json:"dom_snapshot_file,omitempty"`
+	TaggedNodes         []browserfactory.SerializableTaggedNode `json:"tagged_nodes,omitempty"`
+	PageText            string                                  `json:"page_text,omitempty"`
+	ElementIndex        int                                     `json:"element_index,omitempty"`
+	Field               *browserfactory.FormField               `json:"field,omitempty"`
+	ValidationErrors    []browserfactory.ValidationError        `json:"validation_errors,omitempty"`
+	Text                string                                  `json:"text,omitempty"`
+	Ratio               float64                                 `json:"ratio,omitempty"`
+	Multiplier          float64                                 `json:"multiplier,omitempty"`
+	Error               *RecordedError                          `json:"error,omitempty"`
+}
+
+type LLMCall struct {
+	Request  types.AIPIRequest  `json:"request"`
+	Response types.AIPIResponse `json:"response"`
+	Error    *RecordedError     `json:"error,omitempty"`
+}
+
+type Manifest struct {
+	BrowserCalls []BrowserCall `json:"browser_calls"`
+	LLMCalls     []LLMCall     `json:"llm_calls"`
+}
+
+// Bundle is safe for concurrent use. While recording, every call is appended to
+// its log as soon as it returns, so a crashed run still leaves a usable bundle
+// and each call costs one write however long the run gets.
+type Bundle struct {
+	dir      string
+	mu       sync.Mutex
+	manifest Manifest
+}
+
+// NewBundle creates an empty bundle for recording into dir.
+func NewBundle(dir string) (*Bundle, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create bundle dir: %w", err)
+	}
+	return &Bundle{dir: dir}, nil
+}
+
+// OpenBundle loads a previously recorded bundle for replay.
+func OpenBundle(dir string) (*Bundle, error) {
+	bundle := &Bundle{dir: dir}
+
+	data, err := os.ReadFile(filepath.Join(dir, manifestFileName))
+	if err == nil {
+		if err := json.Unmarshal(data, &bundle.manifest); err != nil {
+			return nil, fmt.Errorf("failed to parse bundle manifest: %w", err)
+		}
+		return bundle, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read bundle manifest: %w", err)
+	}
+
+	if bundle.manifest.BrowserCalls, err = readLog[BrowserCall](filepath.Join(dir, browserCallsFileName)); err != nil {
+		return nil, err
+	}
+	if bundle.manifest.LLMCalls, err = readLog[LLMCall](filepath.Join(dir, llmCallsFileName)); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// readLog reads one call per line. A run that crashed mid-write leaves its last
+// line without a newline; that call never finished recording and is dropped. A
+// missing log means no calls of that kind were made.
+func readLog[T any](path string) ([]T, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle log: %w", err)
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	// The last element is empty when the log ends in a newline, and the cut
+	// short call otherwise.
+	lines = lines[:len(lines)-1]
+
+	calls := make([]T, 0, len(lines))
+	for i, line := range lines {
+		var call T
+		if err := json.Unmarshal(line, &call); err != nil {
+			return nil, fmt.Errorf("failed to parse line %d of %s: %w", i+1, filepath.Base(path), err)
+		}
+		calls = append(calls, call)
+	}
+	return calls, nil
+}
+
+func (b *Bundle) Dir() string {
+	return b.dir
+}
+
+// Path resolves a path stored in the manifest against the bundle directory.
+func (b *Bundle) Path(relative string) string {
+	return filepath.Join(b.dir, relative)
+}
+
+func (b *Bundle) appendBrowserCall(call BrowserCall) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.appendLog(browserCallsFileName, call)
+}
+
+// appendLLMCall records call with the request's inline images moved into files.
+// A planner resends the same screenshots with every turn of its conversation,
+// so they are stored once by content and referenced from each request.
+func (b *Bundle) appendLLMCall(call LLMCall) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	request, err := b.externalizeImages(call.Request)
+	if err != nil {
+		return err
+	}
+	call.Request = request
+	return b.appendLog(llmCallsFileName, call)
+}
+
+func (b *Bundle) appendLog(name string, call any) error {
+	line, err := json.Marshal(call)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(b.Path(name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// externalizeImages returns req with every base64 data url swapped for the
+// bundle path of a file holding the image. req itself is left untouched.
+func (b *Bundle) externalizeImages(req types.AIPIRequest) (types.AIPIRequest, error) {
+	if req.ImageUrl != nil {
+		path, err := b.storeImage(*req.ImageUrl)
+		if err != nil {
+			return req, err
+		}
+		req.ImageUrl = &path
+	}
+
+	messages := make([]types.Message, len(req.Messages))
+	for i, message := range req.Messages {
+		message.Parts = append([]types.ContentPart(nil), message.Parts...)
+		for j, part := range message.Parts {
+			if part.Type != types.ContentPartTypeImage {
+				continue
+			}
+			path, err := b.storeImage(part.ImageUrl)
+			if err != nil {
+				return req, err
+			}
+			message.Parts[j].ImageUrl = path
+		}
+		messages[i] = message
+	}
+	if req.Messages != nil {
+		req.Messages = messages
+	}
+	return req, nil
+}
+
+// storeImage writes a data url's image to images/<sha256>.<ext> unless it is
+// already there and returns that path. Anything else, such as an http url, is
+// returned as is.
+func (b *Bundle) storeImage(url string) (string, error) {
+	mediaType, encoded, ok := types.SplitDataURL(url)
+	if !ok {
+		return url, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return url, nil
+	}
+
+	sum := sha256.Sum256(data)
+	relative := "images/" + hex.EncodeToString(sum[:]) + "." + strings.TrimPrefix(mediaType, "image/")
+	if _, err := os.Stat(b.Path(relative)); err == nil {
+		return relative, nil
+	}
+	return b.writeFile(relative, data)
+}
+
+// writeFile stores an artifact in the bundle and returns its relative path. It
+// writes to a temporary file first, so a crash never leaves a truncated file
+// under the final name.
+func (b *Bundle) writeFile(relative string, data []byte) (string, error) {
+	path := b.Path(relative)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return "", err
+	}
+	if err := temp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(temp.Name(), 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return "", err
+	}
+	return relative, nil
+}
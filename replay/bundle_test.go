@@ -0,0 +1,94 @@
+package replay
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SomtoJF/iris-worker/aipi/types"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	bundle, err := NewBundle(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image := "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("screenshot"))
+	request := types.AIPIRequest{
+		Model:    "model",
+		ImageUrl: &image,
+		Messages: []types.Message{{Role: types.MessageRoleUser, Parts: []types.ContentPart{types.TextPart("look"), types.ImagePart(image)}}},
+	}
+	for i := 0; i < 3; i++ {
+		if err := bundle.appendLLMCall(LLMCall{Request: request, Response: types.AIPIResponse{Content: "ok"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bundle.appendBrowserCall(BrowserCall{Method: MethodClick, ElementIndex: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	if request.Messages[0].Parts[1].ImageUrl != image || *request.ImageUrl != image {
+		t.Error("recording changed the caller's request")
+	}
+	// The same screenshot sent three times, twice per request, is stored once.
+	images, _ := filepath.Glob(filepath.Join(dir, "images", "*"))
+	if len(images) != 1 || filepath.Ext(images[0]) != ".png" {
+		t.Errorf("images = %v, want one png", images)
+	}
+	logged, _ := os.ReadFile(filepath.Join(dir, llmCallsFileName))
+	if strings.Contains(string(logged), "base64") {
+		t.Error("the llm log still holds inline images")
+	}
+
+	opened, err := OpenBundle(dir)
+	if err != nil {
+		t.Fatalf("OpenBundle: %v", err)
+	}
+	if len(opened.manifest.LLMCalls) != 3 || len(opened.manifest.BrowserCalls) != 1 {
+		t.Fatalf("opened %d llm and %d browser calls, want 3 and 1", len(opened.manifest.LLMCalls), len(opened.manifest.BrowserCalls))
+	}
+	stored := opened.manifest.LLMCalls[0].Request.Messages[0].Parts[1].ImageUrl
+	if data, err := os.ReadFile(opened.Path(stored)); err != nil || string(data) != "screenshot" {
+		t.Errorf("image at %q = %q, %v", stored, data, err)
+	}
+	if call := opened.manifest.BrowserCalls[0]; call.Method != MethodClick || call.ElementIndex != 4 {
+		t.Errorf("browser call = %+v", call)
+	}
+}
+
+func TestOpenBundleDropsUnfinishedCall(t *testing.T) {
+	dir := t.TempDir()
+	log := `{"method":"OpenPageNewTab","url":"https://example.com"}` + "\n" + `{"method":"Cli`
+	if err := os.WriteFile(filepath.Join(dir, browserCallsFileName), []byte(log), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, err := OpenBundle(dir)
+	if err != nil {
+		t.Fatalf("OpenBundle: %v", err)
+	}
+	if calls := bundle.manifest.BrowserCalls; len(calls) != 1 || calls[0].Method != MethodOpenPageNewTab {
+		t.Errorf("calls = %+v, want only the finished one", calls)
+	}
+}
+
+func TestOpenBundleReadsManifest(t *testing.T) {
+	dir := t.TempDir()
+	manifest := `{"browser_calls":[{"method":"Scroll","ratio":0.5}],"llm_calls":[]}`
+	if err := os.WriteFile(filepath.Join(dir, manifestFileName), []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, err := OpenBundle(dir)
+	if err != nil {
+		t.Fatalf("OpenBundle: %v", err)
+	}
+	if calls := bundle.manifest.BrowserCalls; len(calls) != 1 || calls[0].Ratio != 0.5 {
+		t.Errorf("calls = %+v", calls)
+	}
+}
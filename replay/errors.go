@@ -0,0 +1,98 @@
+package replay
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/SomtoJF/iris-worker/activity/apperr"
+	"github.com/SomtoJF/iris-worker/aipi/types"
+	"github.com/SomtoJF/iris-worker/browserfactory"
+	"go.temporal.io/sdk/temporal"
+)
+
+// RecordedError is a failed call as the bundle keeps it. Besides the message it
+// holds what activities classify errors by, so a replayed failure gets the same
+// apperr type and retry behaviour as the recorded one.
+type RecordedError struct {
+	Message string `json:"message"`
+	// Type and Retryable are the apperr classification the activity gave the error.
+	Type      string `json:"type"`
+	Retryable bool   `json:"retryable"`
+	// StatusCode and RetryAfter are kept for LLM provider errors.
+	StatusCode int           `json:"status_code,omitempty"`
+	RetryAfter time.Duration `json:"retry_after,omitempty"`
+}
+
+// recordBrowserError classifies err the way the browser activities do: stale
+// elements need a new screenshot, anything else is worth retrying.
+func recordBrowserError(err error) *RecordedError {
+	if err == nil {
+		return nil
+	}
+	recorded := &RecordedError{Message: err.Error(), Type: apperr.TypeBrowser, Retryable: true}
+	switch {
+	case errors.Is(err, browserfactory.ErrStaleElement):
+		recorded.Type, recorded.Retryable = apperr.TypeStaleElement, false
+	case isNetworkError(err):
+		recorded.Type = apperr.TypeNetwork
+	}
+	return recorded
+}
+
+// recordLLMError classifies err with apperr.FromProvider. Provider errors keep
+// only the upstream message, since the status is kept on its own.
+func recordLLMError(err error) *RecordedError {
+	if err == nil {
+		return nil
+	}
+	recorded := &RecordedError{Message: err.Error(), Retryable: true}
+	var appErr *temporal.ApplicationError
+	if errors.As(apperr.FromProvider(err), &appErr) {
+		recorded.Type, recorded.Retryable = appErr.Type(), !appErr.NonRetryable()
+	}
+	var providerErr *types.ProviderError
+	if errors.As(err, &providerErr) {
+		recorded.StatusCode, recorded.RetryAfter = providerErr.StatusCode, providerErr.RetryAfter
+		if providerErr.Err != nil {
+			recorded.Message = providerErr.Err.Error()
+		}
+	}
+	return recorded
+}
+
+// err rebuilds an error the activities classify the same way they classified
+// the recorded one.
+func (e *RecordedError) err() error {
+	if e == nil {
+		return nil
+	}
+	if e.StatusCode != 0 {
+		return &types.ProviderError{StatusCode: e.StatusCode, RetryAfter: e.RetryAfter, Err: errors.New(e.Message)}
+	}
+	if e.Type == apperr.TypeNetwork {
+		return networkError{e}
+	}
+	return e
+}
+
+func (e *RecordedError) Error() string {
+	return e.Message
+}
+
+func (e *RecordedError) Is(target error) bool {
+	return target == browserfactory.ErrStaleElement && e.Type == apperr.TypeStaleElement
+}
+
+// networkError satisfies net.Error so apperr reports it as a network error again.
+type networkError struct {
+	*RecordedError
+}
+
+func (networkError) Timeout() bool   { return false }
+func (networkError) Temporary() bool { return true }
+
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,133 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SomtoJF/iris-worker/activity/apperr"
+	"github.com/SomtoJF/iris-worker/aipi/types"
+	"github.com/SomtoJF/iris-worker/browserfactory"
+	"go.temporal.io/sdk/temporal"
+)
+
+var networkDown = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+// classify returns what the retry policy sees of err.
+func classify(t *testing.T, err error) (string, bool, time.Duration) {
+	t.Helper()
+	var appErr *temporal.ApplicationError
+	if !errors.As(err, &appErr) {
+		t.Fatalf("%v is not an application error", err)
+	}
+	return appErr.Type(), appErr.NonRetryable(), appErr.NextRetryDelay()
+}
+
+func TestReplayedLLMErrorsKeepTheirClass(t *testing.T) {
+	failures := []error{
+		&types.ProviderError{StatusCode: http.StatusTooManyRequests, RetryAfter: 7 * time.Second, Err: errors.New("slow down")},
+		&types.ProviderError{StatusCode: http.StatusBadRequest, Err: errors.New("bad tool schema")},
+		&types.ProviderError{StatusCode: http.StatusUnauthorized, Err: errors.New("bad key")},
+		fmt.Errorf("failed to reach openrouter: %w", networkDown),
+		errors.New("stream ended early"),
+	}
+
+	dir := t.TempDir()
+	recording, err := NewBundle(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, failure := range failures {
+		if err := recording.appendLLMCall(LLMCall{Request: types.AIPIRequest{Model: "m"}, Error: recordLLMError(failure)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bundle, err := OpenBundle(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replay := NewReplayAIPI(bundle)
+	for _, failure := range failures {
+		_, replayed := replay.GetCompletion(context.Background(), types.AIPIRequest{Model: "m"})
+		if replayed == nil || replayed.Error() != failure.Error() {
+			t.Errorf("replayed %v, want %v", replayed, failure)
+			continue
+		}
+		wantType, wantNonRetryable, wantDelay := classify(t, apperr.FromProvider(failure))
+		gotType, gotNonRetryable, gotDelay := classify(t, apperr.FromProvider(replayed))
+		if gotType != wantType || gotNonRetryable != wantNonRetryable || gotDelay != wantDelay {
+			t.Errorf("%v replayed as %s (non-retryable %v, delay %v), want %s (%v, %v)",
+				failure, gotType, gotNonRetryable, gotDelay, wantType, wantNonRetryable, wantDelay)
+		}
+	}
+}
+
+func TestReplayedBrowserErrorsKeepTheirClass(t *testing.T) {
+	tests := []struct {
+		err           error
+		wantType      string
+		wantRetryable bool
+	}{
+		{fmt.Errorf("%w: element 3 is no longer on the page", browserfactory.ErrStaleElement), apperr.TypeStaleElement, false},
+		{fmt.Errorf("cdp call failed: %w", networkDown), apperr.TypeNetwork, true},
+		{errors.New("element is covered by another element"), apperr.TypeBrowser, true},
+	}
+
+	dir := t.TempDir()
+	recording, err := NewBundle(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if err := recording.appendBrowserCall(BrowserCall{Method: MethodClick, Error: recordBrowserError(tt.err)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bundle, err := OpenBundle(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replay := NewReplayBrowserClient(bundle)
+	for _, tt := range tests {
+		replayed := replay.Click(nil, &browserfactory.TaggedAccessibilityNode{})
+		if replayed == nil || replayed.Error() != tt.err.Error() {
+			t.Errorf("replayed %v, want %v", replayed, tt.err)
+			continue
+		}
+		if errors.Is(replayed, browserfactory.ErrStaleElement) != errors.Is(tt.err, browserfactory.ErrStaleElement) {
+			t.Errorf("%v: stale element lost on replay", tt.err)
+		}
+		// Recording the replayed error again must not change its class.
+		if recorded := recordBrowserError(replayed); recorded.Type != tt.wantType || recorded.Retryable != tt.wantRetryable {
+			t.Errorf("%v replayed as %s (retryable %v), want %s (%v)", tt.err, recorded.Type, recorded.Retryable, tt.wantType, tt.wantRetryable)
+		}
+	}
+}
+
+func TestReplayResolveChecksElement(t *testing.T) {
+	dir := t.TempDir()
+	recording, err := NewBundle(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := recording.appendBrowserCall(BrowserCall{Method: MethodResolve, ElementIndex: 2}); err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := OpenBundle(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewReplayBrowserClient(bundle).Resolve(nil, browserfactory.NodeRef{Index: 3}); err == nil {
+		t.Error("resolving element 3 replayed a recording of element 2")
+	}
+	if node, err := NewReplayBrowserClient(bundle).Resolve(nil, browserfactory.NodeRef{Index: 2}); err != nil || node.Index != 2 {
+		t.Errorf("Resolve = %+v, %v, want the recorded element", node, err)
+	}
+}
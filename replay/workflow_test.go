@@ -0,0 +1,185 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"reflect"
+	"testing"
+
+	"github.com/SomtoJF/iris-worker/activity/browser"
+	"github.com/SomtoJF/iris-worker/activity/llm"
+	"github.com/SomtoJF/iris-worker/activity/sqldb"
+	"github.com/SomtoJF/iris-worker/aipi/types"
+	"github.com/SomtoJF/iris-worker/artifact"
+	"github.com/SomtoJF/iris-worker/browserfactory"
+	"github.com/SomtoJF/iris-worker/workflow/jobapplication"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+)
+
+const recordedModel = "google/gemini-2.5-flash"
+
+// recordedRun is a bundle's worth of calls, written in the order a run made them.
+type recordedRun struct {
+	browserCalls []BrowserCall
+	completions  []types.AIPIResponse
+}
+
+// observe is the capture of a page with a single email field.
+func observe(t *testing.T, bundle *Bundle) BrowserCall {
+	t.Helper()
+	var screenshot bytes.Buffer
+	if err := png.Encode(&screenshot, image.NewRGBA(image.Rect(0, 0, 64, 48))); err != nil {
+		t.Fatal(err)
+	}
+	screenshotFile, err := bundle.writeFile("screenshots/0001.png", screenshot.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := browserfactory.SerializableTaggedNode{Index: 0, Description: "Tag 0: Email textbox", Role: "textbox", Name: "Email", X: 10, Y: 10, Width: 40, Height: 10}
+	return BrowserCall{Method: MethodScreenshotForLLM, ScreenshotFile: screenshotFile, TaggedNodes: []browserfactory.SerializableTaggedNode{email}}
+}
+
+func toolCall(name, arguments string) types.AIPIResponse {
+	return types.AIPIResponse{
+		ToolCalls: []types.ToolCall{{ID: "call_" + name, Name: name, Arguments: arguments}},
+		Model:     recordedModel,
+		TotalCost: 0.001,
+	}
+}
+
+// replayRun records run into a bundle, replays the job application workflow
+// against it in the test environment and returns the environment with the
+// agent steps and job application updates the workflow wrote.
+func replayRun(t *testing.T, record func(bundle *Bundle) recordedRun) (*testsuite.TestWorkflowEnvironment, []sqldb.RecordAgentStepInput, []map[string]interface{}) {
+	t.Helper()
+	dir := t.TempDir()
+	recording, err := NewBundle(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := record(recording)
+	for _, call := range run.browserCalls {
+		if err := recording.appendBrowserCall(call); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, completion := range run.completions {
+		if err := recording.appendLLMCall(LLMCall{Request: types.AIPIRequest{Model: recordedModel}, Response: completion}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bundle, err := OpenBundle(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifacts, err := artifact.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{EnableSessionWorker: true})
+	env.RegisterWorkflow(jobapplication.JobApplicationWorkflow)
+	env.RegisterActivity(browser.NewActivities(NewReplayBrowserClient(bundle), artifacts))
+	env.RegisterActivity(llm.NewActivity(NewReplayAIPI(bundle), nil, artifacts))
+
+	// The database is the one thing replay doesn't cover.
+	var steps []sqldb.RecordAgentStepInput
+	var updates []map[string]interface{}
+	env.RegisterActivityWithOptions(func(ctx context.Context, input sqldb.RecordAgentStepInput) error {
+		steps = append(steps, input)
+		return nil
+	}, activity.RegisterOptions{Name: "RecordAgentStep"})
+	env.RegisterActivityWithOptions(func(ctx context.Context, input sqldb.UpdateJobApplicationInput) error {
+		updates = append(updates, input.Data)
+		return nil
+	}, activity.RegisterOptions{Name: "UpdateJobApplication"})
+
+	env.ExecuteWorkflow(jobapplication.JobApplicationWorkflow, jobapplication.JobApplicationWorkflowInput{
+		IdJobApplication: 7,
+		Url:              "https://jobs.example.com/apply",
+	})
+	if !env.IsWorkflowCompleted() {
+		t.Fatal("workflow did not complete")
+	}
+	return env, steps, updates
+}
+
+func TestReplayJobApplicationWorkflow(t *testing.T) {
+	env, steps, updates := replayRun(t, func(bundle *Bundle) recordedRun {
+		page := observe(t, bundle)
+		return recordedRun{
+			browserCalls: []BrowserCall{
+				{Method: MethodOpenPageNewTab, Url: "https://jobs.example.com/apply"},
+				page,
+				{Method: MethodValidationErrors},
+				{Method: MethodResolve},
+				{Method: MethodInput, Text: "jane@example.com"},
+				{Method: MethodValidationErrors},
+				page,
+				{Method: MethodValidationErrors},
+				{Method: MethodClosePage},
+			},
+			completions: []types.AIPIResponse{
+				toolCall("type", `{"element_index":0,"text":"jane@example.com"}`),
+				toolCall("complete_application", `{}`),
+			},
+		}
+	})
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("workflow failed: %v", err)
+	}
+	var result jobapplication.JobApplicationWorkflowResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Iterations != 2 || result.Usage.Calls != 2 {
+		t.Errorf("result = %+v, want 2 iterations and 2 llm calls", result)
+	}
+	if len(steps) != 2 || steps[0].ToolName != "type" || steps[0].ToolError != "" {
+		t.Errorf("steps = %+v, want a successful type step first", steps)
+	} else if arguments, _ := json.Marshal(steps[0].ToolArguments); string(arguments) != `{"element_index":0,"text":"jane@example.com"}` {
+		t.Errorf("tool arguments = %s, want them as the planner sent them", arguments)
+	}
+	// Spend is saved after each iteration, then again with the final status.
+	want := []map[string]interface{}{
+		{"llm_cost": 0.001},
+		{"llm_cost": 0.002},
+		{"llm_cost": 0.002, "status": string(sqldb.JobApplicationStatusApplied)},
+	}
+	if !reflect.DeepEqual(updates, want) {
+		t.Errorf("updates = %v, want %v", updates, want)
+	}
+}
+
+func TestReplayRecordsFailedPlannerStep(t *testing.T) {
+	env, steps, updates := replayRun(t, func(bundle *Bundle) recordedRun {
+		return recordedRun{
+			browserCalls: []BrowserCall{
+				{Method: MethodOpenPageNewTab, Url: "https://jobs.example.com/apply"},
+				observe(t, bundle),
+				{Method: MethodValidationErrors},
+				{Method: MethodClosePage},
+			},
+			completions: []types.AIPIResponse{{Content: "I would click the email field.", Model: recordedModel}},
+		}
+	})
+
+	if env.GetWorkflowError() == nil {
+		t.Fatal("workflow succeeded with an unparseable plan")
+	}
+	if len(steps) != 1 || steps[0].PlannerError == "" || steps[0].RawResponse != "I would click the email field." {
+		t.Errorf("steps = %+v, want the failed step with the planner's answer and error", steps)
+	}
+	if len(updates) != 1 || updates[0]["status"] != string(sqldb.JobApplicationStatusFailed) {
+		t.Errorf("updates = %v, want failed", updates)
+	}
+}
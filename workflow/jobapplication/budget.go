@@ -0,0 +1,73 @@
+package jobapplication
+
+import (
+	"github.com/SomtoJF/iris-worker/aipi/types"
+)
+
+const (
+	defaultHardBudgetUSD = 1.00
+	// defaultSoftBudgetRatio places an unset soft limit at this share of the hard one.
+	defaultSoftBudgetRatio   = 0.5
+	defaultCheapPlannerModel = "google/gemini-2.5-flash-lite"
+
+	BudgetExceededErrorType = "budget_exceeded"
+)
+
+// BudgetConfig caps how much a single application may spend on LLM calls. Once
+// spend crosses SoftLimitUSD the planner switches to CheapPlannerModel, and once
+// it crosses HardLimitUSD the agent stops.
+type BudgetConfig struct {
+	HardLimitUSD float64 `json:"hard_limit_usd,omitempty"`
+	// SoftLimitUSD is a pointer so that zero, which puts the planner on the cheap
+	// model from the first call, can be told apart from unset.
+	SoftLimitUSD      *float64 `json:"soft_limit_usd,omitempty"`
+	CheapPlannerModel string   `json:"cheap_planner_model,omitempty"`
+}
+
+// withDefaults fills in unset limits and keeps the soft limit between zero and
+// the hard limit, since one above it could never be reached.
+func (b BudgetConfig) withDefaults() BudgetConfig {
+	if b.HardLimitUSD <= 0 {
+		b.HardLimitUSD = defaultHardBudgetUSD
+	}
+	soft := b.HardLimitUSD * defaultSoftBudgetRatio
+	if b.SoftLimitUSD != nil {
+		soft = min(max(*b.SoftLimitUSD, 0), b.HardLimitUSD)
+	}
+	b.SoftLimitUSD = &soft
+	if b.CheapPlannerModel == "" {
+		b.CheapPlannerModel = defaultCheapPlannerModel
+	}
+	return b
+}
+
+// plannerModel returns the model the planner should use given what has been spent so far.
+func (b BudgetConfig) plannerModel(usage LLMUsage, preferred string) string {
+	if b.SoftLimitUSD != nil && usage.TotalCost >= *b.SoftLimitUSD {
+		return b.CheapPlannerModel
+	}
+	return preferred
+}
+
+func (b BudgetConfig) isExceeded(usage LLMUsage) bool {
+	return usage.TotalCost >= b.HardLimitUSD
+}
+
+// LLMUsage is the running total of LLM spend for one workflow run.
+type LLMUsage struct {
+	Calls            int     `json:"calls"`
+	InputTokens      int     `json:"input_tokens"`
+	OutputTokens     int     `json:"output_tokens"`
+	CacheReadTokens  int     `json:"cache_read_tokens"`
+	CacheWriteTokens int     `json:"cache_write_tokens"`
+	TotalCost        float64 `json:"total_cost"`
+}
+
+func (u *LLMUsage) Add(resp types.AIPIResponse) {
+	u.Calls++
+	u.InputTokens += resp.InputTokens
+	u.OutputTokens += resp.OutputTokens
+	u.CacheReadTokens += resp.CacheReadTokens
+	u.CacheWriteTokens += resp.CacheWriteTokens
+	u.TotalCost += resp.TotalCost
+}
@@ -0,0 +1,44 @@
+package jobapplication
+
+import "testing"
+
+func TestBudgetWithDefaults(t *testing.T) {
+	zero, half, tooHigh, negative := 0.0, 0.5, 3.0, -1.0
+	tests := []struct {
+		name     string
+		config   BudgetConfig
+		wantHard float64
+		wantSoft float64
+	}{
+		{name: "unset", wantHard: 1, wantSoft: 0.5},
+		{name: "soft follows the hard limit", config: BudgetConfig{HardLimitUSD: 0.2}, wantHard: 0.2, wantSoft: 0.1},
+		{name: "zero soft limit", config: BudgetConfig{SoftLimitUSD: &zero}, wantHard: 1, wantSoft: 0},
+		{name: "explicit soft limit", config: BudgetConfig{HardLimitUSD: 2, SoftLimitUSD: &half}, wantHard: 2, wantSoft: 0.5},
+		{name: "soft above hard", config: BudgetConfig{HardLimitUSD: 2, SoftLimitUSD: &tooHigh}, wantHard: 2, wantSoft: 2},
+		{name: "negative soft limit", config: BudgetConfig{SoftLimitUSD: &negative}, wantHard: 1, wantSoft: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budget := tt.config.withDefaults()
+			if budget.HardLimitUSD != tt.wantHard || *budget.SoftLimitUSD != tt.wantSoft {
+				t.Errorf("limits = %v/%v, want %v/%v", budget.HardLimitUSD, *budget.SoftLimitUSD, tt.wantHard, tt.wantSoft)
+			}
+		})
+	}
+}
+
+func TestBudgetPlannerModel(t *testing.T) {
+	zero := 0.0
+	budget := BudgetConfig{SoftLimitUSD: &zero}.withDefaults()
+	if model := budget.plannerModel(LLMUsage{}, "preferred"); model != defaultCheapPlannerModel {
+		t.Errorf("a zero soft limit picked %q before any spend, want the cheap model", model)
+	}
+
+	budget = BudgetConfig{}.withDefaults()
+	if model := budget.plannerModel(LLMUsage{TotalCost: 0.1}, "preferred"); model != "preferred" {
+		t.Errorf("model = %q below the soft limit, want the preferred one", model)
+	}
+	if model := budget.plannerModel(LLMUsage{TotalCost: 0.6}, "preferred"); model != defaultCheapPlannerModel {
+		t.Errorf("model = %q past the soft limit, want the cheap one", model)
+	}
+}
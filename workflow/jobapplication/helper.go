@@ -3,6 +3,7 @@ package jobapplication
 import (
 	"fmt"
 
+	"github.com/SomtoJF/iris-worker/activity/browser"
 	"github.com/SomtoJF/iris-worker/browserfactory"
 	"go.temporal.io/sdk/workflow"
 )
@@ -24,25 +25,39 @@ type PlannerResponse struct {
 }
 
 type PlannerRequest struct {
-	JobPostingUrl   string                                  `json:"job_posting_url"`
-	ScreenshotPath  string                                  `json:"screenshot_path"`
-	TaggedNodes     []browserfactory.SerializableTaggedNode `json:"tagged_nodes"`
-	ToolCallHistory []ToolCallResult                        `json:"tool_call_history"`
+	JobPostingUrl         string                                  `json:"job_posting_url"`
+	ScreenshotURI         string                                  `json:"screenshot_uri,omitempty"`
+	PreviousScreenshotURI string                                  `json:"previous_screenshot_uri,omitempty"`
+	TaggedNodes           []browserfactory.SerializableTaggedNode `json:"tagged_nodes"`
+	ToolCallHistory       []ToolCallResult                        `json:"tool_call_history"`
+	Model                 string                                  `json:"model,omitempty"`
+	// PageText describes the page in text and, when set, stands in for the list
+	// of tagged elements. ScreenshotURI is empty if the planner reads text only.
+	PageText string `json:"page_text,omitempty"`
+	// ValidationErrors are the errors the page shows right now.
+	ValidationErrors []browser.FieldError `json:"validation_errors,omitempty"`
+	// The fields below size the prompt; see fitPlannerRequest.
+	ScreenshotWidth   int `json:"screenshot_width,omitempty"`
+	ScreenshotHeight  int `json:"screenshot_height,omitempty"`
+	ContextWindow     int `json:"context_window,omitempty"`
+	MaxImageDimension int `json:"max_image_dimension,omitempty"`
+	// HistorySummary condenses tool calls that were dropped from ToolCallHistory.
+	HistorySummary string `json:"history_summary,omitempty"`
 }
 
 var toolActivityNameMap = map[string]string{
-	"click":        "Click",
-	"type":         "Type",
-	"type_multiple": "TypeMultiple",
-	"scroll":       "Scroll",
-	"navigate":     "Navigate",
+	"click":               "Click",
+	"type":                "Type",
+	"type_multiple":       "TypeMultiple",
+	"press_key":           "PressKey",
+	"scroll":              "Scroll",
+	"navigate":            "Navigate",
+	"extract_form_fields": "ExtractFormFields",
 }
 
-func planNextAction(ctx workflow.Context, input PlannerRequest) (PlannerResponse, error) {
-	return PlannerResponse{}, nil
-}
-
-func executeToolCall(ctx workflow.Context, workflowID string, toolCall ToolCall) ToolCallResult {
+// executeToolCall runs toolCall against the snapshot the planner saw, so element
+// indexes refer to the tags on that screenshot.
+func executeToolCall(ctx workflow.Context, workflowID string, snapshotID string, toolCall ToolCall) ToolCallResult {
 	activityName, exists := toolActivityNameMap[toolCall.Name]
 	if !exists {
 		return ToolCallResult{
@@ -51,10 +66,17 @@ func executeToolCall(ctx workflow.Context, workflowID string, toolCall ToolCall)
 		}
 	}
 
-	toolCall.Arguments["workflow_id"] = workflowID
+	// The ids go into a copy so the result, which feeds the history and the
+	// trace, keeps the arguments exactly as the planner sent them.
+	arguments := make(map[string]interface{}, len(toolCall.Arguments)+2)
+	for key, value := range toolCall.Arguments {
+		arguments[key] = value
+	}
+	arguments["workflow_id"] = workflowID
+	arguments["snapshot_id"] = snapshotID
 
 	resp := make(map[string]interface{})
-	err := workflow.ExecuteActivity(ctx, activityName, toolCall.Arguments).Get(ctx, resp)
+	err := workflow.ExecuteActivity(ctx, activityName, arguments).Get(ctx, &resp)
 	if err != nil {
 		return ToolCallResult{
 			ToolCall: toolCall,
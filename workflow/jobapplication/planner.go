@@ -0,0 +1,300 @@
+package jobapplication
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/SomtoJF/iris-worker/activity/browser"
+	"github.com/SomtoJF/iris-worker/aipi"
+	"github.com/SomtoJF/iris-worker/aipi/types"
+	"go.temporal.io/sdk/workflow"
+)
+
+const (
+	defaultPlannerModel = "google/gemini-2.5-flash"
+	// completeApplicationTool has no activity; calling it ends the agent loop.
+	completeApplicationTool = "complete_application"
+	// plannerHeartbeatTimeout catches a CallLLM whose worker died. A hung model is
+	// the client's attempt timeout's job; the heartbeat timeout must not be shorter,
+	// or it would end the activity before the fallback chain moves on.
+	plannerHeartbeatTimeout = aipi.DefaultAttemptTimeout
+)
+
+// plannerTools is the tool catalog shown to the planner. Every entry except
+// completeApplicationTool must have a matching activity in toolActivityNameMap.
+var plannerTools = []types.ToolDefinition{
+	{
+		Name:        "click",
+		Description: "Click the element with the given tag index.",
+		Parameters: objectSchema(map[string]interface{}{
+			"element_index": integerSchema("Tag index of the element to click"),
+		}, "element_index"),
+	},
+	{
+		Name:        "type",
+		Description: "Type text into the element with the given tag index, replacing what it holds.",
+		Parameters: objectSchema(map[string]interface{}{
+			"element_index": integerSchema("Tag index of the field to type into"),
+			"text":          stringSchema("Text to type"),
+		}, "element_index", "text"),
+	},
+	{
+		Name:        "type_multiple",
+		Description: "Type text into several fields in one step, replacing what they hold. Prefer this when filling out a form.",
+		Parameters: objectSchema(map[string]interface{}{
+			"fields": map[string]interface{}{
+				"type": "array",
+				"items": objectSchema(map[string]interface{}{
+					"element_index": integerSchema("Tag index of the field to type into"),
+					"text":          stringSchema("Text to type"),
+				}, "element_index", "text"),
+			},
+		}, "fields"),
+	},
+	{
+		Name:        "press_key",
+		Description: "Press a key or key combination, e.g. Enter to pick an autocomplete suggestion, Tab to leave a field, Escape to close a dialog, or Ctrl+A. Focuses the element with the given tag index first if one is given.",
+		Parameters: objectSchema(map[string]interface{}{
+			"key":           stringSchema("Key or chord joined with +, such as Enter, Tab, Escape, ArrowDown, Ctrl+A or Shift+Tab"),
+			"element_index": integerSchema("Optional tag index of the element to focus first"),
+		}, "key"),
+	},
+	{
+		Name:        "scroll",
+		Description: "Scroll the page up or down by a fraction of the viewport height.",
+		Parameters: objectSchema(map[string]interface{}{
+			"direction": map[string]interface{}{"type": "string", "enum": []string{"up", "down"}},
+			"ratio":     map[string]interface{}{"type": "number", "description": "Fraction of the viewport height, between 0.1 and 1.0"},
+		}, "direction", "ratio"),
+	},
+	{
+		Name:        "navigate",
+		Description: "Navigate the current tab to a url.",
+		Parameters: objectSchema(map[string]interface{}{
+			"url": stringSchema("Absolute url to open"),
+		}, "url"),
+	},
+	{
+		Name:        "extract_form_fields",
+		Description: "List every form field on the page with its label, type, section, current value, options and whether it is required or invalid. Use it to check a long form before filling it out or submitting it.",
+		Parameters:  objectSchema(map[string]interface{}{}),
+	},
+	{
+		Name:        completeApplicationTool,
+		Description: "Call this once the application has been submitted successfully.",
+		Parameters:  objectSchema(map[string]interface{}{}),
+	},
+}
+
+// PlannerResult is the planner's decision along with the exact request and raw
+// completion that produced it.
+type PlannerResult struct {
+	PlannerResponse
+	Prompt     types.AIPIRequest  `json:"prompt"`
+	Completion types.AIPIResponse `json:"completion"`
+	Latency    time.Duration      `json:"latency"`
+}
+
+// planNextAction must run on the session context so CallLLM lands on the worker
+// that holds the screenshot file.
+func planNextAction(ctx workflow.Context, input PlannerRequest) (PlannerResult, error) {
+	input, err := fitPlannerRequest(input)
+	if err != nil {
+		return PlannerResult{}, err
+	}
+
+	prompt, err := buildPlannerPrompt(input)
+	if err != nil {
+		return PlannerResult{}, err
+	}
+
+	// CallLLM heartbeats throughout, so a lost worker is noticed long before
+	// StartToCloseTimeout.
+	llmCtx := workflow.WithHeartbeatTimeout(ctx, plannerHeartbeatTimeout)
+
+	startedAt := workflow.Now(ctx)
+	var completion types.AIPIResponse
+	err = workflow.ExecuteActivity(llmCtx, "CallLLM", prompt).Get(ctx, &completion)
+	if err != nil {
+		return PlannerResult{}, err
+	}
+
+	result := PlannerResult{
+		Prompt:     prompt,
+		Completion: completion,
+		Latency:    workflow.Now(ctx).Sub(startedAt),
+	}
+
+	plannerResponse, err := parsePlannerResponse(completion)
+	if err != nil {
+		return result, err
+	}
+	result.PlannerResponse = plannerResponse
+
+	return result, nil
+}
+
+// parsePlannerResponse reads the planner's native tool call, falling back to a JSON
+// body for providers that answer in plain text.
+func parsePlannerResponse(completion types.AIPIResponse) (PlannerResponse, error) {
+	if len(completion.ToolCalls) > 0 {
+		call := completion.ToolCalls[0]
+		if call.Name == completeApplicationTool {
+			return PlannerResponse{IsApplicationComplete: true}, nil
+		}
+
+		arguments := map[string]interface{}{}
+		if call.Arguments != "" {
+			if err := json.Unmarshal([]byte(call.Arguments), &arguments); err != nil {
+				return PlannerResponse{}, fmt.Errorf("failed to parse arguments of tool %s: %w", call.Name, err)
+			}
+		}
+		return PlannerResponse{ToolCall: &ToolCall{Name: call.Name, Arguments: arguments}}, nil
+	}
+
+	var plannerResponse PlannerResponse
+	if err := json.Unmarshal([]byte(stripCodeFence(completion.Content)), &plannerResponse); err != nil {
+		return PlannerResponse{}, fmt.Errorf("failed to parse planner response: %w", err)
+	}
+	return plannerResponse, nil
+}
+
+// rawCompletion is what the model actually returned, tool calls included, for the agent trace.
+func rawCompletion(completion types.AIPIResponse) string {
+	if len(completion.ToolCalls) == 0 {
+		return completion.Content
+	}
+	toolCalls, err := json.Marshal(completion.ToolCalls)
+	if err != nil {
+		return completion.Content
+	}
+	return completion.Content + string(toolCalls)
+}
+
+func buildPlannerPrompt(input PlannerRequest) (types.AIPIRequest, error) {
+	history, err := json.Marshal(input.ToolCallHistory)
+	if err != nil {
+		return types.AIPIRequest{}, err
+	}
+
+	// Page text names every control by its tag index, so it replaces the list.
+	elements := "Tagged elements:\n"
+	if input.PageText != "" {
+		elements = "Page, with each interactive element's tag index in brackets:\n" + input.PageText + "\n"
+	} else {
+		for _, node := range input.TaggedNodes {
+			elements += node.Description + "\n"
+		}
+	}
+
+	observation := "a screenshot of the page where each interactive element carries a red tag with its index,\nthe list of tagged elements"
+	switch {
+	case input.ScreenshotURI == "":
+		observation = "a text description of the page that gives each interactive element's tag index"
+	case input.PageText != "":
+		observation = "a screenshot of the page where each interactive element carries a red tag with its index,\na text description of the page giving the same indexes"
+	}
+	systemMessage := `You are an agent that fills out and submits job applications in a web browser.
+On every turn you get ` + observation + `, and the results of the tools you already called.
+Call exactly one tool per turn. Call ` + completeApplicationTool + ` once the application has been submitted.`
+
+	userMessage := fmt.Sprintf("Job posting: %s\n\n%s\nTool call history:\n%s",
+		input.JobPostingUrl, elements, history)
+	if input.HistorySummary != "" {
+		userMessage += "\n\nEarlier tool calls, summarized:\n" + input.HistorySummary
+	}
+	if len(input.ValidationErrors) > 0 {
+		userMessage += "\n\nThe page shows these errors; fix the fields before submitting again:\n" +
+			formatValidationErrors(input.ValidationErrors)
+	}
+
+	model := input.Model
+	if model == "" {
+		model = defaultPlannerModel
+	}
+	temperature := 0.0
+	parallelToolCalls := false
+
+	// Showing the previous screenshot next to the current one lets the planner see
+	// what its last action actually changed.
+	parts := []types.ContentPart{types.TextPart(userMessage)}
+	if input.ScreenshotURI != "" {
+		if input.PreviousScreenshotURI != "" {
+			parts = append(parts,
+				types.TextPart("Screenshot before your last action:"),
+				screenshotPart(input.PreviousScreenshotURI, input.MaxImageDimension),
+				types.TextPart("Current screenshot:"))
+		}
+		parts = append(parts, screenshotPart(input.ScreenshotURI, input.MaxImageDimension))
+	}
+
+	return types.AIPIRequest{
+		SystemMessage: systemMessage,
+		// The system prompt and tools are identical on every iteration.
+		CacheSystemMessage: true,
+		Messages:           []types.Message{{Role: types.MessageRoleUser, Parts: parts}},
+		Model:              model,
+		UseCase:            types.UseCasePlanner,
+		Temperature:        &temperature,
+		Tools:              plannerTools,
+		// The workflow executes one action per screenshot.
+		ToolChoice:        types.ToolChoiceRequired,
+		ParallelToolCalls: &parallelToolCalls,
+	}, nil
+}
+
+// formatValidationErrors writes one line per error, leading with the tag index of
+// the field it is about when known.
+func formatValidationErrors(validationErrors []browser.FieldError) string {
+	var lines strings.Builder
+	for _, validationError := range validationErrors {
+		lines.WriteString("- ")
+		if validationError.ElementIndex != nil {
+			fmt.Fprintf(&lines, "[%d] ", *validationError.ElementIndex)
+		}
+		if validationError.Field != "" {
+			lines.WriteString(validationError.Field + ": ")
+		}
+		message := validationError.Message
+		if message == "" {
+			message = "invalid"
+		}
+		lines.WriteString(message + "\n")
+	}
+	return lines.String()
+}
+
+func screenshotPart(uri string, maxDimension int) types.ContentPart {
+	part := types.ImagePart(uri)
+	part.MaxImageDimension = maxDimension
+	return part
+}
+
+func stripCodeFence(content string) string {
+	content = strings.TrimSpace(content)
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSuffix(content, "```")
+	return strings.TrimSpace(content)
+}
+
+func objectSchema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func integerSchema(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "integer", "description": description}
+}
+
+func stringSchema(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "description": description}
+}
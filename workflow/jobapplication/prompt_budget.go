@@ -0,0 +1,191 @@
+package jobapplication
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/SomtoJF/iris-worker/aipi"
+	"github.com/SomtoJF/iris-worker/aipi/types"
+	"github.com/SomtoJF/iris-worker/browserfactory"
+)
+
+const (
+	// plannerOutputReserve keeps room in the context window for the planner's answer.
+	plannerOutputReserve = 2048
+	// minImageDimension is as far as screenshots get downscaled; below it tags become unreadable.
+	minImageDimension = 512
+	// pageTextCutNote marks page text that was cut to fit.
+	pageTextCutNote = "\n[rest of the page left out to fit]"
+)
+
+// formRoles are the roles a form is filled out with. Buttons count because
+// submitting is part of filling out a form.
+var formRoles = map[string]bool{
+	"textbox":    true,
+	"searchbox":  true,
+	"textarea":   true,
+	"input":      true,
+	"checkbox":   true,
+	"radio":      true,
+	"combobox":   true,
+	"select":     true,
+	"option":     true,
+	"listbox":    true,
+	"spinbutton": true,
+	"switch":     true,
+	"slider":     true,
+	"button":     true,
+}
+
+// fitPlannerRequest trims input until the planner prompt built from it fits the
+// model's context window. It drops tagged nodes that are off-screen, then ones
+// that aren't form controls, then unnamed ones, each starting from the bottom of
+// the list. After that it folds older tool calls into a summary, downscales the
+// screenshots, leaves out the previous screenshot and finally cuts page text from
+// the bottom. Each step only runs while the prompt is still too large. An unknown
+// context window leaves input as is.
+func fitPlannerRequest(input PlannerRequest) (PlannerRequest, error) {
+	if input.ContextWindow <= 0 {
+		return input, nil
+	}
+	limit := input.ContextWindow - plannerOutputReserve
+
+	var estimateErr error
+	fits := func() bool {
+		tokens, err := estimatePlannerTokens(input)
+		if err != nil {
+			estimateErr = err
+			return true
+		}
+		return tokens <= limit
+	}
+
+	// Dropping a node takes its line out of the prompt and changes nothing else,
+	// so the prompt is sized once and each dropped line's cost subtracted, rather
+	// than re-estimating the whole prompt per node. Page text stands in for the
+	// list, in which case dropping nodes wouldn't shrink the prompt at all.
+	if input.PageText == "" {
+		tokens, err := estimatePlannerTokens(input)
+		if err != nil {
+			return input, err
+		}
+		model := input.Model
+		if model == "" {
+			model = defaultPlannerModel
+		}
+
+		droppable := []func(browserfactory.SerializableTaggedNode) bool{
+			func(node browserfactory.SerializableTaggedNode) bool { return !isOnScreen(node, input) },
+			func(node browserfactory.SerializableTaggedNode) bool { return !formRoles[node.Role] },
+			isDecorative,
+		}
+		for _, drop := range droppable {
+			for i := len(input.TaggedNodes) - 1; i >= 0 && tokens > limit; i-- {
+				if drop(input.TaggedNodes[i]) {
+					tokens -= nodeTokens(model, input.TaggedNodes[i])
+					input.TaggedNodes = append(input.TaggedNodes[:i:i], input.TaggedNodes[i+1:]...)
+				}
+			}
+		}
+	}
+
+	for len(input.ToolCallHistory) > 1 && !fits() {
+		input = summarizeOldestToolCall(input)
+	}
+
+	dimension := max(input.ScreenshotWidth, input.ScreenshotHeight)
+	for dimension/2 >= minImageDimension && !fits() {
+		dimension /= 2
+		input.MaxImageDimension = dimension
+	}
+
+	if input.PreviousScreenshotURI != "" && !fits() {
+		input.PreviousScreenshotURI = ""
+	}
+
+	for input.PageText != "" && !fits() {
+		input.PageText = halvePageText(input.PageText)
+	}
+
+	return input, estimateErr
+}
+
+// estimatePlannerTokens sizes the prompt buildPlannerPrompt makes from input, with
+// a tenth added for estimation error.
+func estimatePlannerTokens(input PlannerRequest) (int, error) {
+	prompt, err := buildPlannerPrompt(input)
+	if err != nil {
+		return 0, err
+	}
+
+	width, height := aipi.ScaleToFit(input.ScreenshotWidth, input.ScreenshotHeight, input.MaxImageDimension)
+	tokens := aipi.EstimateTextTokens(prompt.Model, prompt.SystemMessage) + aipi.EstimateToolTokens(prompt.Model, prompt.Tools)
+	for _, message := range prompt.Messages {
+		for _, part := range message.Parts {
+			switch part.Type {
+			case types.ContentPartTypeText:
+				tokens += aipi.EstimateTextTokens(prompt.Model, part.Text)
+			case types.ContentPartTypeImage:
+				tokens += aipi.EstimateImageTokens(prompt.Model, width, height)
+			}
+		}
+	}
+	return tokens + tokens/10, nil
+}
+
+// nodeTokens is what node's line adds to the planner prompt, with the same tenth
+// added for estimation error as estimatePlannerTokens.
+func nodeTokens(model string, node browserfactory.SerializableTaggedNode) int {
+	tokens := aipi.EstimateTextTokens(model, node.Description+"\n")
+	return tokens + tokens/10
+}
+
+// isOnScreen reports whether any part of node lies inside the screenshot. With no
+// known screenshot size every node counts as on screen.
+func isOnScreen(node browserfactory.SerializableTaggedNode, input PlannerRequest) bool {
+	if input.ScreenshotWidth == 0 || input.ScreenshotHeight == 0 {
+		return true
+	}
+	return node.X+node.Width > 0 && node.Y+node.Height > 0 &&
+		node.X < float64(input.ScreenshotWidth) && node.Y < float64(input.ScreenshotHeight)
+}
+
+// isDecorative matches nodes without an accessible name, which the planner has no
+// way to tell apart from the screenshot alone.
+func isDecorative(node browserfactory.SerializableTaggedNode) bool {
+	return strings.TrimSpace(node.Name) == ""
+}
+
+// summarizeOldestToolCall moves the oldest tool call out of the history and into
+// a one-line summary.
+func summarizeOldestToolCall(input PlannerRequest) PlannerRequest {
+	oldest := input.ToolCallHistory[0]
+	input.ToolCallHistory = input.ToolCallHistory[1:]
+
+	encoded, _ := json.Marshal(oldest.Arguments)
+
+	outcome := "ok"
+	if oldest.Error != "" {
+		outcome = "failed: " + oldest.Error
+	}
+
+	line := fmt.Sprintf("- %s %s: %s", oldest.Name, encoded, outcome)
+	if input.HistorySummary == "" {
+		input.HistorySummary = line
+	} else {
+		input.HistorySummary += "\n" + line
+	}
+	return input
+}
+
+// halvePageText keeps the first half of text's lines, noting that the rest was
+// cut. Text of a single line is dropped.
+func halvePageText(text string) string {
+	text = strings.TrimSuffix(text, pageTextCutNote)
+	lines := strings.Split(text, "\n")
+	if len(lines) < 2 {
+		return ""
+	}
+	return strings.Join(lines[:len(lines)/2], "\n") + pageTextCutNote
+}
@@ -0,0 +1,61 @@
+package jobapplication
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/SomtoJF/iris-worker/browserfactory"
+)
+
+func TestFitPlannerRequestDropsNodes(t *testing.T) {
+	var onScreen, offScreen []browserfactory.SerializableTaggedNode
+	for i := 0; i < 300; i++ {
+		node := browserfactory.SerializableTaggedNode{
+			Index:       i,
+			Description: fmt.Sprintf("[%d] textbox \"Question %d\"", i, i),
+			Role:        "textbox",
+			Name:        fmt.Sprintf("Question %d", i),
+			Width:       200,
+			Height:      30,
+			Y:           float64(i) * 40,
+		}
+		if node.Y < 800 {
+			onScreen = append(onScreen, node)
+		} else {
+			offScreen = append(offScreen, node)
+		}
+	}
+
+	input := PlannerRequest{
+		JobPostingUrl:    "https://jobs.example.com/1",
+		TaggedNodes:      onScreen,
+		ScreenshotWidth:  1280,
+		ScreenshotHeight: 800,
+	}
+	onScreenTokens, err := estimatePlannerTokens(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input.TaggedNodes = append(onScreen, offScreen...)
+	input.ContextWindow = onScreenTokens + plannerOutputReserve + 50
+
+	fitted, err := fitPlannerRequest(input)
+	if err != nil {
+		t.Fatalf("fitPlannerRequest: %v", err)
+	}
+	tokens, err := estimatePlannerTokens(fitted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit := input.ContextWindow - plannerOutputReserve; tokens > limit {
+		t.Errorf("fitted prompt is %d tokens, want at most %d", tokens, limit)
+	}
+	if len(fitted.TaggedNodes) < len(onScreen) || len(fitted.TaggedNodes) == len(input.TaggedNodes) {
+		t.Fatalf("kept %d of %d nodes, want the %d on screen kept and the rest cut down", len(fitted.TaggedNodes), len(input.TaggedNodes), len(onScreen))
+	}
+	for i, node := range onScreen {
+		if fitted.TaggedNodes[i].Index != node.Index {
+			t.Fatalf("node %d is %d, want on-screen node %d kept in order", i, fitted.TaggedNodes[i].Index, node.Index)
+		}
+	}
+}
@@ -5,17 +5,47 @@ import (
 	"time"
 
 	"github.com/SomtoJF/iris-worker/activity/browser"
+	"github.com/SomtoJF/iris-worker/activity/llm"
 	"github.com/SomtoJF/iris-worker/activity/sqldb"
 	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
 )
 
 type JobApplicationWorkflowInput struct {
-	IdJobApplication uint   `json:"id_job_application"`
-	Url              string `json:"url"`
+	IdJobApplication uint            `json:"id_job_application"`
+	Url              string          `json:"url"`
+	PlannerModel     string          `json:"planner_model,omitempty"`
+	Budget           BudgetConfig    `json:"budget,omitempty"`
+	Observation      ObservationMode `json:"observation,omitempty"`
 }
 
-func JobApplicationWorkflow(ctx workflow.Context, input JobApplicationWorkflowInput) error {
+// ObservationMode picks how the planner sees the page.
+type ObservationMode string
+
+const (
+	// ObservationScreenshot shows the annotated screenshot. It is the default.
+	ObservationScreenshot ObservationMode = "screenshot"
+	// ObservationText describes the page in text only, for models without vision
+	// or to save on image tokens.
+	ObservationText ObservationMode = "text"
+	// ObservationBoth shows the screenshot and the page text.
+	ObservationBoth ObservationMode = "both"
+)
+
+func (m ObservationMode) usesScreenshot() bool {
+	return m != ObservationText
+}
+
+func (m ObservationMode) usesText() bool {
+	return m == ObservationText || m == ObservationBoth
+}
+
+type JobApplicationWorkflowResult struct {
+	Iterations int      `json:"iterations"`
+	Usage      LLMUsage `json:"usage"`
+}
+
+func JobApplicationWorkflow(ctx workflow.Context, input JobApplicationWorkflowInput) (JobApplicationWorkflowResult, error) {
 	logger := workflow.GetLogger(ctx)
 
 	logger.Info("JobApplicationWorkflow started", "url", input.Url)
@@ -32,6 +62,7 @@ func JobApplicationWorkflow(ctx workflow.Context, input JobApplicationWorkflowIn
 	ctx = workflow.WithActivityOptions(ctx, activityOptions)
 
 	workflowId := workflow.GetInfo(ctx).WorkflowExecution.ID
+	runId := workflow.GetInfo(ctx).WorkflowExecution.RunID
 
 	sessionCtx, err := workflow.CreateSession(ctx, &workflow.SessionOptions{
 		ExecutionTimeout: 30 * time.Minute,
@@ -40,14 +71,14 @@ func JobApplicationWorkflow(ctx workflow.Context, input JobApplicationWorkflowIn
 	if err != nil {
 		logger.Error("Failed to create session", "error", err)
 		updateJobApplicationStatus(ctx, input.IdJobApplication, sqldb.JobApplicationStatusFailed)
-		return err
+		return JobApplicationWorkflowResult{}, err
 	}
 	defer workflow.CompleteSession(sessionCtx)
 
 	if err := openWebpage(sessionCtx, workflowId, input.Url); err != nil {
 		logger.Error("Failed to open webpage", "error", err)
 		updateJobApplicationStatus(ctx, input.IdJobApplication, sqldb.JobApplicationStatusFailed)
-		return err
+		return JobApplicationWorkflowResult{}, err
 	}
 
 	defer func() {
@@ -60,53 +91,123 @@ func JobApplicationWorkflow(ctx workflow.Context, input JobApplicationWorkflowIn
 	toolCallHistory := []ToolCallResult{}
 	const maxAgentIterations = 20
 
+	budget := input.Budget.withDefaults()
+	result := JobApplicationWorkflowResult{}
+	previousScreenshotURI := ""
+	modelLimits := modelLimitsCache{}
+	persistedCost := 0.0
+
 	for iteration := 0; !isApplicationComplete && iteration < maxAgentIterations; iteration++ {
+		result.Iterations = iteration + 1
+
 		var screenshot browser.TakeScreenshotOutput
+		// The screenshot is taken in text mode too: it tags the elements and
+		// goes into the agent trace.
 		err = workflow.ExecuteActivity(sessionCtx, "TakeScreenshot", browser.TakeScreenshotInput{
-			WorkflowID: workflowId,
-			FileName:   fmt.Sprintf("screenshot_%d.png", iteration),
+			WorkflowID:  workflowId,
+			IncludeText: input.Observation.usesText(),
 		}).Get(sessionCtx, &screenshot)
 		if err != nil {
 			logger.Error("Failed to take screenshot", "error", err)
-			updateJobApplicationStatus(ctx, input.IdJobApplication, sqldb.JobApplicationStatusFailed)
-			return err
+			updateJobApplicationOutcome(ctx, input.IdJobApplication, sqldb.JobApplicationStatusFailed, result.Usage)
+			return result, err
 		}
 
+		plannerModel := budget.plannerModel(result.Usage, input.PlannerModel)
 		plannerRequest := PlannerRequest{
-			JobPostingUrl:   input.Url,
-			ScreenshotPath:  screenshot.Path,
-			TaggedNodes:     screenshot.TaggedNodes,
-			ToolCallHistory: toolCallHistory,
+			JobPostingUrl:         input.Url,
+			PreviousScreenshotURI: previousScreenshotURI,
+			PageText:              screenshot.Text,
+			ValidationErrors:      screenshot.ValidationErrors,
+			TaggedNodes:           screenshot.TaggedNodes,
+			ToolCallHistory:       toolCallHistory,
+			Model:                 plannerModel,
+			ScreenshotWidth:       screenshot.Width,
+			ScreenshotHeight:      screenshot.Height,
+			ContextWindow:         modelLimits.get(ctx, plannerModel).ContextLength,
+		}
+		if input.Observation.usesScreenshot() {
+			plannerRequest.ScreenshotURI = screenshot.URI
+		}
+
+		plannerResult, err := planNextAction(sessionCtx, plannerRequest)
+		if plannerResult.Completion.Model != "" {
+			result.Usage.Add(plannerResult.Completion)
 		}
 
-		plannerResponse, err := planNextAction(ctx, plannerRequest)
+		step := sqldb.RecordAgentStepInput{
+			IdJobApplication: input.IdJobApplication,
+			WorkflowID:       workflowId,
+			RunID:            runId,
+			Iteration:        iteration,
+			ScreenshotURI:    screenshot.URI,
+			TaggedNodes:      screenshot.TaggedNodes,
+			Prompt:           plannerResult.Prompt,
+			RawResponse:      rawCompletion(plannerResult.Completion),
+			LatencyMs:        plannerResult.Latency.Milliseconds(),
+			Cost:             plannerResult.Completion.TotalCost,
+		}
+
+		// The failed step is what explains the failed run, so it is recorded too.
 		if err != nil {
 			logger.Error("Failed to plan next action", "error", err)
-			updateJobApplicationStatus(ctx, input.IdJobApplication, sqldb.JobApplicationStatusFailed)
-			return err
+			step.PlannerError = err.Error()
+			if err := recordAgentStep(ctx, step); err != nil {
+				logger.Warn("Failed to record agent step", "iteration", iteration, "error", err)
+			}
+			updateJobApplicationOutcome(ctx, input.IdJobApplication, sqldb.JobApplicationStatusFailed, result.Usage)
+			return result, err
+		}
+		isApplicationComplete = plannerResult.IsApplicationComplete
+		previousScreenshotURI = plannerRequest.ScreenshotURI
+
+		if plannerResult.ToolCall != nil {
+			toolResult := executeToolCall(sessionCtx, workflowId, screenshot.SnapshotID, *plannerResult.ToolCall)
+			toolCallHistory = append(toolCallHistory, toolResult)
+
+			step.ToolName = toolResult.Name
+			step.ToolArguments = toolResult.Arguments
+			step.ToolResult = toolResult.Result
+			step.ToolError = toolResult.Error
+		}
+
+		if err := recordAgentStep(ctx, step); err != nil {
+			logger.Warn("Failed to record agent step", "iteration", iteration, "error", err)
+		}
+
+		// Spend is saved as it accumulates, so a run that dies mid-loop still
+		// shows what it cost.
+		if result.Usage.TotalCost != persistedCost {
+			if err := updateJobApplicationCost(ctx, input.IdJobApplication, result.Usage); err != nil {
+				logger.Warn("Failed to save LLM spend", "iteration", iteration, "error", err)
+			} else {
+				persistedCost = result.Usage.TotalCost
+			}
 		}
-		isApplicationComplete = plannerResponse.IsApplicationComplete
 
-		if plannerResponse.ToolCall != nil {
-			result := executeToolCall(sessionCtx, workflowId, *plannerResponse.ToolCall)
-			toolCallHistory = append(toolCallHistory, result)
+		if !isApplicationComplete && budget.isExceeded(result.Usage) {
+			logger.Warn("LLM budget exceeded", "total_cost", result.Usage.TotalCost, "hard_limit_usd", budget.HardLimitUSD)
+			updateJobApplicationOutcome(ctx, input.IdJobApplication, sqldb.JobApplicationStatusFailed, result.Usage)
+			return result, temporal.NewNonRetryableApplicationError(
+				fmt.Sprintf("llm spend of $%.4f exceeded the $%.4f budget", result.Usage.TotalCost, budget.HardLimitUSD),
+				BudgetExceededErrorType, nil, result)
 		}
 	}
 
 	if !isApplicationComplete {
-		if err := updateJobApplicationStatus(ctx, input.IdJobApplication, sqldb.JobApplicationStatusFailed); err != nil {
+		if err := updateJobApplicationOutcome(ctx, input.IdJobApplication, sqldb.JobApplicationStatusFailed, result.Usage); err != nil {
 			logger.Error("Failed to update job application status", "error", err)
-			return err
+			return result, err
 		}
-		logger.Warn("Job application not complete after %d iterations", maxAgentIterations)
-		return fmt.Errorf("job application not complete after %d iterations", maxAgentIterations)
+		logger.Warn("Job application not complete", "iterations", maxAgentIterations)
+		return result, fmt.Errorf("job application not complete after %d iterations", maxAgentIterations)
 	}
 
-	if err := updateJobApplicationStatus(ctx, input.IdJobApplication, sqldb.JobApplicationStatusApplied); err != nil {
+	if err := updateJobApplicationOutcome(ctx, input.IdJobApplication, sqldb.JobApplicationStatusApplied, result.Usage); err != nil {
 		logger.Error("Failed to update job application status", "error", err)
 	}
 
-	return nil
+	return result, nil
 }
 
 func openWebpage(ctx workflow.Context, workflowID string, url string) error {
@@ -116,6 +217,52 @@ func openWebpage(ctx workflow.Context, workflowID string, url string) error {
 	}).Get(ctx, nil)
 }
 
+// modelLimitsCache remembers limits per model so switching to the cheap planner
+// model costs one lookup rather than one per iteration.
+type modelLimitsCache map[string]llm.ModelLimits
+
+// get returns zero limits if the lookup fails, which turns prompt budgeting off.
+func (c modelLimitsCache) get(ctx workflow.Context, model string) llm.ModelLimits {
+	if model == "" {
+		model = defaultPlannerModel
+	}
+	if limits, exists := c[model]; exists {
+		return limits
+	}
+
+	var limits llm.ModelLimits
+	if err := workflow.ExecuteActivity(ctx, "GetModelLimits", model).Get(ctx, &limits); err != nil {
+		workflow.GetLogger(ctx).Warn("Failed to look up model limits", "model", model, "error", err)
+		return llm.ModelLimits{}
+	}
+	c[model] = limits
+	return limits
+}
+
+func recordAgentStep(ctx workflow.Context, step sqldb.RecordAgentStepInput) error {
+	return workflow.ExecuteActivity(ctx, "RecordAgentStep", step).Get(ctx, nil)
+}
+
+// updateJobApplicationOutcome writes the final status together with the accumulated LLM spend.
+func updateJobApplicationOutcome(ctx workflow.Context, idJobApplication uint, status sqldb.JobApplicationStatus, usage LLMUsage) error {
+	return workflow.ExecuteActivity(ctx, "UpdateJobApplication", sqldb.UpdateJobApplicationInput{
+		IdJobApplication: idJobApplication,
+		Data: map[string]interface{}{
+			"status":   status,
+			"llm_cost": usage.TotalCost,
+		},
+	}).Get(ctx, nil)
+}
+
+func updateJobApplicationCost(ctx workflow.Context, idJobApplication uint, usage LLMUsage) error {
+	return workflow.ExecuteActivity(ctx, "UpdateJobApplication", sqldb.UpdateJobApplicationInput{
+		IdJobApplication: idJobApplication,
+		Data: map[string]interface{}{
+			"llm_cost": usage.TotalCost,
+		},
+	}).Get(ctx, nil)
+}
+
 func updateJobApplicationStatus(ctx workflow.Context, idJobApplication uint, status sqldb.JobApplicationStatus) error {
 	return workflow.ExecuteActivity(ctx, "UpdateJobApplication", sqldb.UpdateJobApplicationInput{
 		IdJobApplication: idJobApplication,